@@ -0,0 +1,261 @@
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CycleCronByMinuteInSameHour cycles cron minute.
+// Assumes cronStr is "1 2 3 4 5" format.
+// "30 6 * * *" -> "31 6 * * *" -> ... "59 6 * * *" -> "0 6 * * *" -> "1 6 * * *" -> ...
+func CycleCronByMinuteInSameHour(cronStr string) (string, error) {
+	ss := strings.Split(cronStr, " ")
+	if len(ss) != 5 {
+		return "", fmt.Errorf("cronStr must be \"1 2 3 4 5\" format but got %s", cronStr)
+	}
+	minute, err := strconv.Atoi(ss[0])
+	if err != nil || minute < 0 || minute >= 60 {
+		return "", fmt.Errorf("cronStr has invalid minute field cronStr=%s minute=%d err=%v", cronStr, minute, err)
+	}
+	minute = (minute + 1) % 60
+	ss[0] = strconv.Itoa(minute)
+	return strings.Join(ss, " "), nil
+}
+
+// GetOwnedConfigMapName returns "gitbackup-collection-{r.Name}-gitconfig"
+func (r Collection) GetOwnedConfigMapName() string {
+	return strings.Join([]string{OperatorName, "collection", r.Name, "gitconfig"}, "-")
+}
+
+// GetGitConfigName returns the name of r.Spec.GitConfig or GetOwnedConfigMapName if it is not specified.
+func (r Collection) GetGitConfigName() string {
+	if r.Spec.GitConfig != nil {
+		return r.Spec.GitConfig.Name
+	}
+	return r.GetOwnedConfigMapName()
+}
+
+// ToRFC1123 converts s to RFC1123 DNS Subdomain Names by lower-casing it, replacing "_" with "-"
+// and removing other invalid characters. It returns def if nothing is left.
+func ToRFC1123(s string, def string) string {
+	s = strings.ToLower(s)
+	s = strings.ReplaceAll(s, "_", "-")
+	var sb strings.Builder
+	for _, c := range s {
+		if c == '.' || c == '-' || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			sb.WriteByte(byte(c))
+		}
+	}
+	s = sb.String()
+	a := 0
+	b := len(s)
+	for i, c := range s {
+		if c != '.' && c != '-' {
+			a = i
+			break
+		}
+		// only '.' or '-'
+		if i == len(s)-1 {
+			return def
+		}
+	}
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] != '.' && s[i] != '-' {
+			b = i + 1
+			break
+		}
+	}
+	s = s[a:b]
+	if len(s) == 0 {
+		return def
+	}
+	if len(s) > 253 {
+		return s[0:253]
+	}
+	return s
+}
+
+const (
+	// MaxCronJobNameLength is the maximum length of CronJob names
+	// as the controller appends 11 characters to the name of Jobs and the name is used as a label value (max 63).
+	MaxCronJobNameLength = 52
+	// MaxRepositoryNameLength is the maximum length of Repository names
+	// so that the CronJob name "gitbackup-{name}" fits in MaxCronJobNameLength.
+	MaxRepositoryNameLength = MaxCronJobNameLength - len(OperatorName) - 1
+)
+
+// TruncateName returns name if it is not longer than max,
+// otherwise the first characters of name followed by "-" and 8 characters of the hash of name.
+func TruncateName(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return strings.TrimRight(name[:max-9], "-.") + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// GetOwnedRepositoryNames returns ["{r.Name}-{r.Repos[i].Name}", ...]
+// The webhooks reject names longer than MaxRepositoryNameLength; they are truncated by TruncateName
+// only so that the controllers keep working for the objects created before the validation.
+func (r Collection) GetOwnedRepositoryNames() []string {
+	prefix := strings.Join([]string{r.Name, ""}, "-")
+	names := make([]string, len(r.Spec.Repos))
+	for i, cr := range r.Spec.Repos {
+		names[i] = TruncateName(prefix+cr.GetName(), MaxRepositoryNameLength)
+	}
+	return names
+}
+
+// GetName returns cr.Name or the last element of cr.Source.URL converted by ToRFC1123.
+func (cr CollectionRepo) GetName() string {
+	if cr.Name != nil {
+		return *cr.Name
+	}
+	ss := strings.Split(cr.Source.URL, "/")
+	return ToRFC1123(ss[len(ss)-1], "invalid-name")
+}
+
+// GetSource returns cr.Source with the credentials of the Collection if cr.Source does not specify them.
+func (r Collection) GetSource(cr CollectionRepo) GitRemote {
+	if cr.Source.Credentials == nil {
+		cr.Source.Credentials = r.Spec.SourceCredentials
+	}
+	return cr.Source
+}
+
+// GetDestination returns cr.Destination with the credentials of the Collection if cr.Destination does not specify them.
+func (r Collection) GetDestination(cr CollectionRepo) GitRemote {
+	if cr.Destination.Credentials == nil {
+		cr.Destination.Credentials = r.Spec.DestinationCredentials
+	}
+	return cr.Destination
+}
+
+// PrunePolicy is what to do with Repositories removed from a Collection.
+// +kubebuilder:validation:Enum=Delete;Orphan
+type PrunePolicy string
+
+const (
+	// PruneDelete deletes the Repository.
+	PruneDelete PrunePolicy = "Delete"
+	// PruneOrphan keeps the Repository and removes the owner reference so that the Collection no longer manages it.
+	PruneOrphan PrunePolicy = "Orphan"
+)
+
+// CollectionSpec defines the desired state of Collection
+type CollectionSpec struct {
+	// Schedule in Cron format.
+	Schedule string `json:"schedule"`
+	// TimeZone in TZ database name.
+	// See also: https://kubernetes.io/docs/concepts/workloads/controllers/cron-jobs/#time-zones
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// BackupClassName specifies the BackupClass to take defaults from. (default: the default BackupClass if exists)
+	// +optional
+	BackupClassName *string `json:"backupClassName,omitempty"`
+
+	// GitImage specifies the container image to run.
+	// +optional
+	GitImage *string `json:"gitImage,omitempty"`
+	// ImagePullSecret specifies the name of the Secret in the same namespace used to pull the GitImage.
+	// +optional
+	ImagePullSecret *corev1.LocalObjectReference `json:"imagePullSecret,omitempty"`
+
+	// GitConfig specifies the name of the ConfigMap in the same namespace used to mount .gitconfig
+	// (default: a ConfigMap created by the controller that enables the credential store)
+	// +optional
+	GitConfig *corev1.LocalObjectReference `json:"gitConfig,omitempty"`
+
+	// SourceCredentials specifies the credentials of the sources that do not specify them.
+	// +optional
+	SourceCredentials *corev1.LocalObjectReference `json:"sourceCredentials,omitempty"`
+	// DestinationCredentials specifies the credentials of the destinations that do not specify them.
+	// +optional
+	DestinationCredentials *corev1.LocalObjectReference `json:"destinationCredentials,omitempty"`
+
+	// PodOptions is copied to each Repository.
+	PodOptions `json:",inline"`
+
+	// JobPolicy is copied to each Repository.
+	// +optional
+	JobPolicy *JobPolicy `json:"jobPolicy,omitempty"`
+
+	// Notifications is copied to each Repository.
+	// +optional
+	Notifications *NotificationsSpec `json:"notifications,omitempty"`
+
+	// MaxAge is copied to each Repository.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+
+	// PruneRemoved specifies what to do with Repositories that are removed from Repos or renamed. (default: Delete)
+	// +optional
+	PruneRemoved *PrunePolicy `json:"pruneRemoved,omitempty"`
+
+	// Repos specifies repositories to backup.
+	Repos []CollectionRepo `json:"repos"`
+}
+
+// CollectionRepo specifies a repository in a Collection.
+type CollectionRepo struct {
+	// Name specifies the name for the repository. (default: the last element of `Source.URL`)
+	// +optional
+	Name *string `json:"name,omitempty"`
+
+	// Source specifies the repository to backup.
+	Source GitRemote `json:"source"`
+	// Destination specifies the repository to push the backup to.
+	Destination GitRemote `json:"destination"`
+}
+
+// CollectionStatus defines the observed state of Collection
+type CollectionStatus struct {
+	// Repos is the number of Repositories controlled by the Collection.
+	// +optional
+	Repos int32 `json:"repos,omitempty"`
+	// Ready is the number of the Repositories whose last backup succeeded.
+	// +optional
+	Ready int32 `json:"ready,omitempty"`
+	// Failing is the number of the Repositories whose last backup failed.
+	// +optional
+	Failing int32 `json:"failing,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:resource:shortName=coll;colls,categories=gitbackup
+//+kubebuilder:printcolumn:name="Repos",type=integer,JSONPath=`.status.repos`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.ready`
+//+kubebuilder:printcolumn:name="Failing",type=integer,JSONPath=`.status.failing`
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Collection is the Schema for the collections API
+type Collection struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CollectionSpec   `json:"spec,omitempty"`
+	Status CollectionStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CollectionList contains a list of Collection
+type CollectionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Collection `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Collection{}, &CollectionList{})
+}
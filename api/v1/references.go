@@ -0,0 +1,48 @@
+package v1
+
+import (
+	"fmt"
+)
+
+// LocalReference is a reference to a Secret or a ConfigMap in the same namespace.
+type LocalReference struct {
+	// Field is the path of the field e.g. "spec.source.credentials".
+	Field string
+	// Kind is "Secret" or "ConfigMap".
+	Kind string
+	Name string
+}
+
+func (r LocalReference) String() string {
+	return fmt.Sprintf("%s %s %s", r.Field, r.Kind, r.Name)
+}
+
+// GetReferences returns the Secrets and ConfigMaps that r refers to.
+// The ConfigMap created by the controller is skipped.
+func (r Repository) GetReferences() []LocalReference {
+	var refs []LocalReference
+	if s := r.Spec.Source.Credentials; s != nil {
+		refs = append(refs, LocalReference{"spec.source.credentials", "Secret", s.Name})
+	}
+	if s := r.Spec.Destination.Credentials; s != nil {
+		refs = append(refs, LocalReference{"spec.destination.credentials", "Secret", s.Name})
+	}
+	if s := r.Spec.ImagePullSecret; s != nil {
+		refs = append(refs, LocalReference{"spec.imagePullSecret", "Secret", s.Name})
+	}
+	if cm := r.Spec.GitConfig; cm != nil && cm.Name != r.GetOwnedConfigMapName() {
+		refs = append(refs, LocalReference{"spec.gitConfig", "ConfigMap", cm.Name})
+	}
+	if enc := r.Spec.Encryption; enc != nil {
+		refs = append(refs,
+			LocalReference{"spec.encryption.publicKey", "Secret", enc.PublicKey.Name},
+			LocalReference{"spec.encryption.privateKey", "Secret", enc.PrivateKey.Name})
+	}
+	if md := r.Spec.Metadata; md != nil && md.Token != nil {
+		refs = append(refs, LocalReference{"spec.metadata.token", "Secret", md.Token.Name})
+	}
+	if f := r.Spec.DestinationForge; f != nil {
+		refs = append(refs, LocalReference{"spec.destinationForge.token", "Secret", f.Token.Name})
+	}
+	return refs
+}
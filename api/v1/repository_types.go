@@ -0,0 +1,724 @@
+package v1
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultMetadataImage is the image of the metadata exporter and the forge cleanup.
+// It is the controller image itself and set at build time with
+// -ldflags "-X github.com/ebiiim/gitbackup/api/v1.DefaultMetadataImage=<image>" (see Dockerfile).
+// It is empty in other builds, and then Repositories must specify the image.
+var DefaultMetadataImage string
+
+const (
+	OperatorName       = "gitbackup"
+	DefaultGitImage    = "alpine/git:2.36.2"
+	DefaultMetadataRef = "refs/gitbackup/metadata"
+
+	// SnapshotsRef is the prefix of snapshots. Each snapshot is stored as "{SnapshotsRef}/{ID}/{ref without "refs/"}".
+	SnapshotsRef = "refs/gitbackup/snapshots"
+	// DriftRef is the prefix of refs saved by DriftPreserveUnderRef. Each ref is stored as "{DriftRef}/{ID}/{ref without "refs/"}".
+	// It is under refs/gitbackup/ so that snapshots and restores skip the saved refs as well as the other refs of gitbackup.
+	DriftRef = "refs/gitbackup/drift"
+	// StateRef is the commit that has the refs pushed by the last backup with their object names
+	// to detect drift if OnDestinationDrift is not Overwrite. The state ConfigMap pins it with a digest.
+	StateRef = "refs/gitbackup/state"
+	// SnapshotIDFormat is the time layout of snapshot IDs. IDs are in UTC and sort in time order.
+	SnapshotIDFormat = "20060102T150405Z"
+)
+
+// GetOwnedConfigMapName returns "gitbackup-repository-{r.Name}-gitconfig"
+func (r Repository) GetOwnedConfigMapName() string {
+	return strings.Join([]string{OperatorName, "repository", r.Name, "gitconfig"}, "-")
+}
+
+// GetGitConfigName returns the name of r.Spec.GitConfig or GetOwnedConfigMapName if it is not specified.
+func (r Repository) GetGitConfigName() string {
+	if r.Spec.GitConfig != nil {
+		return r.Spec.GitConfig.Name
+	}
+	return r.GetOwnedConfigMapName()
+}
+
+// GetOwnedCronJobName returns "gitbackup-{r.Name}" truncated to MaxCronJobNameLength by TruncateName.
+func (r Repository) GetOwnedCronJobName() string {
+	return TruncateName(strings.Join([]string{OperatorName, r.Name}, "-"), MaxCronJobNameLength)
+}
+
+// GetCredentials returns the credentials of the source and the destination without duplicates.
+func (r Repository) GetCredentials() []corev1.LocalObjectReference {
+	var creds []corev1.LocalObjectReference
+	for _, c := range []*corev1.LocalObjectReference{r.Spec.Source.Credentials, r.Spec.Destination.Credentials} {
+		if c != nil && (len(creds) == 0 || creds[0].Name != c.Name) {
+			creds = append(creds, *c)
+		}
+	}
+	return creds
+}
+
+// GetMetadataProject returns r.Spec.Metadata.Project or the path of r.Spec.Source.URL without ".git" suffix.
+func (r Repository) GetMetadataProject() (string, error) {
+	if r.Spec.Metadata != nil && r.Spec.Metadata.Project != nil {
+		return *r.Spec.Metadata.Project, nil
+	}
+	return inferProject("source", r.Spec.Source.URL)
+}
+
+// GetMetadataAPIURL returns r.Spec.Metadata.APIURL or the default API URL of the forge inferred from r.Spec.Source.URL.
+//
+//	GitHub: "https://api.github.com" for github.com, "{scheme}://{host}/api/v3" for others
+//	GitLab: "{scheme}://{host}/api/v4"
+//	Gitea:  "{scheme}://{host}/api/v1"
+func (r Repository) GetMetadataAPIURL() (string, error) {
+	if r.Spec.Metadata == nil {
+		return "", fmt.Errorf("metadata is not specified")
+	}
+	if r.Spec.Metadata.APIURL != nil {
+		return *r.Spec.Metadata.APIURL, nil
+	}
+	return inferAPIURL(r.Spec.Metadata.Forge, "source", r.Spec.Source.URL)
+}
+
+// GetMetadataImage returns r.Spec.Metadata.Image or DefaultMetadataImage.
+// The image is not defaulted in the spec so that it follows the controller on upgrades.
+func (r Repository) GetMetadataImage() (string, error) {
+	if r.Spec.Metadata == nil {
+		return "", fmt.Errorf("metadata is not specified")
+	}
+	return metadataImage(r.Spec.Metadata.Image)
+}
+
+// GetDestinationForgeProject returns r.Spec.DestinationForge.Project or the path of r.Spec.Destination.URL without ".git" suffix.
+func (r Repository) GetDestinationForgeProject() (string, error) {
+	if r.Spec.DestinationForge != nil && r.Spec.DestinationForge.Project != nil {
+		return *r.Spec.DestinationForge.Project, nil
+	}
+	return inferProject("destination", r.Spec.Destination.URL)
+}
+
+// GetDestinationForgeAPIURL returns r.Spec.DestinationForge.APIURL or the default API URL of the forge inferred from r.Spec.Destination.URL
+// in the same way as GetMetadataAPIURL.
+func (r Repository) GetDestinationForgeAPIURL() (string, error) {
+	if r.Spec.DestinationForge == nil {
+		return "", fmt.Errorf("destinationForge is not specified")
+	}
+	if r.Spec.DestinationForge.APIURL != nil {
+		return *r.Spec.DestinationForge.APIURL, nil
+	}
+	return inferAPIURL(r.Spec.DestinationForge.Forge, "destination", r.Spec.Destination.URL)
+}
+
+// GetDestinationForgeImage returns r.Spec.DestinationForge.Image or DefaultMetadataImage in the same way as GetMetadataImage.
+func (r Repository) GetDestinationForgeImage() (string, error) {
+	if r.Spec.DestinationForge == nil {
+		return "", fmt.Errorf("destinationForge is not specified")
+	}
+	return metadataImage(r.Spec.DestinationForge.Image)
+}
+
+func metadataImage(image *string) (string, error) {
+	if image != nil {
+		return *image, nil
+	}
+	if DefaultMetadataImage == "" {
+		return "", fmt.Errorf("image is not specified and the controller is built without DefaultMetadataImage")
+	}
+	return DefaultMetadataImage, nil
+}
+
+// GetGitImage returns r.Spec.GitImage or DefaultGitImage if it is not specified.
+// The v1beta1 defaulting webhook sets it for v1 requests too, but Repositories created before the webhook
+// was deployed or without webhooks (e.g. in tests) may not have it.
+func (r Repository) GetGitImage() string {
+	if r.Spec.GitImage != nil {
+		return *r.Spec.GitImage
+	}
+	return DefaultGitImage
+}
+
+// GetDeletionPolicy returns r.Spec.DeletionPolicy or DeletionRetain if it is not specified.
+func (r Repository) GetDeletionPolicy() DeletionPolicy {
+	if r.Spec.DeletionPolicy != nil {
+		return *r.Spec.DeletionPolicy
+	}
+	return DeletionRetain
+}
+
+// GetOwnedCleanupJobName returns "gitbackup-{r.Name}-cleanup" truncated to MaxCronJobNameLength by TruncateName.
+func (r Repository) GetOwnedCleanupJobName() string {
+	return TruncateName(strings.Join([]string{OperatorName, r.Name, "cleanup"}, "-"), MaxCronJobNameLength)
+}
+
+// GetOwnedDryRunJobName returns "gitbackup-{r.Name}-dryrun-{id}" truncated to MaxCronJobNameLength by TruncateName.
+func (r Repository) GetOwnedDryRunJobName(id string) string {
+	return TruncateName(strings.Join([]string{OperatorName, r.Name, "dryrun", id}, "-"), MaxCronJobNameLength)
+}
+
+// GetOwnedStateConfigMapName returns "gitbackup-repository-{r.Name}-state"
+func (r Repository) GetOwnedStateConfigMapName() string {
+	return strings.Join([]string{OperatorName, "repository", r.Name, "state"}, "-")
+}
+
+// GetOnDestinationDrift returns r.Spec.OnDestinationDrift or DriftOverwrite if it is not specified.
+func (r Repository) GetOnDestinationDrift() DriftPolicy {
+	if r.Spec.OnDestinationDrift != nil {
+		return *r.Spec.OnDestinationDrift
+	}
+	return DriftOverwrite
+}
+
+// IsDryRun returns true if r.Spec.DryRun is true.
+func (r Repository) IsDryRun() bool {
+	return r.Spec.DryRun != nil && *r.Spec.DryRun
+}
+
+// inferProject returns the path of rawURL without ".git" suffix. what is the name of rawURL used in errors.
+func inferProject(what, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("unable to infer project from %s %s", what, rawURL)
+	}
+	p := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if !strings.Contains(p, "/") {
+		return "", fmt.Errorf("unable to infer project from %s %s", what, rawURL)
+	}
+	return p, nil
+}
+
+// inferAPIURL returns the default API URL of forge inferred from rawURL. what is the name of rawURL used in errors.
+func inferAPIURL(forge ForgeType, what, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", fmt.Errorf("unable to infer API URL from %s %s", what, rawURL)
+	}
+	base := u.Scheme + "://" + u.Host
+	switch forge {
+	case ForgeGitHub:
+		if u.Host == "github.com" {
+			return "https://api.github.com", nil
+		}
+		return base + "/api/v3", nil
+	case ForgeGitLab:
+		return base + "/api/v4", nil
+	case ForgeGitea:
+		return base + "/api/v1", nil
+	}
+	return "", fmt.Errorf("unknown forge %s", forge)
+}
+
+// GitRemote specifies a remote repository and the credentials to access it.
+type GitRemote struct {
+	// URL specifies the repository in URL format.
+	URL string `json:"url"`
+	// Credentials specifies the name of the Secret in the same namespace used to mount .git-credentials for the repository.
+	// Note that "[credential]\nhelper=store" is required in GitConfig.
+	// +optional
+	Credentials *corev1.LocalObjectReference `json:"credentials,omitempty"`
+}
+
+// RepositorySpec defines the desired state of Repository
+type RepositorySpec struct {
+	// Source specifies the repository to backup.
+	Source GitRemote `json:"source"`
+	// Destination specifies the repository to push the backup to.
+	Destination GitRemote `json:"destination"`
+
+	// Schedule in Cron format.
+	Schedule string `json:"schedule"`
+	// TimeZone in TZ database name.
+	// See also: https://kubernetes.io/docs/concepts/workloads/controllers/cron-jobs/#time-zones
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+	// Suspend specifies to stop scheduling backups. Jobs that have already started are not stopped.
+	// +optional
+	Suspend *bool `json:"suspend,omitempty"`
+
+	// BackupClassName specifies the BackupClass to take defaults from. (default: the default BackupClass if exists)
+	// +optional
+	BackupClassName *string `json:"backupClassName,omitempty"`
+
+	// GitImage specifies the container image to run. (default: DefaultGitImage)
+	// +optional
+	GitImage *string `json:"gitImage,omitempty"`
+	// ImagePullSecret specifies the name of the Secret in the same namespace used to pull the GitImage.
+	// +optional
+	ImagePullSecret *corev1.LocalObjectReference `json:"imagePullSecret,omitempty"`
+
+	// GitConfig specifies the name of the ConfigMap in the same namespace used to mount .gitconfig
+	// (default: a ConfigMap created by the controller that enables the credential store)
+	// +optional
+	GitConfig *corev1.LocalObjectReference `json:"gitConfig,omitempty"`
+
+	PodOptions `json:",inline"`
+
+	// JobPolicy specifies how the CronJob runs the backup Jobs.
+	// +optional
+	JobPolicy *JobPolicy `json:"jobPolicy,omitempty"`
+
+	// Refs specifies refs to backup. All refs are mirrored if not specified.
+	// +optional
+	Refs *RefsSpec `json:"refs,omitempty"`
+
+	// Encryption specifies how to encrypt the backup pushed to the destination.
+	// +optional
+	Encryption *EncryptionSpec `json:"encryption,omitempty"`
+
+	// Metadata specifies how to export forge metadata (issues, pull requests, releases, etc.) as JSON.
+	// +optional
+	Metadata *MetadataSpec `json:"metadata,omitempty"`
+
+	// Snapshots specifies to keep the refs of each backup as a snapshot in the destination
+	// so that a Restore can restore the refs as of a point in time.
+	// +optional
+	Snapshots *SnapshotsSpec `json:"snapshots,omitempty"`
+
+	// DeletionPolicy specifies what to do with the backup in the destination when the Repository is deleted. (default: Retain)
+	// +optional
+	DeletionPolicy *DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// DestinationForge specifies the forge API of the destination repository to archive or delete it on deletion.
+	// +optional
+	DestinationForge *DestinationForgeSpec `json:"destinationForge,omitempty"`
+
+	// DryRun specifies that the backup Jobs only compare the refs in the source and the destination
+	// and report the refs that would be created, updated or deleted without pushing.
+	// +optional
+	DryRun *bool `json:"dryRun,omitempty"`
+
+	// OnDestinationDrift specifies what to do if refs in the destination have been changed
+	// by others since the last backup. (default: Overwrite)
+	// +optional
+	OnDestinationDrift *DriftPolicy `json:"onDestinationDrift,omitempty"`
+
+	// Notifications specifies Notifiers to invoke when the results of backups change.
+	// +optional
+	Notifications *NotificationsSpec `json:"notifications,omitempty"`
+
+	// MaxAge specifies how old the latest successful backup can be before the Repository is considered stale.
+	// The controller sets the Stale condition and records a Warning event when it is exceeded
+	// e.g. because the CronJob has stopped scheduling Jobs. Set it longer than the interval of Schedule.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// RefsSpec defines refs to fetch from the source and push to the destination.
+// Patterns are the same as the source side of refspecs e.g. "refs/heads/*".
+// Refs in the destination that match Include but not Exclude are deleted if they are deleted in the source.
+type RefsSpec struct {
+	// Include specifies patterns of refs to backup. (default: ["refs/*"])
+	// +optional
+	Include []string `json:"include,omitempty"`
+	// Exclude specifies patterns of refs not to backup e.g. "refs/pull/*".
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// GetRefspecs returns refspecs generated from r.Spec.Refs e.g. ["+refs/heads/*:refs/heads/*", "^refs/pull/*"]
+// or nil if r.Spec.Refs is not specified.
+func (r Repository) GetRefspecs() []string {
+	if r.Spec.Refs == nil {
+		return nil
+	}
+	include := r.Spec.Refs.Include
+	if len(include) == 0 {
+		include = []string{"refs/*"}
+	}
+	var refspecs []string
+	for _, p := range include {
+		refspecs = append(refspecs, "+"+p+":"+p)
+	}
+	for _, p := range r.Spec.Refs.Exclude {
+		refspecs = append(refspecs, "^"+p)
+	}
+	return refspecs
+}
+
+// EncryptionType is the type of encryption.
+// +kubebuilder:validation:Enum=OpenPGP
+type EncryptionType string
+
+const (
+	// EncryptionOpenPGP pushes to the destination with git-remote-gcrypt so that the destination only stores OpenPGP-encrypted data.
+	// Note that GitImage must contain git-remote-gcrypt and gpg.
+	EncryptionOpenPGP EncryptionType = "OpenPGP"
+)
+
+// EncryptionSpec defines keys to encrypt backups at rest.
+type EncryptionSpec struct {
+	// Type specifies the encryption method. Only OpenPGP is supported as git-remote-gcrypt encrypts with gpg.
+	// Jobs fail without pushing if the keys are not ASCII-armored OpenPGP keys (e.g. age keys).
+	Type EncryptionType `json:"type"`
+	// PublicKey specifies the key of the Secret in the same namespace that contains ASCII-armored public keys of the recipients.
+	PublicKey corev1.SecretKeySelector `json:"publicKey"`
+	// PrivateKey specifies the key of the Secret in the same namespace that contains an ASCII-armored private key.
+	// It is used to sign and to read the encrypted destination on backups, and to decrypt it on restores.
+	PrivateKey corev1.SecretKeySelector `json:"privateKey"`
+}
+
+// ForgeType is the type of the forge that hosts a repository.
+// +kubebuilder:validation:Enum=GitHub;GitLab;Gitea
+type ForgeType string
+
+const (
+	ForgeGitHub ForgeType = "GitHub"
+	ForgeGitLab ForgeType = "GitLab"
+	ForgeGitea  ForgeType = "Gitea"
+)
+
+// MetadataSpec defines how to export forge metadata.
+// The exported JSON files are committed to `Ref` and pushed to the destination repository together with the mirror.
+type MetadataSpec struct {
+	// Forge specifies the type of the forge that hosts the source repository.
+	Forge ForgeType `json:"forge"`
+	// APIURL specifies the base URL of the forge API. (default: inferred from `Source`)
+	// +optional
+	APIURL *string `json:"apiURL,omitempty"`
+	// Project specifies the path of the project on the forge e.g. "owner/name". (default: inferred from `Source`)
+	// +optional
+	Project *string `json:"project,omitempty"`
+	// Token specifies the key of the Secret in the same namespace that contains an API token.
+	// +optional
+	Token *corev1.SecretKeySelector `json:"token,omitempty"`
+
+	// Ref specifies the ref in the destination repository to commit the metadata to.
+	// It must be under "refs/gitbackup/" and not under the snapshots, drift or state refs. (default: "refs/gitbackup/metadata")
+	// +optional
+	Ref *string `json:"ref,omitempty"`
+	// Image specifies the container image to export metadata. (default: the controller image)
+	// +optional
+	Image *string `json:"image,omitempty"`
+}
+
+// SnapshotsSpec defines how to keep snapshots.
+// Snapshots are refs under SnapshotsRef so note that the number of refs grows with every backup.
+type SnapshotsSpec struct {
+	// Keep specifies the number of the latest snapshots to keep. All snapshots are kept if not specified.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Keep *int32 `json:"keep,omitempty"`
+}
+
+// DeletionPolicy is what to do with the backup when the Repository is deleted.
+// +kubebuilder:validation:Enum=Retain;Delete;Archive
+type DeletionPolicy string
+
+const (
+	// DeletionRetain keeps the backup.
+	DeletionRetain DeletionPolicy = "Retain"
+	// DeletionDelete deletes the destination repository via the forge API if DestinationForge is specified.
+	// Otherwise, it deletes all refs in the destination including snapshots and metadata with git,
+	// except the default branch that forges refuse to delete.
+	DeletionDelete DeletionPolicy = "Delete"
+	// DeletionArchive archives the destination repository via the forge API. DestinationForge is required.
+	DeletionArchive DeletionPolicy = "Archive"
+)
+
+// DriftPolicy is what to do with refs in the destination that have been changed since the last backup.
+// +kubebuilder:validation:Enum=Overwrite;Fail;PreserveUnderRef
+type DriftPolicy string
+
+const (
+	// DriftOverwrite pushes without checking the destination.
+	DriftOverwrite DriftPolicy = "Overwrite"
+	// DriftFail fails the backup Job without pushing.
+	DriftFail DriftPolicy = "Fail"
+	// DriftPreserveUnderRef saves the changed refs whose commits would be discarded by the push
+	// under "refs/gitbackup/drift/{ID}/" and then pushes. IDs are in the same format as snapshot IDs.
+	DriftPreserveUnderRef DriftPolicy = "PreserveUnderRef"
+)
+
+// NotificationsSpec defines when to invoke which Notifiers.
+// Notifications are sent when a backup fails after a succeeded one (or the first backup fails)
+// and when a backup succeeds after a failed one.
+type NotificationsSpec struct {
+	// Notifiers specifies the names of the Notifiers in the same namespace.
+	// +kubebuilder:validation:MinItems=1
+	Notifiers []corev1.LocalObjectReference `json:"notifiers"`
+	// ConsecutiveFailures additionally notifies when backups fail this number of times in a row.
+	// +kubebuilder:validation:Minimum=2
+	// +optional
+	ConsecutiveFailures *int32 `json:"consecutiveFailures,omitempty"`
+}
+
+// DestinationForgeSpec defines the forge API of the destination repository.
+type DestinationForgeSpec struct {
+	// Forge specifies the type of the forge that hosts the destination repository.
+	Forge ForgeType `json:"forge"`
+	// APIURL specifies the base URL of the forge API. (default: inferred from `Destination`)
+	// +optional
+	APIURL *string `json:"apiURL,omitempty"`
+	// Project specifies the path of the project on the forge e.g. "owner/name". (default: inferred from `Destination`)
+	// +optional
+	Project *string `json:"project,omitempty"`
+	// Token specifies the key of the Secret in the same namespace that contains an API token
+	// with the permission to archive or delete the project.
+	Token corev1.SecretKeySelector `json:"token"`
+	// Image specifies the container image to call the forge API. (default: the controller image)
+	// +optional
+	Image *string `json:"image,omitempty"`
+}
+
+// PodOptions specifies the pod of the backup Jobs.
+type PodOptions struct {
+	// Resources specifies the compute resources of the containers.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// NodeSelector specifies the node selector of the pod.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations specifies the tolerations of the pod.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity specifies the scheduling constraints of the pod.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// ServiceAccountName specifies the ServiceAccount in the same namespace to run the pod.
+	// +optional
+	ServiceAccountName *string `json:"serviceAccountName,omitempty"`
+	// PriorityClassName specifies the PriorityClass of the pod.
+	// +optional
+	PriorityClassName *string `json:"priorityClassName,omitempty"`
+	// PodSecurityContext specifies the security context of the pod.
+	// (default: run as user 65532 with the RuntimeDefault seccomp profile)
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// SecurityContext specifies the security context of the containers.
+	// (default: read-only root filesystem, no privilege escalation and no capabilities)
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+}
+
+// JobPolicy specifies the CronJob and Job settings of backups.
+type JobPolicy struct {
+	// BackoffLimit specifies the number of retries before marking the Job failed. (default: 6)
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// ActiveDeadlineSeconds specifies the duration in seconds a Job may run before it is terminated.
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// TTLSecondsAfterFinished specifies the duration in seconds to keep finished Jobs. (default: 360000)
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// SuccessfulJobsHistoryLimit specifies the number of successful Jobs to keep. (default: 3)
+	// +optional
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// FailedJobsHistoryLimit specifies the number of failed Jobs to keep. (default: 1)
+	// +optional
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+	// ConcurrencyPolicy specifies how to treat a Job that starts while the previous one is running. (default: Replace)
+	// +optional
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	ConcurrencyPolicy *batchv1.ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+	// StartingDeadlineSeconds specifies the deadline in seconds to start a Job that missed its scheduled time. (default: 14400)
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+	// Retry specifies how to retry git commands that fail with transient errors (DNS, connection and 5xx errors) in a Job.
+	// +optional
+	Retry *RetryPolicy `json:"retry,omitempty"`
+}
+
+// RetryPolicy specifies retries with exponential backoff in a backup Job.
+type RetryPolicy struct {
+	// Attempts specifies the maximum number of attempts of each git command. 1 disables retries. (default: 3)
+	// +optional
+	Attempts *int32 `json:"attempts,omitempty"`
+	// InitialDelaySeconds specifies the delay before the first retry. The delay doubles on each retry. (default: 10)
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+	// MaxDelaySeconds specifies the maximum delay between retries. (default: 300)
+	// +optional
+	MaxDelaySeconds *int32 `json:"maxDelaySeconds,omitempty"`
+}
+
+const (
+	// ConditionReferencesResolved is True if all Secrets and ConfigMaps the Repository refers to exist.
+	ConditionReferencesResolved = "ReferencesResolved"
+
+	// ReferencesHashAnnotation is set to the pod template of the CronJob with a hash of the contents of
+	// the Secrets and ConfigMaps the Repository refers to.
+	ReferencesHashAnnotation = "gitbackup.ebiiim.com/references-hash"
+
+	// CleanupFinalizer is set to Repositories whose DeletionPolicy is not Retain
+	// and removed when the cleanup Job succeeds.
+	CleanupFinalizer = "gitbackup.ebiiim.com/cleanup"
+	// ConditionCleanedUp is set while the Repository is being deleted. It is True when the cleanup Job succeeded.
+	ConditionCleanedUp = "CleanedUp"
+
+	// ConditionStale is set if MaxAge is specified. It is True if no backup has succeeded within MaxAge.
+	ConditionStale = "Stale"
+
+	// DryRunAnnotation requests a one-off dry-run Job when it is set to a Repository.
+	// The controller creates the Job and removes the annotation.
+	DryRunAnnotation = "gitbackup.ebiiim.com/dry-run"
+	// DryRunLabel is set to "true" on dry-run Jobs.
+	DryRunLabel = "gitbackup.ebiiim.com/dry-run"
+	// StartedEventAnnotation is set to "true" on backup Jobs whose started CloudEvent has been published.
+	StartedEventAnnotation = "gitbackup.ebiiim.com/started-event"
+)
+
+// RunResult is the result of a backup Job.
+type RunResult string
+
+const (
+	RunSucceeded RunResult = "Succeeded"
+	RunFailed    RunResult = "Failed"
+)
+
+// FailureReason is the classified reason of a failed backup Job.
+type FailureReason string
+
+const (
+	// FailureTransient is a DNS, connection or 5xx error that remained after retries.
+	FailureTransient FailureReason = "Transient"
+	// FailureAuth is an authentication or authorization error.
+	FailureAuth FailureReason = "Auth"
+	// FailureNotFound is a repository that does not exist.
+	FailureNotFound FailureReason = "NotFound"
+	// FailureDrift is refs in the destination changed by others with OnDestinationDrift Fail.
+	FailureDrift FailureReason = "Drift"
+	// FailurePolicy is a git config that rewrites URLs in a namespace whose URLs are restricted by BackupPolicies.
+	FailurePolicy FailureReason = "Policy"
+	// FailureUnknown is any other error e.g. the Job exceeded its deadline.
+	FailureUnknown FailureReason = "Unknown"
+)
+
+// RunStatus is the result of a finished backup Job.
+type RunStatus struct {
+	// JobName is the name of the Job.
+	JobName string `json:"jobName"`
+	// Result is Succeeded or Failed.
+	Result RunResult `json:"result"`
+	// CompletionTime is when the Job succeeded or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Attempts is the largest number of attempts of a git command in the Job. 1 means no retries.
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+	// Reason is the classified reason of the failure.
+	// +optional
+	Reason FailureReason `json:"reason,omitempty"`
+	// Message is the last error message of the failure.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Duration is how long the Job ran.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// Stats is the statistics of the backup reported by a succeeded backup Job.
+	// +optional
+	Stats *RunStats `json:"stats,omitempty"`
+	// RefsDigest is the SHA-256 digest of the list of refs pushed to "refs/gitbackup/state".
+	// It is recorded if OnDestinationDrift is not Overwrite to detect changes by others on the next backup.
+	// +optional
+	RefsDigest string `json:"refsDigest,omitempty"`
+	// DryRun is the difference between the source and the destination found by a dry-run Job.
+	// +optional
+	DryRun *DryRunResult `json:"dryRun,omitempty"`
+}
+
+// RunStats is the statistics of the backup pushed by a backup Job.
+type RunStats struct {
+	// Refs is the number of refs pushed to the destination except the ones used by gitbackup itself.
+	Refs int32 `json:"refs"`
+	// DefaultBranch is the default branch of the source.
+	// +optional
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+	// HeadCommit is the commit of the default branch.
+	// +optional
+	HeadCommit string `json:"headCommit,omitempty"`
+	// Size is the total size of the objects in the backup.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+}
+
+// RefChangeType is how a ref in the destination would be changed by a backup.
+// +kubebuilder:validation:Enum=Created;Updated;Deleted
+type RefChangeType string
+
+const (
+	RefCreated RefChangeType = "Created"
+	RefUpdated RefChangeType = "Updated"
+	RefDeleted RefChangeType = "Deleted"
+)
+
+// RefChange is a ref in the destination that would be changed by a backup.
+type RefChange struct {
+	// Type is Created, Updated or Deleted.
+	Type RefChangeType `json:"type"`
+	// Ref is the name of the ref e.g. "refs/heads/main".
+	Ref string `json:"ref"`
+}
+
+// DryRunResult is the number of refs that would be changed in the destination by a backup.
+// Refs used by gitbackup itself (refs/gitbackup/*) are not compared.
+type DryRunResult struct {
+	Created int32 `json:"created"`
+	Updated int32 `json:"updated"`
+	Deleted int32 `json:"deleted"`
+	// Changes lists the first changed refs in name order. See the logs of the Job for all changes.
+	// +optional
+	Changes []RefChange `json:"changes,omitempty"`
+}
+
+// RepositoryStatus defines the observed state of Repository
+type RepositoryStatus struct {
+	// Conditions represent the latest available observations of the Repository.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// LastRun is the result of the latest finished backup Job.
+	// +optional
+	LastRun *RunStatus `json:"lastRun,omitempty"`
+	// LastSuccessTime is when the latest succeeded backup Job finished.
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+	// LastDryRun is the result of the latest finished dry-run Job.
+	// +optional
+	LastDryRun *RunStatus `json:"lastDryRun,omitempty"`
+	// ConsecutiveFailures is the number of backup Jobs that have failed in a row.
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:resource:shortName=repo;repos,categories=gitbackup
+//+kubebuilder:printcolumn:name="Src",type=string,JSONPath=`.spec.source.url`
+//+kubebuilder:printcolumn:name="Dst",type=string,JSONPath=`.spec.destination.url`
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Suspended",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="Last Success",type=date,JSONPath=`.status.lastSuccessTime`
+//+kubebuilder:printcolumn:name="Last Result",type=string,JSONPath=`.status.lastRun.result`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+//+kubebuilder:printcolumn:name="Commit",type=string,JSONPath=`.status.lastRun.stats.headCommit`,priority=1
+//+kubebuilder:printcolumn:name="Size",type=string,JSONPath=`.status.lastRun.stats.size`,priority=1
+
+// Repository is the Schema for the repositories API
+type Repository struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RepositorySpec   `json:"spec,omitempty"`
+	Status RepositoryStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RepositoryList contains a list of Repository
+type RepositoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Repository `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Repository{}, &RepositoryList{})
+}
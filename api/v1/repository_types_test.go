@@ -0,0 +1,232 @@
+package v1_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+func TestRepository_GetOwnedConfigMapName(t *testing.T) {
+	type fields struct {
+		TypeMeta   metav1.TypeMeta
+		ObjectMeta metav1.ObjectMeta
+		Spec       v1.RepositorySpec
+		Status     v1.RepositoryStatus
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   string
+	}{
+		{"a", fields{ObjectMeta: metav1.ObjectMeta{Name: "a"}}, "gitbackup-repository-a-gitconfig"},
+		{"b-c", fields{ObjectMeta: metav1.ObjectMeta{Name: "b-c"}}, "gitbackup-repository-b-c-gitconfig"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1.Repository{
+				TypeMeta:   tt.fields.TypeMeta,
+				ObjectMeta: tt.fields.ObjectMeta,
+				Spec:       tt.fields.Spec,
+				Status:     tt.fields.Status,
+			}
+			if got := r.GetOwnedConfigMapName(); got != tt.want {
+				t.Errorf("Repository.GetOwnedConfigMapName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_GetOwnedCronJobName(t *testing.T) {
+	type fields struct {
+		TypeMeta   metav1.TypeMeta
+		ObjectMeta metav1.ObjectMeta
+		Spec       v1.RepositorySpec
+		Status     v1.RepositoryStatus
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		want   string
+	}{
+		{"a", fields{ObjectMeta: metav1.ObjectMeta{Name: "a"}}, "gitbackup-a"},
+		{"b-c", fields{ObjectMeta: metav1.ObjectMeta{Name: "b-c"}}, "gitbackup-b-c"},
+		{"long", fields{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 50)}}, "gitbackup-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-dc66fb31"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1.Repository{
+				TypeMeta:   tt.fields.TypeMeta,
+				ObjectMeta: tt.fields.ObjectMeta,
+				Spec:       tt.fields.Spec,
+				Status:     tt.fields.Status,
+			}
+			if got := r.GetOwnedCronJobName(); got != tt.want {
+				t.Errorf("Repository.GetOwnedCronJobName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_GetMetadataProject(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    v1.RepositorySpec
+		want    string
+		wantErr bool
+	}{
+		{"https", v1.RepositorySpec{Source: v1.GitRemote{URL: "https://github.com/ebiiim/gitbackup"}}, "ebiiim/gitbackup", false},
+		{"https .git", v1.RepositorySpec{Source: v1.GitRemote{URL: "https://gitlab.com/group/sub/repo.git"}}, "group/sub/repo", false},
+		{"specified", v1.RepositorySpec{Source: v1.GitRemote{URL: "git@github.com:foo/bar"}, Metadata: &v1.MetadataSpec{Project: pointer.String("foo/bar")}}, "foo/bar", false},
+		{"scp-like", v1.RepositorySpec{Source: v1.GitRemote{URL: "git@github.com:foo/bar"}}, "", true},
+		{"no owner", v1.RepositorySpec{Source: v1.GitRemote{URL: "https://example.com/foo"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1.Repository{Spec: tt.spec}
+			got, err := r.GetMetadataProject()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Repository.GetMetadataProject() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Repository.GetMetadataProject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_GetMetadataAPIURL(t *testing.T) {
+	md := func(f v1.ForgeType) *v1.MetadataSpec { return &v1.MetadataSpec{Forge: f} }
+	tests := []struct {
+		name    string
+		spec    v1.RepositorySpec
+		want    string
+		wantErr bool
+	}{
+		{"github.com", v1.RepositorySpec{Source: v1.GitRemote{URL: "https://github.com/a/b"}, Metadata: md(v1.ForgeGitHub)}, "https://api.github.com", false},
+		{"GHES", v1.RepositorySpec{Source: v1.GitRemote{URL: "https://ghe.example.com/a/b"}, Metadata: md(v1.ForgeGitHub)}, "https://ghe.example.com/api/v3", false},
+		{"GitLab", v1.RepositorySpec{Source: v1.GitRemote{URL: "https://gitlab.com/a/b"}, Metadata: md(v1.ForgeGitLab)}, "https://gitlab.com/api/v4", false},
+		{"Gitea", v1.RepositorySpec{Source: v1.GitRemote{URL: "http://gitea.local:3000/a/b"}, Metadata: md(v1.ForgeGitea)}, "http://gitea.local:3000/api/v1", false},
+		{"specified", v1.RepositorySpec{Source: v1.GitRemote{URL: "git@example.com:a/b"}, Metadata: &v1.MetadataSpec{Forge: v1.ForgeGitea, APIURL: pointer.String("https://example.com/api/v1")}}, "https://example.com/api/v1", false},
+		{"ssh", v1.RepositorySpec{Source: v1.GitRemote{URL: "ssh://git@example.com/a/b"}, Metadata: md(v1.ForgeGitHub)}, "", true},
+		{"unknown forge", v1.RepositorySpec{Source: v1.GitRemote{URL: "https://example.com/a/b"}, Metadata: md("Foo")}, "", true},
+		{"no metadata", v1.RepositorySpec{Source: v1.GitRemote{URL: "https://example.com/a/b"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1.Repository{Spec: tt.spec}
+			got, err := r.GetMetadataAPIURL()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Repository.GetMetadataAPIURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Repository.GetMetadataAPIURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_GetMetadataImage(t *testing.T) {
+	defer func(s string) { v1.DefaultMetadataImage = s }(v1.DefaultMetadataImage)
+	tests := []struct {
+		name         string
+		defaultImage string
+		spec         v1.RepositorySpec
+		want         string
+		wantErr      bool
+	}{
+		{"default", "controller:v1", v1.RepositorySpec{Metadata: &v1.MetadataSpec{}}, "controller:v1", false},
+		{"specified", "controller:v1", v1.RepositorySpec{Metadata: &v1.MetadataSpec{Image: pointer.String("exporter:v2")}}, "exporter:v2", false},
+		{"specified without default", "", v1.RepositorySpec{Metadata: &v1.MetadataSpec{Image: pointer.String("exporter:v2")}}, "exporter:v2", false},
+		{"no default", "", v1.RepositorySpec{Metadata: &v1.MetadataSpec{}}, "", true},
+		{"no metadata", "controller:v1", v1.RepositorySpec{}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v1.DefaultMetadataImage = tt.defaultImage
+			r := v1.Repository{Spec: tt.spec}
+			got, err := r.GetMetadataImage()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Repository.GetMetadataImage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Repository.GetMetadataImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_GetDestinationForge(t *testing.T) {
+	f := func(forge v1.ForgeType) *v1.DestinationForgeSpec {
+		return &v1.DestinationForgeSpec{Forge: forge}
+	}
+	tests := []struct {
+		name        string
+		spec        v1.RepositorySpec
+		wantProject string
+		wantAPIURL  string
+		wantErr     bool
+	}{
+		{"github.com", v1.RepositorySpec{Destination: v1.GitRemote{URL: "https://github.com/a/b.git"}, DestinationForge: f(v1.ForgeGitHub)}, "a/b", "https://api.github.com", false},
+		{"GitLab", v1.RepositorySpec{Destination: v1.GitRemote{URL: "https://gitlab.example.com/g/a/b"}, DestinationForge: f(v1.ForgeGitLab)}, "g/a/b", "https://gitlab.example.com/api/v4", false},
+		{"specified", v1.RepositorySpec{Destination: v1.GitRemote{URL: "git@example.com:a/b"}, DestinationForge: &v1.DestinationForgeSpec{
+			Forge: v1.ForgeGitea, APIURL: pointer.String("https://example.com/api/v1"), Project: pointer.String("a/b")}}, "a/b", "https://example.com/api/v1", false},
+		{"scp-like", v1.RepositorySpec{Destination: v1.GitRemote{URL: "git@example.com:a/b"}, DestinationForge: f(v1.ForgeGitHub)}, "", "", true},
+		{"no forge", v1.RepositorySpec{Destination: v1.GitRemote{URL: "https://github.com/a/b"}}, "a/b", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1.Repository{Spec: tt.spec}
+			project, err1 := r.GetDestinationForgeProject()
+			apiURL, err2 := r.GetDestinationForgeAPIURL()
+			if gotErr := err1 != nil || err2 != nil; gotErr != tt.wantErr {
+				t.Errorf("Repository.GetDestinationForge*() error = %v %v, wantErr %v", err1, err2, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if project != tt.wantProject || apiURL != tt.wantAPIURL {
+				t.Errorf("Repository.GetDestinationForge*() = %v %v, want %v %v", project, apiURL, tt.wantProject, tt.wantAPIURL)
+			}
+		})
+	}
+}
+
+func TestRepository_GetRefspecs(t *testing.T) {
+	tests := []struct {
+		name string
+		refs *v1.RefsSpec
+		want []string
+	}{
+		{"nil", nil, nil},
+		{"include", &v1.RefsSpec{Include: []string{"refs/heads/*", "refs/tags/*"}}, []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}},
+		{"exclude", &v1.RefsSpec{Exclude: []string{"refs/pull/*"}}, []string{"+refs/*:refs/*", "^refs/pull/*"}},
+		{"both", &v1.RefsSpec{Include: []string{"refs/heads/*"}, Exclude: []string{"refs/heads/tmp-*"}}, []string{"+refs/heads/*:refs/heads/*", "^refs/heads/tmp-*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1.Repository{Spec: v1.RepositorySpec{Refs: tt.refs}}
+			if got := r.GetRefspecs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Repository.GetRefspecs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_GetGitImage(t *testing.T) {
+	if got := (v1.Repository{}).GetGitImage(); got != v1.DefaultGitImage {
+		t.Errorf("Repository.GetGitImage() = %v, want %v", got, v1.DefaultGitImage)
+	}
+	r := v1.Repository{Spec: v1.RepositorySpec{GitImage: pointer.String("example.com/git:2.40")}}
+	if got := r.GetGitImage(); got != "example.com/git:2.40" {
+		t.Errorf("Repository.GetGitImage() = %v, want example.com/git:2.40", got)
+	}
+}
@@ -0,0 +1,13 @@
+package v1
+
+import (
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// SetupWebhookWithManager registers the conversion webhook.
+// Defaulting and validation are done by the v1beta1 webhooks as they also match v1 requests.
+func (r *Repository) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
@@ -0,0 +1,126 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// BackupClassDefaultAnnotation marks a BackupClass as the default when set to "true".
+	// The default BackupClass is used by resources that do not specify `BackupClassName`.
+	BackupClassDefaultAnnotation = "gitbackup.ebiiim.com/is-default-class"
+)
+
+// IsDefault returns true if r has BackupClassDefaultAnnotation.
+func (r BackupClass) IsDefault() bool {
+	return r.Annotations[BackupClassDefaultAnnotation] == "true"
+}
+
+// BackupClassSpec defines the desired state of BackupClass
+// All fields are used as defaults of Repositories and Collections that use the BackupClass.
+// Names of resources refer to the ones in the namespace of each Repository or Collection.
+type BackupClassSpec struct {
+	// TimeZone in TZ database name.
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// GitImage specifies the container image to run.
+	// +optional
+	GitImage *string `json:"gitImage,omitempty"`
+	// ImagePullSecret specifies the name of the Secret used to pull the GitImage.
+	// +optional
+	ImagePullSecret *corev1.LocalObjectReference `json:"imagePullSecret,omitempty"`
+
+	// GitConfig specifies the name of the configmap resource used to mount .git-config
+	// +optional
+	GitConfig *corev1.LocalObjectReference `json:"gitConfig,omitempty"`
+	// GitCredentials specifies the name of the Secret used to mount .git-credentials
+	// +optional
+	GitCredentials *corev1.LocalObjectReference `json:"gitCredentials,omitempty"`
+
+	// PodOptions specifies the resources, the scheduling and the security settings of backup pods.
+	// Each field is used if it is not specified in the Repository or the Collection.
+	PodOptions `json:",inline"`
+
+	// JobPolicy specifies the CronJob and Job settings of backups.
+	// It is used as a whole if it is not specified in the Repository or the Collection.
+	// +optional
+	JobPolicy *JobPolicy `json:"jobPolicy,omitempty"`
+}
+
+// fill sets unspecified fields from s.
+func (s BackupClassSpec) fill(timeZone, gitImage **string, imagePullSecret, gitConfig, gitCredentials **corev1.LocalObjectReference,
+	podOptions *PodOptions, jobPolicy **JobPolicy) {
+	s = *s.DeepCopy()
+	if *timeZone == nil {
+		*timeZone = s.TimeZone
+	}
+	if *gitImage == nil {
+		*gitImage = s.GitImage
+	}
+	if *imagePullSecret == nil {
+		*imagePullSecret = s.ImagePullSecret
+	}
+	if *gitConfig == nil {
+		*gitConfig = s.GitConfig
+	}
+	if *gitCredentials == nil {
+		*gitCredentials = s.GitCredentials
+	}
+	s.PodOptions.fill(podOptions)
+	if *jobPolicy == nil {
+		*jobPolicy = s.JobPolicy
+	}
+}
+
+// fill sets unspecified fields of o from p.
+func (p PodOptions) fill(o *PodOptions) {
+	if o.Resources == nil {
+		o.Resources = p.Resources
+	}
+	if o.NodeSelector == nil {
+		o.NodeSelector = p.NodeSelector
+	}
+	if o.Tolerations == nil {
+		o.Tolerations = p.Tolerations
+	}
+	if o.Affinity == nil {
+		o.Affinity = p.Affinity
+	}
+	if o.ServiceAccountName == nil {
+		o.ServiceAccountName = p.ServiceAccountName
+	}
+	if o.PriorityClassName == nil {
+		o.PriorityClassName = p.PriorityClassName
+	}
+	if o.PodSecurityContext == nil {
+		o.PodSecurityContext = p.PodSecurityContext
+	}
+	if o.SecurityContext == nil {
+		o.SecurityContext = p.SecurityContext
+	}
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// BackupClass is the Schema for the backupclasses API
+type BackupClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BackupClassSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BackupClassList contains a list of BackupClass
+type BackupClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BackupClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BackupClass{}, &BackupClassList{})
+}
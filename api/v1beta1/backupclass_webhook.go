@@ -0,0 +1,78 @@
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=backupclasses,verbs=get;list;watch
+
+// GetBackupClass returns the BackupClass named name, or the default BackupClass if name is nil.
+// It returns nil if name is nil and there is no default BackupClass.
+// If there are multiple default BackupClasses, the newest one is returned.
+func GetBackupClass(ctx context.Context, c client.Reader, name *string) (*BackupClass, error) {
+	if name != nil {
+		var cls BackupClass
+		if err := c.Get(ctx, client.ObjectKey{Name: *name}, &cls); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("BackupClass %s not found", *name)
+			}
+			return nil, err
+		}
+		return &cls, nil
+	}
+
+	var clss BackupClassList
+	if err := c.List(ctx, &clss); err != nil {
+		return nil, err
+	}
+	var def *BackupClass
+	for i, cls := range clss.Items {
+		if !cls.IsDefault() {
+			continue
+		}
+		if def == nil || def.CreationTimestamp.Before(&cls.CreationTimestamp) ||
+			(def.CreationTimestamp.Equal(&cls.CreationTimestamp) && def.Name < cls.Name) {
+			def = &clss.Items[i]
+		}
+	}
+	return def, nil
+}
+
+// backupClassUser is implemented by types that take defaults from a BackupClass.
+type backupClassUser interface {
+	runtime.Object
+	Default()
+	getBackupClassName() *string
+	applyBackupClass(cls BackupClass)
+}
+
+// backupClassDefaulter fills unspecified fields of a backupClassUser from its BackupClass,
+// and then calls Default() for the built-in defaults.
+type backupClassDefaulter struct {
+	client.Reader
+}
+
+var _ admission.CustomDefaulter = &backupClassDefaulter{}
+
+// Default implements admission.CustomDefaulter.
+func (d *backupClassDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	u, ok := obj.(backupClassUser)
+	if !ok {
+		return fmt.Errorf("unexpected type %T", obj)
+	}
+	cls, err := GetBackupClass(ctx, d.Reader, u.getBackupClassName())
+	if err != nil {
+		return err
+	}
+	if cls != nil {
+		u.applyBackupClass(*cls)
+	}
+	u.Default()
+	return nil
+}
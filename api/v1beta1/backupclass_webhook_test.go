@@ -0,0 +1,96 @@
+package v1beta1
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetBackupClass(t *testing.T) {
+	now := time.Now()
+	class := func(name string, isDefault bool, created time.Time) *BackupClass {
+		cls := &BackupClass{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)}}
+		if isDefault {
+			cls.Annotations = map[string]string{BackupClassDefaultAnnotation: "true"}
+		}
+		return cls
+	}
+
+	tests := []struct {
+		name    string
+		classes []runtime.Object
+		arg     *string
+		want    string
+		wantErr bool
+	}{
+		{"named", []runtime.Object{class("a", false, now), class("b", true, now)}, pointer.String("a"), "a", false},
+		{"not found", []runtime.Object{class("a", false, now)}, pointer.String("b"), "", true},
+		{"default", []runtime.Object{class("a", false, now), class("b", true, now)}, nil, "b", false},
+		{"no default", []runtime.Object{class("a", false, now)}, nil, "", false},
+		{"newest default", []runtime.Object{class("a", true, now), class("b", true, now.Add(-time.Hour))}, nil, "a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = AddToScheme(scheme)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(tt.classes...).Build()
+
+			got, err := GetBackupClass(context.Background(), c, tt.arg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetBackupClass() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var gotName string
+			if got != nil {
+				gotName = got.Name
+			}
+			if gotName != tt.want {
+				t.Errorf("GetBackupClass() = %v, want %v", gotName, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackupClassSpec_fill(t *testing.T) {
+	cls := BackupClassSpec{
+		TimeZone:       pointer.String("Asia/Tokyo"),
+		GitCredentials: &corev1.LocalObjectReference{Name: "class-credentials"},
+		PodOptions: PodOptions{
+			Resources:          &corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")}},
+			NodeSelector:       map[string]string{"kubernetes.io/arch": "amd64"},
+			ServiceAccountName: pointer.String("class-sa"),
+		},
+		JobPolicy: &JobPolicy{BackoffLimit: pointer.Int32(2)},
+	}
+	spec := RepositorySpec{
+		GitCredentials: &corev1.LocalObjectReference{Name: "repo-credentials"},
+		PodOptions:     PodOptions{ServiceAccountName: pointer.String("repo-sa")},
+	}
+	want := RepositorySpec{
+		TimeZone:       cls.TimeZone,
+		GitCredentials: spec.GitCredentials,
+		PodOptions: PodOptions{
+			Resources:          cls.Resources,
+			NodeSelector:       cls.NodeSelector,
+			ServiceAccountName: pointer.String("repo-sa"),
+		},
+		JobPolicy: cls.JobPolicy,
+	}
+	cls.fill(&spec.TimeZone, &spec.GitImage, &spec.ImagePullSecret, &spec.GitConfig, &spec.GitCredentials, &spec.PodOptions, &spec.JobPolicy)
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("fill() = %+v, want %+v", spec, want)
+	}
+	// the BackupClass is copied so that changing the Repository does not change it
+	spec.NodeSelector["kubernetes.io/arch"] = "arm64"
+	if cls.NodeSelector["kubernetes.io/arch"] != "amd64" {
+		t.Errorf("fill() changed the BackupClass: %v", cls.NodeSelector)
+	}
+}
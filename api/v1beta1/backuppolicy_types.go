@@ -0,0 +1,186 @@
+package v1beta1
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// BackupPolicySpec defines the desired state of BackupPolicy
+type BackupPolicySpec struct {
+	// NamespaceSelector selects the namespaces the policy applies to. The policy applies to all namespaces if not specified.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Sources specifies the allowed source repositories.
+	// Sources are not restricted by this policy if empty.
+	// +optional
+	Sources []URLRule `json:"sources,omitempty"`
+	// Destinations specifies the allowed destination repositories.
+	// Destinations are not restricted by this policy if empty.
+	// +optional
+	Destinations []URLRule `json:"destinations,omitempty"`
+}
+
+// URLRule matches repository URLs. A URL matches the rule if it matches all specified fields.
+// scp-like URLs e.g. "git@github.com:foo/bar" are treated as "ssh".
+type URLRule struct {
+	// Schemes specifies the allowed schemes e.g. "https", "ssh". All schemes are allowed if empty.
+	// +optional
+	Schemes []string `json:"schemes,omitempty"`
+	// Hosts specifies the allowed hosts in path.Match patterns e.g. "github.com", "*.example.com".
+	// All hosts are allowed if empty.
+	// +optional
+	Hosts []string `json:"hosts,omitempty"`
+	// Paths specifies the allowed paths in path.Match patterns e.g. "/foo/*". All paths are allowed if empty.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+}
+
+// matches tests if u matches r.
+func (r URLRule) matches(u gitURL) bool {
+	return matchAny(r.Schemes, u.Scheme) && matchAny(r.Hosts, strings.ToLower(u.Host)) && matchAny(r.Paths, u.Path)
+}
+
+// String returns r in a human readable form.
+func (r URLRule) String() string {
+	var ss []string
+	if len(r.Schemes) != 0 {
+		ss = append(ss, "schemes="+strings.Join(r.Schemes, ","))
+	}
+	if len(r.Hosts) != 0 {
+		ss = append(ss, "hosts="+strings.Join(r.Hosts, ","))
+	}
+	if len(r.Paths) != 0 {
+		ss = append(ss, "paths="+strings.Join(r.Paths, ","))
+	}
+	if len(ss) == 0 {
+		return "any"
+	}
+	return strings.Join(ss, " ")
+}
+
+// matchAny tests if s matches any of patterns. It returns true if patterns is empty.
+func matchAny(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliesTo tests if the policy applies to a namespace with nsLabels.
+func (r BackupPolicy) AppliesTo(nsLabels map[string]string) (bool, error) {
+	if r.Spec.NamespaceSelector == nil {
+		return true, nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(r.Spec.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	return sel.Matches(labels.Set(nsLabels)), nil
+}
+
+// RestrictsURLs tests if any of policies that apply to a namespace with nsLabels restricts sources or destinations.
+func RestrictsURLs(policies []BackupPolicy, nsLabels map[string]string) (bool, error) {
+	for _, p := range policies {
+		ok, err := p.AppliesTo(nsLabels)
+		if err != nil {
+			return false, fmt.Errorf("BackupPolicy %s has invalid namespaceSelector: %w", p.Name, err)
+		}
+		if ok && (len(p.Spec.Sources) != 0 || len(p.Spec.Destinations) != 0) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CheckBackupPolicies tests if srcs and dsts are allowed by policies that apply to a namespace with nsLabels.
+// A URL is allowed if no applicable policy restricts it, or if it matches any rule of the applicable policies that restrict it.
+func CheckBackupPolicies(policies []BackupPolicy, nsLabels map[string]string, srcs, dsts []string) error {
+	var srcRules, dstRules []URLRule
+	var srcPolicies, dstPolicies []string
+	for _, p := range policies {
+		ok, err := p.AppliesTo(nsLabels)
+		if err != nil {
+			return fmt.Errorf("BackupPolicy %s has invalid namespaceSelector: %w", p.Name, err)
+		}
+		if !ok {
+			continue
+		}
+		if len(p.Spec.Sources) != 0 {
+			srcRules = append(srcRules, p.Spec.Sources...)
+			srcPolicies = append(srcPolicies, p.Name)
+		}
+		if len(p.Spec.Destinations) != 0 {
+			dstRules = append(dstRules, p.Spec.Destinations...)
+			dstPolicies = append(dstPolicies, p.Name)
+		}
+	}
+	if err := checkURLRules("src", srcs, srcRules, srcPolicies); err != nil {
+		return err
+	}
+	if err := checkURLRules("dst", dsts, dstRules, dstPolicies); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkURLRules(kind string, urls []string, rules []URLRule, policies []string) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	for _, s := range urls {
+		u, err := parseGitURL(s)
+		if err != nil {
+			return fmt.Errorf("%s %s is not allowed by BackupPolicy %s: %w", kind, s, strings.Join(policies, ","), err)
+		}
+		allowed := false
+		for _, r := range rules {
+			if r.matches(u) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			rs := make([]string, len(rules))
+			for i, r := range rules {
+				rs[i] = "[" + r.String() + "]"
+			}
+			return fmt.Errorf("%s %s is not allowed by BackupPolicy %s: allowed %ss are %s",
+				kind, s, strings.Join(policies, ","), kind, strings.Join(rs, " "))
+		}
+	}
+	return nil
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// BackupPolicy is the Schema for the backuppolicies API
+type BackupPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BackupPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// BackupPolicyList contains a list of BackupPolicy
+type BackupPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BackupPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&BackupPolicy{}, &BackupPolicyList{})
+}
@@ -0,0 +1,96 @@
+package v1beta1_test
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+)
+
+func TestCheckBackupPolicies(t *testing.T) {
+	github := v1beta1.BackupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "github"},
+		Spec: v1beta1.BackupPolicySpec{
+			Sources: []v1beta1.URLRule{{Schemes: []string{"https"}, Hosts: []string{"github.com"}, Paths: []string{"/foo/*"}}},
+		},
+	}
+	tenant := v1beta1.BackupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant"},
+		Spec: v1beta1.BackupPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}},
+			Destinations: []v1beta1.URLRule{
+				{Hosts: []string{"*.backup.example.com"}},
+				{Schemes: []string{"ssh"}, Hosts: []string{"gitlab.com"}},
+			},
+		},
+	}
+	tenantLabels := map[string]string{"tenant": "true"}
+
+	tests := []struct {
+		name     string
+		policies []v1beta1.BackupPolicy
+		nsLabels map[string]string
+		srcs     []string
+		dsts     []string
+		wantErr  bool
+	}{
+		{"no policies", nil, nil, []string{"https://example.com/a"}, []string{"https://example.com/b"}, false},
+		{"src allowed", []v1beta1.BackupPolicy{github}, nil, []string{"https://github.com/foo/bar"}, []string{"https://example.com/b"}, false},
+		{"src wrong scheme", []v1beta1.BackupPolicy{github}, nil, []string{"http://github.com/foo/bar"}, nil, true},
+		{"src wrong host", []v1beta1.BackupPolicy{github}, nil, []string{"https://example.com/foo/bar"}, nil, true},
+		{"src wrong path", []v1beta1.BackupPolicy{github}, nil, []string{"https://github.com/bar/foo"}, nil, true},
+		{"src dots in a name", []v1beta1.BackupPolicy{github}, nil, []string{"https://github.com/foo/.bar..baz"}, nil, false},
+		{"src dot-dot segment", []v1beta1.BackupPolicy{github}, nil, []string{"https://github.com/foo/.."}, nil, true},
+		{"src encoded dot-dot segment", []v1beta1.BackupPolicy{github}, nil, []string{"https://github.com/foo/%2E%2E"}, nil, true},
+		{"dst scp-like dot-dot segment", []v1beta1.BackupPolicy{tenant}, tenantLabels, nil, []string{"git@gitlab.com:foo/../bar"}, true},
+		{"dst dot-dot segment", []v1beta1.BackupPolicy{tenant}, tenantLabels, nil, []string{"https://a.backup.example.com/b/../../c"}, true},
+		{"not selected", []v1beta1.BackupPolicy{tenant}, nil, nil, []string{"https://example.com/b"}, false},
+		{"dst allowed", []v1beta1.BackupPolicy{github, tenant}, tenantLabels, []string{"https://github.com/foo/bar"}, []string{"https://a.backup.example.com/b"}, false},
+		{"dst scp-like allowed", []v1beta1.BackupPolicy{tenant}, tenantLabels, nil, []string{"git@gitlab.com:foo/bar.git"}, false},
+		{"dst scp-like wrong host", []v1beta1.BackupPolicy{tenant}, tenantLabels, nil, []string{"git@github.com:foo/bar.git"}, true},
+		{"dst https to ssh only host", []v1beta1.BackupPolicy{tenant}, tenantLabels, nil, []string{"https://gitlab.com/foo/bar"}, true},
+		{"one of dsts not allowed", []v1beta1.BackupPolicy{tenant}, tenantLabels, nil, []string{"https://a.backup.example.com/b", "https://example.com/b"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v1beta1.CheckBackupPolicies(tt.policies, tt.nsLabels, tt.srcs, tt.dsts); (err != nil) != tt.wantErr {
+				t.Errorf("CheckBackupPolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestrictsURLs(t *testing.T) {
+	tenant := v1beta1.BackupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant"},
+		Spec: v1beta1.BackupPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}},
+			Destinations:      []v1beta1.URLRule{{Hosts: []string{"backup.example.com"}}},
+		},
+	}
+	empty := v1beta1.BackupPolicy{ObjectMeta: metav1.ObjectMeta{Name: "empty"}}
+
+	tests := []struct {
+		name     string
+		policies []v1beta1.BackupPolicy
+		nsLabels map[string]string
+		want     bool
+	}{
+		{"no policies", nil, nil, false},
+		{"selected", []v1beta1.BackupPolicy{tenant}, map[string]string{"tenant": "true"}, true},
+		{"not selected", []v1beta1.BackupPolicy{tenant}, nil, false},
+		{"no rules", []v1beta1.BackupPolicy{empty}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v1beta1.RestrictsURLs(tt.policies, tt.nsLabels)
+			if err != nil {
+				t.Fatalf("RestrictsURLs() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RestrictsURLs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
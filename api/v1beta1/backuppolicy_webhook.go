@@ -0,0 +1,152 @@
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var backuppolicylog = logf.Log.WithName("backuppolicy-resource")
+
+func (r *BackupPolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// NOTE: change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
+//+kubebuilder:webhook:path=/validate-gitbackup-ebiiim-com-v1beta1-backuppolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=gitbackup.ebiiim.com,resources=backuppolicies,verbs=create;update,versions=v1beta1,name=vbackuppolicy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &BackupPolicy{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *BackupPolicy) ValidateCreate() error {
+	backuppolicylog.Info("validate create", "name", r.Name)
+
+	return r.validateSpec()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *BackupPolicy) ValidateUpdate(old runtime.Object) error {
+	backuppolicylog.Info("validate update", "name", r.Name)
+
+	return r.validateSpec()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+// NOTE: nothing to validate upon object deletion.
+func (r *BackupPolicy) ValidateDelete() error { return nil }
+
+func (r *BackupPolicy) validateSpec() error {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	if r.Spec.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(r.Spec.NamespaceSelector); err != nil {
+			errs = append(errs, field.Invalid(spec.Child("namespaceSelector"), r.Spec.NamespaceSelector, err.Error()))
+		}
+	}
+	errs = append(errs, validateURLRules(r.Spec.Sources, spec.Child("sources"))...)
+	errs = append(errs, validateURLRules(r.Spec.Destinations, spec.Child("destinations"))...)
+	if len(errs) != 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("BackupPolicy").GroupKind(), r.Name, errs)
+	}
+	return nil
+}
+
+// validateURLRules tests if the patterns in rules are valid path.Match patterns. fldPath is the path of rules.
+func validateURLRules(rules []URLRule, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, rule := range rules {
+		p := fldPath.Index(i)
+		for _, f := range []struct {
+			name     string
+			patterns []string
+		}{{"schemes", rule.Schemes}, {"hosts", rule.Hosts}, {"paths", rule.Paths}} {
+			for j, pattern := range f.patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					errs = append(errs, field.Invalid(p.Child(f.name).Index(j), pattern, err.Error()))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=backuppolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// backupPolicyUser is implemented by types whose URLs are restricted by BackupPolicies.
+type backupPolicyUser interface {
+	client.Object
+	webhook.Validator
+	getURLs() (srcs, dsts []string)
+}
+
+// backupPolicyValidator calls the validation of a backupPolicyUser,
+// and then tests if its URLs are allowed by the BackupPolicies that apply to its namespace.
+type backupPolicyValidator struct {
+	client.Reader
+}
+
+var _ admission.CustomValidator = &backupPolicyValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *backupPolicyValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	u, ok := obj.(backupPolicyUser)
+	if !ok {
+		return fmt.Errorf("unexpected type %T", obj)
+	}
+	if err := u.ValidateCreate(); err != nil {
+		return err
+	}
+	return v.validatePolicies(ctx, u)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *backupPolicyValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	u, ok := newObj.(backupPolicyUser)
+	if !ok {
+		return fmt.Errorf("unexpected type %T", newObj)
+	}
+	if err := u.ValidateUpdate(oldObj); err != nil {
+		return err
+	}
+	return v.validatePolicies(ctx, u)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *backupPolicyValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	u, ok := obj.(backupPolicyUser)
+	if !ok {
+		return fmt.Errorf("unexpected type %T", obj)
+	}
+	return u.ValidateDelete()
+}
+
+func (v *backupPolicyValidator) validatePolicies(ctx context.Context, u backupPolicyUser) error {
+	var policies BackupPolicyList
+	if err := v.List(ctx, &policies); err != nil {
+		return fmt.Errorf("unable to list BackupPolicies: %w", err)
+	}
+	if len(policies.Items) == 0 {
+		return nil
+	}
+	var ns corev1.Namespace
+	if err := v.Get(ctx, client.ObjectKey{Name: u.GetNamespace()}, &ns); err != nil {
+		return fmt.Errorf("unable to get Namespace %s: %w", u.GetNamespace(), err)
+	}
+	srcs, dsts := u.getURLs()
+	return CheckBackupPolicies(policies.Items, ns.Labels, srcs, dsts)
+}
@@ -0,0 +1,55 @@
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBackupPolicy_validateSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		spec BackupPolicySpec
+		want []string
+	}{
+		{"valid", BackupPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "foo"}},
+			Sources:           []URLRule{{Schemes: []string{"https"}, Hosts: []string{"*.example.com"}, Paths: []string{"/foo/*"}}},
+			Destinations:      []URLRule{{Hosts: []string{"backup.example.com"}}},
+		}, nil},
+		{"all errors", BackupPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Foo"}}},
+			Sources: []URLRule{
+				{Hosts: []string{"github.com"}},
+				{Schemes: []string{"[https"}, Hosts: []string{"github.com", "[github.com"}},
+			},
+			Destinations: []URLRule{{Paths: []string{"/foo/[", "/bar/*"}}},
+		}, []string{
+			"spec.namespaceSelector",
+			"spec.sources[1].schemes[0]",
+			"spec.sources[1].hosts[1]",
+			"spec.destinations[0].paths[0]",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := BackupPolicy{Spec: tt.spec}
+			err := r.validateSpec()
+			var got []string
+			if err != nil {
+				status, ok := err.(apierrors.APIStatus)
+				if !ok {
+					t.Fatalf("validateSpec() = %v, want an API status error", err)
+				}
+				for _, c := range status.Status().Details.Causes {
+					got = append(got, c.Field)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateSpec() = %v, want fields %v", err, tt.want)
+			}
+		})
+	}
+}
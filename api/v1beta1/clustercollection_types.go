@@ -0,0 +1,146 @@
+package v1beta1
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ClusterCollectionLabel is the label key set to Repositories created by a ClusterCollection.
+	// The value is the name of the ClusterCollection.
+	ClusterCollectionLabel = "gitbackup.ebiiim.com/cluster-collection"
+	// ClusterCollectionFinalizer is the finalizer to delete Repositories in all namespaces
+	// as cross-namespace owner references are not allowed.
+	ClusterCollectionFinalizer = "gitbackup.ebiiim.com/cluster-collection"
+	// NamespacePlaceholder is replaced with the namespace in `Src` and `Dst` of ClusterCollection repos.
+	NamespacePlaceholder = "$(NAMESPACE)"
+	// ConditionReposReconciled is True if all Repositories of the ClusterCollection are created or updated
+	// and the ones no longer needed are deleted.
+	ConditionReposReconciled = "ReposReconciled"
+)
+
+// GetOwnedRepositoryNames returns ["{r.Name}-{r.Repos[i].Name}", ...]
+// The webhook rejects names longer than MaxRepositoryNameLength; they are truncated by TruncateName
+// only for ClusterCollections that were created before the validation.
+func (r ClusterCollection) GetOwnedRepositoryNames() []string {
+	return ownedRepositoryNames(r.Name, r.getRepoURLs())
+}
+
+// getRepoURLs returns the CollectionRepoURL of each repo.
+func (r ClusterCollection) getRepoURLs() []CollectionRepoURL {
+	repos := make([]CollectionRepoURL, len(r.Spec.Repos))
+	for i, cr := range r.Spec.Repos {
+		repos[i] = cr.CollectionRepoURL
+	}
+	return repos
+}
+
+// ForNamespace returns cr with NamespacePlaceholder in `Src` and `Dst` replaced with ns.
+func (cr ClusterCollectionRepo) ForNamespace(ns string) CollectionRepoURL {
+	u := *cr.CollectionRepoURL.DeepCopy()
+	u.Src = strings.ReplaceAll(u.Src, NamespacePlaceholder, ns)
+	u.Dst = strings.ReplaceAll(u.Dst, NamespacePlaceholder, ns)
+	return u
+}
+
+// ClusterCollectionSpec defines the desired state of ClusterCollection
+type ClusterCollectionSpec struct {
+	// Schedule in Cron format.
+	Schedule string `json:"schedule"`
+	// TimeZone in TZ database name.
+	// See also: https://kubernetes.io/docs/concepts/workloads/controllers/cron-jobs/#time-zones
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// GitImage specifies the container image to run.
+	// +optional
+	GitImage *string `json:"gitImage,omitempty"`
+	// ImagePullSecret specifies the name of the Secret in each target namespace used to pull the GitImage.
+	// +optional
+	ImagePullSecret *corev1.LocalObjectReference `json:"imagePullSecret,omitempty"`
+
+	// GitConfig specifies the name of the configmap resource in each target namespace used to mount .git-config
+	// (default: the default of Repository)
+	// Note that "[credential]\nhelper=store" is required to use GitCredentials.
+	// +optional
+	GitConfig *corev1.LocalObjectReference `json:"gitConfig,omitempty"`
+	// GitCredentials specifies the name of the Secret in each target namespace used to mount .git-credentials
+	// +optional
+	GitCredentials *corev1.LocalObjectReference `json:"gitCredentials,omitempty"`
+
+	// PodOptions is copied to each Repository.
+	PodOptions `json:",inline"`
+
+	// JobPolicy is copied to each Repository.
+	// +optional
+	JobPolicy *JobPolicy `json:"jobPolicy,omitempty"`
+
+	// Repos specifies repositories to backup.
+	Repos []ClusterCollectionRepo `json:"repos"`
+}
+
+// ClusterCollectionRepo defines repositories to backup and the namespaces to create the Repositories in.
+// A Repository is created in each namespace in `Namespaces` and each namespace that matches `NamespaceSelector`.
+type ClusterCollectionRepo struct {
+	// "$(NAMESPACE)" in `Src` and `Dst` is replaced with the namespace.
+	CollectionRepoURL `json:",inline"`
+
+	// Namespaces specifies the namespaces to create the Repository in.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects the namespaces to create the Repository in.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// ClusterCollectionStatus defines the observed state of ClusterCollection
+type ClusterCollectionStatus struct {
+	// Conditions represent the latest available observations of the ClusterCollection.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Repos is the number of Repositories created by the ClusterCollection in all namespaces.
+	// +optional
+	Repos int32 `json:"repos,omitempty"`
+	// Ready is the number of the Repositories whose last backup succeeded.
+	// +optional
+	Ready int32 `json:"ready,omitempty"`
+	// Failing is the number of the Repositories whose last backup failed.
+	// +optional
+	Failing int32 `json:"failing,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster,shortName=ccoll;ccolls,categories=gitbackup
+//+kubebuilder:printcolumn:name="Repos",type=integer,JSONPath=`.status.repos`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.ready`
+//+kubebuilder:printcolumn:name="Failing",type=integer,JSONPath=`.status.failing`
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterCollection is the Schema for the clustercollections API
+type ClusterCollection struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterCollectionSpec   `json:"spec,omitempty"`
+	Status ClusterCollectionStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterCollectionList contains a list of ClusterCollection
+type ClusterCollectionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterCollection `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterCollection{}, &ClusterCollectionList{})
+}
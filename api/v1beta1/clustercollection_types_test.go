@@ -0,0 +1,61 @@
+package v1beta1_test
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+)
+
+func TestClusterCollection_GetOwnedRepositoryNames(t *testing.T) {
+	tests := []struct {
+		name string
+		coll v1beta1.ClusterCollection
+		want []string
+	}{
+		{"a/foo,FOO_2022", v1beta1.ClusterCollection{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Spec: v1beta1.ClusterCollectionSpec{
+			Repos: []v1beta1.ClusterCollectionRepo{
+				{CollectionRepoURL: v1beta1.CollectionRepoURL{Name: pointer.String("foo"), Src: "http://example.com/hoge/foo", Dst: "http://example.com/fuga/foo"}},
+				{CollectionRepoURL: v1beta1.CollectionRepoURL{Src: "http://example.com/hoge/FOO_2022", Dst: "http://example.com/fuga/FOO_2022"}},
+			},
+		}}, []string{
+			"a-foo",
+			"a-foo-2022",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.coll.GetOwnedRepositoryNames(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ClusterCollection.GetOwnedRepositoryNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterCollectionRepo_ForNamespace(t *testing.T) {
+	tests := []struct {
+		name string
+		cr   v1beta1.ClusterCollectionRepo
+		ns   string
+		want v1beta1.CollectionRepoURL
+	}{
+		{"no placeholder",
+			v1beta1.ClusterCollectionRepo{CollectionRepoURL: v1beta1.CollectionRepoURL{Src: "http://example.com/hoge/foo", Dst: "http://example.com/fuga/foo"}},
+			"ns1",
+			v1beta1.CollectionRepoURL{Src: "http://example.com/hoge/foo", Dst: "http://example.com/fuga/foo"}},
+		{"placeholder",
+			v1beta1.ClusterCollectionRepo{CollectionRepoURL: v1beta1.CollectionRepoURL{Name: pointer.String("foo"), Src: "http://example.com/$(NAMESPACE)/foo", Dst: "http://example.com/fuga/$(NAMESPACE)-foo"}},
+			"ns1",
+			v1beta1.CollectionRepoURL{Name: pointer.String("foo"), Src: "http://example.com/ns1/foo", Dst: "http://example.com/fuga/ns1-foo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cr.ForNamespace(tt.ns); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ClusterCollectionRepo.ForNamespace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package v1beta1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var clustercollectionlog = logf.Log.WithName("clustercollection-resource")
+
+func (r *ClusterCollection) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// NOTE: change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
+//+kubebuilder:webhook:path=/validate-gitbackup-ebiiim-com-v1beta1-clustercollection,mutating=false,failurePolicy=fail,sideEffects=None,groups=gitbackup.ebiiim.com,resources=clustercollections,verbs=create;update,versions=v1beta1,name=vclustercollection.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ClusterCollection{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterCollection) ValidateCreate() error {
+	clustercollectionlog.Info("validate create", "name", r.Name)
+
+	return r.validateSpec()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterCollection) ValidateUpdate(old runtime.Object) error {
+	clustercollectionlog.Info("validate update", "name", r.Name)
+
+	return r.validateSpec()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+// NOTE: nothing to validate upon object deletion.
+func (r *ClusterCollection) ValidateDelete() error { return nil }
+
+func (r *ClusterCollection) validateSpec() error {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	if _, err := CycleCronByMinuteInSameHour(r.Spec.Schedule); err != nil {
+		errs = append(errs, field.Invalid(spec.Child("schedule"), r.Spec.Schedule, err.Error()))
+	}
+	errs = append(errs, validateTimeZone(r.Spec.TimeZone, spec.Child("timeZone"))...)
+	errs = append(errs, validateRepoNames(r.Name, r.getRepoURLs(), spec.Child("repos"))...)
+	errs = append(errs, r.validateRepos(spec.Child("repos"))...)
+	errs = append(errs, validateJobPolicy(r.Spec.JobPolicy, spec.Child("jobPolicy"))...)
+	if len(errs) != 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("ClusterCollection").GroupKind(), r.Name, errs)
+	}
+	return nil
+}
+
+// validateRepos validates URLs and namespaces of the repos. fldPath is the path of repos.
+func (r *ClusterCollection) validateRepos(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, cr := range r.Spec.Repos {
+		// any namespace name is fine to check URLs
+		u := cr.ForNamespace("default")
+		p := fldPath.Index(i)
+		errs = append(errs, validateURLs([]*field.Path{p.Child("src"), p.Child("dst")}, []string{u.Src, u.Dst})...)
+		if len(cr.Namespaces) == 0 && cr.NamespaceSelector == nil {
+			errs = append(errs, field.Required(p, "namespaces or namespaceSelector must be specified"))
+		}
+		for j, ns := range cr.Namespaces {
+			if len(validation.IsDNS1123Label(ns)) != 0 {
+				errs = append(errs, field.Invalid(p.Child("namespaces").Index(j), ns, "must be RFC1123 DNS Label string"))
+			}
+		}
+		if cr.NamespaceSelector != nil {
+			if _, err := metav1.LabelSelectorAsSelector(cr.NamespaceSelector); err != nil {
+				errs = append(errs, field.Invalid(p.Child("namespaceSelector"), cr.NamespaceSelector, err.Error()))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,69 @@
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestClusterCollection_validateSpec(t *testing.T) {
+	repo := func(src, dst string, namespaces ...string) ClusterCollectionRepo {
+		return ClusterCollectionRepo{CollectionRepoURL: CollectionRepoURL{Src: src, Dst: dst}, Namespaces: namespaces}
+	}
+	tests := []struct {
+		name string
+		spec ClusterCollectionSpec
+		want []string
+	}{
+		{"valid", ClusterCollectionSpec{
+			Schedule: "0 6 * * *",
+			TimeZone: pointer.String("Asia/Tokyo"),
+			Repos:    []ClusterCollectionRepo{repo("https://example.com/$(NAMESPACE)/app", "https://example.com/$(NAMESPACE)/app-dst", "ns1")},
+		}, nil},
+		{"all errors", ClusterCollectionSpec{
+			Schedule: "foo",
+			TimeZone: pointer.String("Asia/Foo"),
+			Repos: []ClusterCollectionRepo{
+				repo("https://example.com/$(NAMESPACE)/___", "file:///dst", "ns1", "NS2"),
+				repo("https://example.com/$(NAMESPACE)/app1", "https://example.com/$(NAMESPACE)/app1-dst"),
+				{
+					CollectionRepoURL: CollectionRepoURL{Src: "https://example.com/$(NAMESPACE)/app2", Dst: "https://example.com/$(NAMESPACE)/app2-dst"},
+					NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "foo", Operator: "Foo"}}},
+				},
+			},
+			JobPolicy: &JobPolicy{BackoffLimit: pointer.Int32(-1)},
+		}, []string{
+			"spec.schedule",
+			"spec.timeZone",
+			"spec.repos[0].name",
+			"spec.repos[0].dst",
+			"spec.repos[0].namespaces[1]",
+			"spec.repos[1]",
+			"spec.repos[2].namespaceSelector",
+			"spec.jobPolicy.backoffLimit",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ClusterCollection{Spec: tt.spec}
+			r.Name = "cc"
+			err := r.validateSpec()
+			var got []string
+			if err != nil {
+				status, ok := err.(apierrors.APIStatus)
+				if !ok {
+					t.Fatalf("validateSpec() = %v, want an API status error", err)
+				}
+				for _, c := range status.Status().Details.Causes {
+					got = append(got, c.Field)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateSpec() = %v, want fields %v", err, tt.want)
+			}
+		})
+	}
+}
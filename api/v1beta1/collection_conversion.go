@@ -0,0 +1,119 @@
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+var _ conversion.Convertible = &Collection{}
+
+// ConvertTo converts r to the hub version v1.
+//
+// GitCredentials becomes spec.sourceCredentials and spec.destinationCredentials,
+// and GitConfig of the ConfigMap created by the controller becomes nil.
+func (r *Collection) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.Collection)
+	dst.ObjectMeta = *r.ObjectMeta.DeepCopy()
+	dst.Spec = collectionSpecTo(r.Spec, r.GetOwnedConfigMapName())
+	dst.Status = v1.CollectionStatus(r.Status)
+
+	var data v1.CollectionSpec
+	ok, err := popConversionData(&dst.ObjectMeta, &data)
+	if !ok || err != nil {
+		return err
+	}
+	// restore the fields that v1beta1 cannot represent unless they are changed in v1beta1
+	prev := collectionSpecFrom(data, r.GetOwnedConfigMapName())
+	if equality.Semantic.DeepEqual(prev.GitCredentials, r.Spec.GitCredentials) {
+		dst.Spec.SourceCredentials = data.SourceCredentials
+		dst.Spec.DestinationCredentials = data.DestinationCredentials
+	}
+	if equality.Semantic.DeepEqual(prev.GitConfig, r.Spec.GitConfig) {
+		dst.Spec.GitConfig = data.GitConfig
+	}
+	for i := range dst.Spec.Repos {
+		if i < len(prev.Repos) && equality.Semantic.DeepEqual(prev.Repos[i], r.Spec.Repos[i]) {
+			dst.Spec.Repos[i].Source.Credentials = data.Repos[i].Source.Credentials
+			dst.Spec.Repos[i].Destination.Credentials = data.Repos[i].Destination.Credentials
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version v1 to r.
+//
+// GitCredentials is the credentials of the sources, or the destinations if the sources have no credentials.
+// If the v1 object cannot be represented in v1beta1, its spec is kept in ConversionDataAnnotation.
+func (r *Collection) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1.Collection)
+	r.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(r.Annotations, ConversionDataAnnotation)
+	r.Spec = collectionSpecFrom(src.Spec, r.GetOwnedConfigMapName())
+	r.Status = CollectionStatus(src.Status)
+
+	if equality.Semantic.DeepEqual(collectionSpecTo(r.Spec, r.GetOwnedConfigMapName()), src.Spec) {
+		return nil
+	}
+	return setConversionData(&r.ObjectMeta, src.Spec)
+}
+
+func collectionSpecTo(s CollectionSpec, ownedGitConfig string) v1.CollectionSpec {
+	var repos []v1.CollectionRepo
+	if s.Repos != nil {
+		repos = make([]v1.CollectionRepo, len(s.Repos))
+		for i, cr := range s.Repos {
+			repos[i] = v1.CollectionRepo{
+				Name:        cr.Name,
+				Source:      v1.GitRemote{URL: cr.Src},
+				Destination: v1.GitRemote{URL: cr.Dst},
+			}
+		}
+	}
+	return v1.CollectionSpec{
+		Schedule:               s.Schedule,
+		TimeZone:               s.TimeZone,
+		BackupClassName:        s.BackupClassName,
+		GitImage:               s.GitImage,
+		ImagePullSecret:        s.ImagePullSecret,
+		GitConfig:              gitConfigTo(s.GitConfig, ownedGitConfig),
+		SourceCredentials:      s.GitCredentials,
+		DestinationCredentials: s.GitCredentials,
+		PodOptions:             v1.PodOptions(s.PodOptions),
+		JobPolicy:              jobPolicyTo(s.JobPolicy),
+		Notifications:          (*v1.NotificationsSpec)(s.Notifications),
+		MaxAge:                 s.MaxAge,
+		PruneRemoved:           (*v1.PrunePolicy)(s.PruneRemoved),
+		Repos:                  repos,
+	}
+}
+
+func collectionSpecFrom(s v1.CollectionSpec, ownedGitConfig string) CollectionSpec {
+	var repos []CollectionRepoURL
+	if s.Repos != nil {
+		repos = make([]CollectionRepoURL, len(s.Repos))
+		for i, cr := range s.Repos {
+			repos[i] = CollectionRepoURL{
+				Name: cr.Name,
+				Src:  cr.Source.URL,
+				Dst:  cr.Destination.URL,
+			}
+		}
+	}
+	return CollectionSpec{
+		Schedule:        s.Schedule,
+		TimeZone:        s.TimeZone,
+		BackupClassName: s.BackupClassName,
+		GitImage:        s.GitImage,
+		ImagePullSecret: s.ImagePullSecret,
+		GitConfig:       gitConfigFrom(s.GitConfig, ownedGitConfig),
+		GitCredentials:  credentialsFrom(s.SourceCredentials, s.DestinationCredentials),
+		PodOptions:      PodOptions(s.PodOptions),
+		JobPolicy:       jobPolicyFrom(s.JobPolicy),
+		Notifications:   (*NotificationsSpec)(s.Notifications),
+		MaxAge:          s.MaxAge,
+		PruneRemoved:    (*PrunePolicy)(s.PruneRemoved),
+		Repos:           repos,
+	}
+}
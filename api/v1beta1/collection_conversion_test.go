@@ -0,0 +1,82 @@
+package v1beta1_test
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+)
+
+func TestCollection_Convert(t *testing.T) {
+	meta := metav1.ObjectMeta{Name: "coll1", Namespace: "default"}
+	src := &corev1.LocalObjectReference{Name: "src"}
+	dst := &corev1.LocalObjectReference{Name: "dst"}
+	foo := &corev1.LocalObjectReference{Name: "foo"}
+	status := v1.CollectionStatus{Repos: 2, Ready: 1, Failing: 1}
+	in := v1.CollectionSpec{
+		SourceCredentials:      src,
+		DestinationCredentials: dst,
+		Repos: []v1.CollectionRepo{
+			{Source: v1.GitRemote{URL: "https://example.com/src/foo"}, Destination: v1.GitRemote{URL: "https://example.com/dst/foo", Credentials: foo}},
+			{Source: v1.GitRemote{URL: "https://example.com/src/bar"}, Destination: v1.GitRemote{URL: "https://example.com/dst/bar"}},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		update func(*v1beta1.CollectionSpec)
+		want   v1.CollectionSpec
+	}{
+		{"not changed",
+			func(s *v1beta1.CollectionSpec) {},
+			in},
+		{"credentials changed",
+			func(s *v1beta1.CollectionSpec) { s.GitCredentials = foo },
+			v1.CollectionSpec{SourceCredentials: foo, DestinationCredentials: foo, Repos: in.Repos}},
+		{"repo changed",
+			func(s *v1beta1.CollectionSpec) { s.Repos[0].Dst = "https://example.com/dst/baz" },
+			v1.CollectionSpec{SourceCredentials: src, DestinationCredentials: dst, Repos: []v1.CollectionRepo{
+				{Source: v1.GitRemote{URL: "https://example.com/src/foo"}, Destination: v1.GitRemote{URL: "https://example.com/dst/baz"}},
+				in.Repos[1],
+			}}},
+		{"repo appended",
+			func(s *v1beta1.CollectionSpec) {
+				s.Repos = append(s.Repos, v1beta1.CollectionRepoURL{Src: "https://example.com/src/baz", Dst: "https://example.com/dst/baz"})
+			},
+			v1.CollectionSpec{SourceCredentials: src, DestinationCredentials: dst, Repos: append(append([]v1.CollectionRepo{}, in.Repos...),
+				v1.CollectionRepo{Source: v1.GitRemote{URL: "https://example.com/src/baz"}, Destination: v1.GitRemote{URL: "https://example.com/dst/baz"}},
+			)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spoke v1beta1.Collection
+			if err := spoke.ConvertFrom(&v1.Collection{ObjectMeta: meta, Spec: *in.DeepCopy(), Status: status}); err != nil {
+				t.Fatalf("ConvertFrom() error = %v", err)
+			}
+			if !equality.Semantic.DeepEqual(spoke.Spec.GitCredentials, src) {
+				t.Errorf("ConvertFrom() GitCredentials = %v, want %v", spoke.Spec.GitCredentials, src)
+			}
+			if _, ok := spoke.Annotations[v1beta1.ConversionDataAnnotation]; !ok {
+				t.Errorf("ConvertFrom() has no conversion data")
+			}
+			tt.update(&spoke.Spec)
+			var got v1.Collection
+			if err := spoke.ConvertTo(&got); err != nil {
+				t.Fatalf("ConvertTo() error = %v", err)
+			}
+			if !equality.Semantic.DeepEqual(got.Spec, tt.want) {
+				t.Errorf("ConvertTo() = %+v, want %+v", got.Spec, tt.want)
+			}
+			if got.Status != status {
+				t.Errorf("ConvertTo() Status = %+v, want %+v", got.Status, status)
+			}
+			if _, ok := got.Annotations[v1beta1.ConversionDataAnnotation]; ok {
+				t.Errorf("ConvertTo() has conversion data")
+			}
+		})
+	}
+}
@@ -1,94 +1,85 @@
 package v1beta1
 
 import (
-	"fmt"
-	"strconv"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
 )
 
-// CycleCronByMinuteInSameHour cycles cron minute.
-// Assumes cronStr is "1 2 3 4 5" format.
-// "30 6 * * *" -> "31 6 * * *" -> ... "59 6 * * *" -> "0 6 * * *" -> "1 6 * * *" -> ...
+// CycleCronByMinuteInSameHour cycles cron minute. See v1.CycleCronByMinuteInSameHour.
 func CycleCronByMinuteInSameHour(cronStr string) (string, error) {
-	ss := strings.Split(cronStr, " ")
-	if len(ss) != 5 {
-		return "", fmt.Errorf("cronStr must be \"1 2 3 4 5\" format but got %s", cronStr)
-	}
-	minute, err := strconv.Atoi(ss[0])
-	if err != nil || minute < 0 || minute >= 60 {
-		return "", fmt.Errorf("cronStr has invalid minute field cronStr=%s minute=%d err=%v", cronStr, minute, err)
-	}
-	minute = (minute + 1) % 60
-	ss[0] = strconv.Itoa(minute)
-	return strings.Join(ss, " "), nil
+	return v1.CycleCronByMinuteInSameHour(cronStr)
 }
 
 // GetOwnedConfigMapName returns "gitbackup-collection-{r.Name}-gitconfig"
 func (r Collection) GetOwnedConfigMapName() string {
-	return strings.Join([]string{OperatorName, "collection", r.Name, "gitconfig"}, "-")
+	return v1.Collection{ObjectMeta: r.ObjectMeta}.GetOwnedConfigMapName()
 }
 
+// ToRFC1123 converts s to RFC1123 DNS Subdomain Names or returns def. See v1.ToRFC1123.
 func ToRFC1123(s string, def string) string {
-	s = strings.ToLower(s)
-	s = strings.ReplaceAll(s, "_", "-")
-	var sb strings.Builder
-	for _, c := range s {
-		if c == '.' || c == '-' || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
-			sb.WriteByte(byte(c))
-		}
-	}
-	s = sb.String()
-	a := 0
-	b := len(s)
-	for i, c := range s {
-		if c != '.' && c != '-' {
-			a = i
-			break
-		}
-		// only '.' or '-'
-		if i == len(s)-1 {
-			return def
-		}
-	}
-	for i := len(s) - 1; i >= 0; i-- {
-		if s[i] != '.' && s[i] != '-' {
-			b = i + 1
-			break
-		}
-	}
-	s = s[a:b]
-	if len(s) == 0 {
-		return def
-	}
-	if len(s) > 253 {
-		return s[0:253]
-	}
-	return s
+	return v1.ToRFC1123(s, def)
+}
+
+const (
+	// MaxCronJobNameLength is the maximum length of CronJob names. See v1.MaxCronJobNameLength.
+	MaxCronJobNameLength = v1.MaxCronJobNameLength
+	// MaxRepositoryNameLength is the maximum length of Repository names. See v1.MaxRepositoryNameLength.
+	MaxRepositoryNameLength = v1.MaxRepositoryNameLength
+)
+
+// TruncateName truncates name to max with a hash. See v1.TruncateName.
+func TruncateName(name string, max int) string {
+	return v1.TruncateName(name, max)
 }
 
 // GetOwnedRepositoryNames returns ["{r.Name}-{r.Repos[i].Name}", ...]
+// The webhook rejects names longer than MaxRepositoryNameLength; they are truncated by TruncateName
+// only for Collections that were created before the validation.
 func (r Collection) GetOwnedRepositoryNames() []string {
-	prefix := strings.Join([]string{r.Name, ""}, "-")
-	names := make([]string, len(r.Spec.Repos))
-	for i, cr := range r.Spec.Repos {
-		var name string
-
-		if cr.Name != nil {
-			name = *cr.Name
-		} else {
-			// use the last element of cr.Src as name
-			crSrc := strings.Split(cr.Src, "/")
-			// convert repo name to RFC1123 DNS Subdomain Names
-			name = ToRFC1123(crSrc[len(crSrc)-1], "invalid-name")
-		}
-		names[i] = prefix + name
+	return ownedRepositoryNames(r.Name, r.Spec.Repos)
+}
+
+// ownedRepositoryNames returns the names computed by v1.Collection
+// so that the webhooks and the controllers agree on the names of Repositories.
+func ownedRepositoryNames(collName string, repos []CollectionRepoURL) []string {
+	coll := v1.Collection{ObjectMeta: metav1.ObjectMeta{Name: collName}}
+	for _, cr := range repos {
+		coll.Spec.Repos = append(coll.Spec.Repos, cr.hub())
 	}
-	return names
+	return coll.GetOwnedRepositoryNames()
 }
 
+// hub returns cr as v1.CollectionRepo without credentials.
+func (cr CollectionRepoURL) hub() v1.CollectionRepo {
+	return v1.CollectionRepo{Name: cr.Name, Source: v1.GitRemote{URL: cr.Src}, Destination: v1.GitRemote{URL: cr.Dst}}
+}
+
+// getName returns cr.Name or the last element of cr.Src.
+func (cr CollectionRepoURL) getName() string {
+	return cr.hub().GetName()
+}
+
+// srcName returns the last element of cr.Src converted to RFC1123 DNS Subdomain Names or "" if it is not possible.
+func (cr CollectionRepoURL) srcName() string {
+	crSrc := strings.Split(cr.Src, "/")
+	return ToRFC1123(crSrc[len(crSrc)-1], "")
+}
+
+// PrunePolicy is what to do with Repositories removed from a Collection.
+// +kubebuilder:validation:Enum=Delete;Orphan
+type PrunePolicy string
+
+const (
+	// PruneDelete deletes the Repository.
+	PruneDelete PrunePolicy = "Delete"
+	// PruneOrphan keeps the Repository and removes the owner reference so that the Collection no longer manages it.
+	PruneOrphan PrunePolicy = "Orphan"
+)
+
 // CollectionSpec defines the desired state of Collection
 type CollectionSpec struct {
 	// Schedule in Cron format.
@@ -98,6 +89,10 @@ type CollectionSpec struct {
 	// +optional
 	TimeZone *string `json:"timeZone,omitempty"`
 
+	// BackupClassName specifies the BackupClass to take defaults from. (default: the default BackupClass if exists)
+	// +optional
+	BackupClassName *string `json:"backupClassName,omitempty"`
+
 	// GitImage specifies the container image to run.
 	// +optional
 	GitImage *string `json:"gitImage,omitempty"`
@@ -113,6 +108,25 @@ type CollectionSpec struct {
 	// +optional
 	GitCredentials *corev1.LocalObjectReference `json:"gitCredentials,omitempty"`
 
+	// PodOptions is copied to each Repository.
+	PodOptions `json:",inline"`
+
+	// JobPolicy is copied to each Repository.
+	// +optional
+	JobPolicy *JobPolicy `json:"jobPolicy,omitempty"`
+
+	// Notifications is copied to each Repository.
+	// +optional
+	Notifications *NotificationsSpec `json:"notifications,omitempty"`
+
+	// MaxAge is copied to each Repository.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+
+	// PruneRemoved specifies what to do with Repositories that are removed from Repos or renamed. (default: Delete)
+	// +optional
+	PruneRemoved *PrunePolicy `json:"pruneRemoved,omitempty"`
+
 	// Repos specifies repositories to backup.
 	Repos []CollectionRepoURL `json:"repos"`
 }
@@ -130,13 +144,25 @@ type CollectionRepoURL struct {
 
 // CollectionStatus defines the observed state of Collection
 type CollectionStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Repos is the number of Repositories controlled by the Collection.
+	// +optional
+	Repos int32 `json:"repos,omitempty"`
+	// Ready is the number of the Repositories whose last backup succeeded.
+	// +optional
+	Ready int32 `json:"ready,omitempty"`
+	// Failing is the number of the Repositories whose last backup failed.
+	// +optional
+	Failing int32 `json:"failing,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
-//+kubebuilder:resource:shortName=coll;colls
+//+kubebuilder:resource:shortName=coll;colls,categories=gitbackup
+//+kubebuilder:printcolumn:name="Repos",type=integer,JSONPath=`.status.repos`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.ready`
+//+kubebuilder:printcolumn:name="Failing",type=integer,JSONPath=`.status.failing`
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Collection is the Schema for the collections API
 type Collection struct {
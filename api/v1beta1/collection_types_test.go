@@ -2,6 +2,7 @@ package v1beta1_test
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
@@ -112,6 +113,13 @@ func TestCollection_GetOwnedRepositoryNames(t *testing.T) {
 			"b-c-bar",
 			"b-c-baz",
 		}},
+		{"coll/long", fields{ObjectMeta: metav1.ObjectMeta{Name: "coll"}, Spec: v1beta1.CollectionSpec{
+			Repos: []v1beta1.CollectionRepoURL{
+				{Name: pointer.String(strings.Repeat("x", 40)), Src: "http://example.com/hoge/foo", Dst: "http://example.com/fuga/foo"},
+			},
+		}}, []string{
+			"coll-xxxxxxxxxxxxxxxxxxxxxxxxxxxx-ea388afc",
+		}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -128,6 +136,30 @@ func TestCollection_GetOwnedRepositoryNames(t *testing.T) {
 	}
 }
 
+func TestTruncateName(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"short", "abc", 3, "abc"},
+		{"long", "abcdefghijklmn", 13, "abcd-0653c7e9"},
+		{"trim", "abc-efghijklmn", 13, "abc-3027b9fe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := v1beta1.TruncateName(tt.s, tt.max)
+			if got != tt.want {
+				t.Errorf("TruncateName() = %v, want %v", got, tt.want)
+			}
+			if len(got) > tt.max {
+				t.Errorf("TruncateName() = %v, longer than %d", got, tt.max)
+			}
+		})
+	}
+}
+
 func Test_ToRFC1123(t *testing.T) {
 	type args struct {
 		s   string
@@ -4,8 +4,10 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -15,16 +17,30 @@ import (
 var collectionlog = logf.Log.WithName("collection-resource")
 
 func (r *Collection) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// register the validating webhook first so that the builder does not register another one on the path
+	mgr.GetWebhookServer().Register("/validate-gitbackup-ebiiim-com-v1beta1-collection",
+		withReferenceWarnings(r, &backupPolicyValidator{Reader: mgr.GetClient()}, mgr.GetClient()))
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		WithDefaulter(&backupClassDefaulter{Reader: mgr.GetClient()}).
 		Complete()
 }
 
+func (r *Collection) getBackupClassName() *string { return r.Spec.BackupClassName }
+
+// applyBackupClass sets BackupClassName to cls and fills unspecified fields from cls.
+func (r *Collection) applyBackupClass(cls BackupClass) {
+	r.Spec.BackupClassName = &cls.Name
+	cls.Spec.fill(&r.Spec.TimeZone, &r.Spec.GitImage, &r.Spec.ImagePullSecret, &r.Spec.GitConfig, &r.Spec.GitCredentials,
+		&r.Spec.PodOptions, &r.Spec.JobPolicy)
+}
+
 //+kubebuilder:webhook:path=/mutate-gitbackup-ebiiim-com-v1beta1-collection,mutating=true,failurePolicy=fail,sideEffects=None,groups=gitbackup.ebiiim.com,resources=collections,verbs=create;update,versions=v1beta1,name=mcollection.kb.io,admissionReviewVersions=v1
 
 var _ webhook.Defaulter = &Collection{}
 
 // Default implements webhook.Defaulter so a webhook will be registered for the type
+// NOTE: the webhook is registered with backupClassDefaulter that calls Default after applying the BackupClass.
 func (r *Collection) Default() {
 	collectionlog.Info("default", "name", r.Name)
 
@@ -39,51 +55,98 @@ func (r *Collection) Default() {
 
 var _ webhook.Validator = &Collection{}
 
+func (r *Collection) getURLs() (srcs, dsts []string) {
+	for _, cr := range r.Spec.Repos {
+		srcs = append(srcs, cr.Src)
+		dsts = append(dsts, cr.Dst)
+	}
+	return srcs, dsts
+}
+
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+// NOTE: the webhook is registered with backupPolicyValidator that calls the methods of webhook.Validator before checking BackupPolicies.
 func (r *Collection) ValidateCreate() error {
 	collectionlog.Info("validate create", "name", r.Name)
 
-	if err := r.validateCron(); err != nil {
-		return err
-	}
-	if err := r.validateRepos(); err != nil {
-		return err
-	}
-
-	return nil
+	return r.validateSpec()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Collection) ValidateUpdate(old runtime.Object) error {
 	collectionlog.Info("validate update", "name", r.Name)
 
-	if err := r.validateCron(); err != nil {
-		return err
-	}
-	if err := r.validateRepos(); err != nil {
-		return err
-	}
-
-	return nil
+	return r.validateSpec()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
 // NOTE: nothing to validate upon object deletion.
 func (r *Collection) ValidateDelete() error { return nil }
 
-func (r *Collection) validateCron() error {
-	_, err := CycleCronByMinuteInSameHour(r.Spec.Schedule)
-	return err
+func (r *Collection) validateSpec() error {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	if _, err := CycleCronByMinuteInSameHour(r.Spec.Schedule); err != nil {
+		errs = append(errs, field.Invalid(spec.Child("schedule"), r.Spec.Schedule, err.Error()))
+	}
+	errs = append(errs, validateTimeZone(r.Spec.TimeZone, spec.Child("timeZone"))...)
+	errs = append(errs, validateRepoNames(r.Name, r.Spec.Repos, spec.Child("repos"))...)
+	errs = append(errs, r.validateURL()...)
+	errs = append(errs, validateJobPolicy(r.Spec.JobPolicy, spec.Child("jobPolicy"))...)
+	if len(errs) != 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("Collection").GroupKind(), r.Name, errs)
+	}
+	return nil
 }
 
-func (r *Collection) validateRepos() error {
-	for i, cr := range r.Spec.Repos {
+// validateRepoNames tests if the names of the Repositories (and their CronJobs) created for repos are valid and unique.
+// fldPath is the path of repos.
+func validateRepoNames(collName string, repos []CollectionRepoURL, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	names := make(map[string]int, len(repos))
+	for i, cr := range repos {
+		p := fldPath.Index(i).Child("name")
 		if cr.Name != nil && len(validation.IsDNS1123Subdomain(*cr.Name)) != 0 {
-			return fmt.Errorf("name must be RFC1123 DNS Subdomain string on spec.repos[%d]", i)
+			errs = append(errs, field.Invalid(p, *cr.Name, "must be RFC1123 DNS Subdomain string"))
+			continue
 		}
-		if !isValidURLSet(cr.Src, cr.Dst) {
-			return fmt.Errorf("invalid src or dst URL on spec.repos[%d]", i)
+		if cr.Name == nil && cr.srcName() == "" {
+			errs = append(errs, field.Required(p, "unable to derive a name from the last element of src"))
+			continue
 		}
+		name := collName + "-" + cr.getName()
+		if len(name) > MaxRepositoryNameLength {
+			cronJobName := OperatorName + "-" + name
+			errs = append(errs, field.Invalid(p, cr.getName(), fmt.Sprintf(
+				"Repository name %s must be no more than %d characters so that CronJob name %s is no more than %d characters",
+				name, MaxRepositoryNameLength, cronJobName, MaxCronJobNameLength)))
+			continue
+		}
+		if j, ok := names[name]; ok {
+			errs = append(errs, field.Duplicate(p, fmt.Sprintf("%s (same Repository name as %s)", name, fldPath.Index(j))))
+			continue
+		}
+		names[name] = i
 	}
-	return nil
+	return errs
+}
+
+// validateURL validates URLs and tests if src and dst differ in each repo and dsts are unique.
+func (r *Collection) validateURL() field.ErrorList {
+	var errs field.ErrorList
+	repos := field.NewPath("spec", "repos")
+	var dstPaths []*field.Path
+	var dsts []string
+	for i, cr := range r.Spec.Repos {
+		p := repos.Index(i)
+		errs = append(errs, validateURLs([]*field.Path{p.Child("src"), p.Child("dst")}, []string{cr.Src, cr.Dst})...)
+		dstPaths = append(dstPaths, p.Child("dst"))
+		dsts = append(dsts, cr.Dst)
+	}
+	for _, err := range validateURLs(dstPaths, dsts) {
+		// invalid URLs are already reported
+		if err.Type == field.ErrorTypeDuplicate {
+			errs = append(errs, err)
+		}
+	}
+	return errs
 }
@@ -0,0 +1,96 @@
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+)
+
+func Test_validateRepoNames(t *testing.T) {
+	repo := func(name *string, src string) CollectionRepoURL {
+		return CollectionRepoURL{Name: name, Src: src, Dst: src + "-dst"}
+	}
+	tests := []struct {
+		name     string
+		collName string
+		repos    []CollectionRepoURL
+		want     []string
+	}{
+		{"ok", "coll", []CollectionRepoURL{repo(nil, "https://example.com/a/app"), repo(pointer.String("app2"), "https://example.com/b/app")}, nil},
+		{"invalid", "coll", []CollectionRepoURL{repo(pointer.String("App"), "https://example.com/a/app")}, []string{"spec.repos[0].name"}},
+		{"underivable", "coll", []CollectionRepoURL{repo(nil, "https://example.com/a/___")}, []string{"spec.repos[0].name"}},
+		{"duplicate", "coll", []CollectionRepoURL{repo(nil, "https://example.com/a/app"), repo(nil, "https://example.com/b/foo"), repo(nil, "https://example.com/c/app")}, []string{"spec.repos[2].name"}},
+		// "coll-" + 37 characters = 42 characters
+		{"max length", "coll", []CollectionRepoURL{repo(nil, "https://example.com/a/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")}, nil},
+		{"too long", "coll", []CollectionRepoURL{repo(nil, "https://example.com/a/app"), repo(nil, "https://example.com/a/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")}, []string{"spec.repos[1].name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateRepoNames(tt.collName, tt.repos, field.NewPath("spec", "repos"))
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Field)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("validateRepoNames() = %v, want %v", errs, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("validateRepoNames()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCollection_validateSpec(t *testing.T) {
+	base := CollectionSpec{
+		Schedule: "0 6 * * *",
+		Repos:    []CollectionRepoURL{{Src: "https://github.com/foo/bar", Dst: "https://example.com/bar"}},
+	}
+	tests := []struct {
+		name string
+		mod  func(s *CollectionSpec)
+		want []string
+	}{
+		{"valid", func(s *CollectionSpec) {}, nil},
+		{"time zone", func(s *CollectionSpec) { s.TimeZone = pointer.String("Asia/Tokyo") }, nil},
+		{"all errors", func(s *CollectionSpec) {
+			s.Schedule = "foo"
+			s.TimeZone = pointer.String("Local")
+			s.Repos = append(s.Repos, CollectionRepoURL{Src: "https://github.com/baz/bar", Dst: "file:///dst"})
+			s.JobPolicy = &JobPolicy{BackoffLimit: pointer.Int32(-1)}
+		}, []string{
+			"spec.schedule",
+			"spec.timeZone",
+			"spec.repos[1].name",
+			"spec.repos[1].dst",
+			"spec.jobPolicy.backoffLimit",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Collection{Spec: base}
+			r.Name = "coll"
+			r.Spec.Repos = append([]CollectionRepoURL(nil), base.Repos...)
+			tt.mod(&r.Spec)
+			err := r.validateSpec()
+			var got []string
+			if err != nil {
+				status, ok := err.(apierrors.APIStatus)
+				if !ok {
+					t.Fatalf("validateSpec() = %v, want an API status error", err)
+				}
+				for _, c := range status.Status().Details.Causes {
+					got = append(got, c.Field)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateSpec() = %v, want fields %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NotifierSpec defines the desired state of Notifier
+// A notification is sent to all of the specified sinks.
+type NotifierSpec struct {
+	// Webhook specifies an HTTP endpoint to POST notifications to as JSON objects.
+	// +optional
+	Webhook *WebhookSink `json:"webhook,omitempty"`
+	// Slack specifies a Slack-compatible incoming webhook to POST the messages to.
+	// +optional
+	Slack *WebhookSink `json:"slack,omitempty"`
+	// SMTP specifies an SMTP server to send the messages as emails.
+	// +optional
+	SMTP *SMTPSink `json:"smtp,omitempty"`
+
+	// Template specifies the message in Go text/template format.
+	// The fields are `Event` (Failed, Recovered or ConsecutiveFailures), `Namespace`, `Name`, `Source`, `Destination`,
+	// `JobName`, `Result`, `Reason`, `Message`, `Attempts`, `ConsecutiveFailures` and `CompletionTime`. (default: a one-line summary)
+	// +optional
+	Template *string `json:"template,omitempty"`
+	// Subject specifies the subject of emails in the same format as Template. (default: "[gitbackup] {{.Event}}: Repository {{.Namespace}}/{{.Name}}")
+	// +optional
+	Subject *string `json:"subject,omitempty"`
+}
+
+// WebhookSink specifies the URL of a webhook.
+type WebhookSink struct {
+	// URL specifies the URL.
+	// +optional
+	URL *string `json:"url,omitempty"`
+	// URLSecret specifies a key of a Secret in the same namespace that contains the URL. It takes precedence over URL.
+	// +optional
+	URLSecret *corev1.SecretKeySelector `json:"urlSecret,omitempty"`
+}
+
+// SMTPSink specifies an SMTP server and the addresses of emails.
+type SMTPSink struct {
+	// Host specifies the host of the SMTP server.
+	Host string `json:"host"`
+	// Port specifies the port of the SMTP server. (default: 587)
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+	// From specifies the sender address.
+	From string `json:"from"`
+	// To specifies the recipient addresses.
+	// +kubebuilder:validation:MinItems=1
+	To []string `json:"to"`
+	// Username specifies the username for PLAIN authentication.
+	// +optional
+	Username *string `json:"username,omitempty"`
+	// Password specifies a key of a Secret in the same namespace that contains the password.
+	// Authentication is not used if not specified.
+	// +optional
+	Password *corev1.SecretKeySelector `json:"password,omitempty"`
+}
+
+// DefaultSMTPPort is the default port of SMTPSink.
+const DefaultSMTPPort int32 = 587
+
+// GetPort returns Port or DefaultSMTPPort.
+func (s SMTPSink) GetPort() int32 {
+	if s.Port != nil {
+		return *s.Port
+	}
+	return DefaultSMTPPort
+}
+
+//+kubebuilder:object:root=true
+
+// Notifier is the Schema for the notifiers API
+type Notifier struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NotifierSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// NotifierList contains a list of Notifier
+type NotifierList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Notifier `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Notifier{}, &NotifierList{})
+}
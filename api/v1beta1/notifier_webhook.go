@@ -0,0 +1,93 @@
+package v1beta1
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var notifierlog = logf.Log.WithName("notifier-resource")
+
+func (r *Notifier) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// NOTE: change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
+//+kubebuilder:webhook:path=/validate-gitbackup-ebiiim-com-v1beta1-notifier,mutating=false,failurePolicy=fail,sideEffects=None,groups=gitbackup.ebiiim.com,resources=notifiers,verbs=create;update,versions=v1beta1,name=vnotifier.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Notifier{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Notifier) ValidateCreate() error {
+	notifierlog.Info("validate create", "name", r.Name)
+
+	return r.validateSpec()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Notifier) ValidateUpdate(old runtime.Object) error {
+	notifierlog.Info("validate update", "name", r.Name)
+
+	return r.validateSpec()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+// NOTE: nothing to validate upon object deletion.
+func (r *Notifier) ValidateDelete() error { return nil }
+
+func (r *Notifier) validateSpec() error {
+	s := r.Spec
+	if s.Webhook == nil && s.Slack == nil && s.SMTP == nil {
+		return fmt.Errorf("at least one of spec.webhook, spec.slack or spec.smtp must be specified")
+	}
+	for name, w := range map[string]*WebhookSink{"webhook": s.Webhook, "slack": s.Slack} {
+		if w == nil || w.URLSecret != nil {
+			continue
+		}
+		if w.URL == nil {
+			return fmt.Errorf("spec.%s.url or spec.%s.urlSecret must be specified", name, name)
+		}
+		u, err := url.Parse(*w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid URL %s on spec.%s.url", *w.URL, name)
+		}
+		if internalHost(u.Hostname()) {
+			return fmt.Errorf("spec.%s.url must not point to a loopback or link-local address: %s", name, u.Hostname())
+		}
+	}
+	if s.SMTP != nil && internalHost(s.SMTP.Host) {
+		return fmt.Errorf("spec.smtp.host must not be a loopback or link-local address: %s", s.SMTP.Host)
+	}
+	for name, t := range map[string]*string{"template": s.Template, "subject": s.Subject} {
+		if t == nil {
+			continue
+		}
+		if _, err := template.New(name).Parse(*t); err != nil {
+			return fmt.Errorf("invalid spec.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// internalHost returns true if host is localhost or a loopback, link-local or unspecified IP address.
+// Notifiers are sent by the controller, so such hosts would let users reach the controller itself,
+// the node or the metadata service of the cloud provider.
+// Names that resolve to such addresses are rejected by the controller when it connects.
+func internalHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified())
+}
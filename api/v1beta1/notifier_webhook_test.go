@@ -0,0 +1,30 @@
+package v1beta1
+
+import "testing"
+
+func Test_internalHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"hooks.slack.com", false},
+		{"10.0.0.1", false},
+		{"localhost", true},
+		{"LocalHost.", true},
+		{"foo.localhost", true},
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"::1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := internalHost(tt.host); got != tt.want {
+				t.Errorf("internalHost(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// LocalReference is a reference to a Secret or a ConfigMap in the same namespace.
+type LocalReference struct {
+	// Field is the path of the field e.g. "spec.gitCredentials".
+	Field string
+	// Kind is "Secret" or "ConfigMap".
+	Kind string
+	Name string
+}
+
+func (r LocalReference) String() string {
+	return fmt.Sprintf("%s %s %s", r.Field, r.Kind, r.Name)
+}
+
+// gitReferences returns references of the common fields of Repository and Collection.
+// ownedGitConfig is skipped as it is created by the controller.
+func gitReferences(imagePullSecret, gitConfig, gitCredentials *corev1.LocalObjectReference, ownedGitConfig string) []LocalReference {
+	var refs []LocalReference
+	if imagePullSecret != nil {
+		refs = append(refs, LocalReference{"spec.imagePullSecret", "Secret", imagePullSecret.Name})
+	}
+	if gitConfig != nil && gitConfig.Name != ownedGitConfig {
+		refs = append(refs, LocalReference{"spec.gitConfig", "ConfigMap", gitConfig.Name})
+	}
+	if gitCredentials != nil {
+		refs = append(refs, LocalReference{"spec.gitCredentials", "Secret", gitCredentials.Name})
+	}
+	return refs
+}
+
+// GetReferences returns the Secrets and ConfigMaps that r refers to.
+func (r Repository) GetReferences() []LocalReference {
+	refs := gitReferences(r.Spec.ImagePullSecret, r.Spec.GitConfig, r.Spec.GitCredentials, r.GetOwnedConfigMapName())
+	if enc := r.Spec.Encryption; enc != nil {
+		refs = append(refs,
+			LocalReference{"spec.encryption.publicKey", "Secret", enc.PublicKey.Name},
+			LocalReference{"spec.encryption.privateKey", "Secret", enc.PrivateKey.Name})
+	}
+	if md := r.Spec.Metadata; md != nil && md.Token != nil {
+		refs = append(refs, LocalReference{"spec.metadata.token", "Secret", md.Token.Name})
+	}
+	if f := r.Spec.DestinationForge; f != nil {
+		refs = append(refs, LocalReference{"spec.destinationForge.token", "Secret", f.Token.Name})
+	}
+	return refs
+}
+
+// GetReferences returns the Secrets and ConfigMaps that r refers to.
+func (r Collection) GetReferences() []LocalReference {
+	return gitReferences(r.Spec.ImagePullSecret, r.Spec.GitConfig, r.Spec.GitCredentials, r.GetOwnedConfigMapName())
+}
+
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+
+// MissingReferences returns refs that do not exist in ns.
+// Only the metadata of the objects is read so that the data of Secrets are not cached.
+func MissingReferences(ctx context.Context, c client.Reader, ns string, refs []LocalReference) ([]LocalReference, error) {
+	var missing []LocalReference
+	for _, ref := range refs {
+		obj := &metav1.PartialObjectMetadata{}
+		obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(ref.Kind))
+		err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: ref.Name}, obj)
+		if apierrors.IsNotFound(err) {
+			missing = append(missing, ref)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// referencesUser is implemented by types that refer to Secrets and ConfigMaps.
+type referencesUser interface {
+	client.Object
+	GetReferences() []LocalReference
+}
+
+// withReferenceWarnings returns a validating webhook for obj with v,
+// that warns if the Secrets and ConfigMaps the object refers to do not exist.
+// Missing references are not rejected since they may be created after the object.
+func withReferenceWarnings(obj referencesUser, v admission.CustomValidator, c client.Reader) *admission.Webhook {
+	return &admission.Webhook{
+		Handler: &referenceWarningHandler{
+			Handler: admission.WithCustomValidator(obj, v).Handler,
+			Reader:  c,
+			obj:     obj,
+		},
+	}
+}
+
+type referenceWarningHandler struct {
+	admission.Handler
+	client.Reader
+	obj     referencesUser
+	decoder *admission.Decoder
+}
+
+var _ admission.DecoderInjector = &referenceWarningHandler{}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (h *referenceWarningHandler) InjectDecoder(d *admission.Decoder) error {
+	h.decoder = d
+	_, err := admission.InjectDecoderInto(d, h.Handler)
+	return err
+}
+
+// Handle calls the validating handler and adds warnings if the request is allowed.
+func (h *referenceWarningHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	resp := h.Handler.Handle(ctx, req)
+	if !resp.Allowed || req.Operation == admissionv1.Delete {
+		return resp
+	}
+
+	obj := h.obj.DeepCopyObject().(referencesUser)
+	if err := h.decoder.Decode(req, obj); err != nil {
+		return resp
+	}
+	missing, err := MissingReferences(ctx, h.Reader, req.Namespace, obj.GetReferences())
+	if err != nil {
+		return resp.WithWarnings(fmt.Sprintf("unable to check references: %v", err))
+	}
+	warnings := make([]string, len(missing))
+	for i, ref := range missing {
+		warnings[i] = fmt.Sprintf("%s: %s %q not found; backups will not run until it is created", ref.Field, ref.Kind, ref.Name)
+	}
+	return resp.WithWarnings(warnings...)
+}
@@ -0,0 +1,98 @@
+package v1beta1_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+)
+
+func TestRepository_GetReferences(t *testing.T) {
+	repo := v1beta1.Repository{ObjectMeta: metav1.ObjectMeta{Name: "repo1", Namespace: "default"}}
+	owned := repo
+	owned.Spec.GitConfig = &corev1.LocalObjectReference{Name: repo.GetOwnedConfigMapName()}
+	all := repo
+	all.Spec.ImagePullSecret = &corev1.LocalObjectReference{Name: "pull"}
+	all.Spec.GitConfig = &corev1.LocalObjectReference{Name: "conf"}
+	all.Spec.GitCredentials = &corev1.LocalObjectReference{Name: "cred"}
+	secrets := repo
+	secrets.Spec.Encryption = &v1beta1.EncryptionSpec{
+		PublicKey:  corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "pub"}, Key: "key"},
+		PrivateKey: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "priv"}, Key: "key"},
+	}
+	secrets.Spec.Metadata = &v1beta1.MetadataSpec{
+		Token: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "token"}, Key: "token"},
+	}
+	secrets.Spec.DestinationForge = &v1beta1.DestinationForgeSpec{
+		Token: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "dst-token"}, Key: "token"},
+	}
+
+	tests := []struct {
+		name string
+		repo v1beta1.Repository
+		want []v1beta1.LocalReference
+	}{
+		{"none", repo, nil},
+		{"owned gitconfig", owned, nil},
+		{"all", all, []v1beta1.LocalReference{
+			{Field: "spec.imagePullSecret", Kind: "Secret", Name: "pull"},
+			{Field: "spec.gitConfig", Kind: "ConfigMap", Name: "conf"},
+			{Field: "spec.gitCredentials", Kind: "Secret", Name: "cred"},
+		}},
+		{"encryption and metadata", secrets, []v1beta1.LocalReference{
+			{Field: "spec.encryption.publicKey", Kind: "Secret", Name: "pub"},
+			{Field: "spec.encryption.privateKey", Kind: "Secret", Name: "priv"},
+			{Field: "spec.metadata.token", Kind: "Secret", Name: "token"},
+			{Field: "spec.destinationForge.token", Kind: "Secret", Name: "dst-token"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.repo.GetReferences(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetReferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingReferences(t *testing.T) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "cred", Namespace: "default"}}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "conf", Namespace: "default"}}
+	refSecret := v1beta1.LocalReference{Field: "spec.gitCredentials", Kind: "Secret", Name: "cred"}
+	refCM := v1beta1.LocalReference{Field: "spec.gitConfig", Kind: "ConfigMap", Name: "conf"}
+
+	tests := []struct {
+		name    string
+		objs    []runtime.Object
+		ns      string
+		refs    []v1beta1.LocalReference
+		want    []v1beta1.LocalReference
+		wantErr bool
+	}{
+		{"found", []runtime.Object{secret, cm}, "default", []v1beta1.LocalReference{refSecret, refCM}, nil, false},
+		{"not found", []runtime.Object{secret}, "default", []v1beta1.LocalReference{refSecret, refCM}, []v1beta1.LocalReference{refCM}, false},
+		{"other namespace", []runtime.Object{secret, cm}, "ns1", []v1beta1.LocalReference{refSecret}, []v1beta1.LocalReference{refSecret}, false},
+		{"kind mismatch", []runtime.Object{secret}, "default", []v1beta1.LocalReference{{Field: "spec.gitConfig", Kind: "ConfigMap", Name: "cred"}}, []v1beta1.LocalReference{{Field: "spec.gitConfig", Kind: "ConfigMap", Name: "cred"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithRuntimeObjects(tt.objs...).Build()
+
+			got, err := v1beta1.MissingReferences(context.Background(), c, tt.ns, tt.refs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MissingReferences() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MissingReferences() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+// ConversionDataAnnotation keeps the v1 spec of an object converted to v1beta1
+// if v1beta1 cannot represent it, so that the object is not changed when it is converted back to v1.
+const ConversionDataAnnotation = "gitbackup.ebiiim.com/conversion-data"
+
+var _ conversion.Convertible = &Repository{}
+
+// ConvertTo converts r to the hub version v1.
+//
+// Src, Dst and GitCredentials become spec.source and spec.destination with the same credentials,
+// and GitConfig of the ConfigMap created by the controller becomes nil.
+func (r *Repository) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1.Repository)
+	dst.ObjectMeta = *r.ObjectMeta.DeepCopy()
+	dst.Spec = repositorySpecTo(r.Spec, r.GetOwnedConfigMapName())
+	dst.Status = v1.RepositoryStatus{
+		Conditions:          r.Status.Conditions,
+		LastRun:             runStatusTo(r.Status.LastRun),
+		LastSuccessTime:     r.Status.LastSuccessTime,
+		LastDryRun:          runStatusTo(r.Status.LastDryRun),
+		ConsecutiveFailures: r.Status.ConsecutiveFailures,
+	}
+
+	var data v1.RepositorySpec
+	ok, err := popConversionData(&dst.ObjectMeta, &data)
+	if !ok || err != nil {
+		return err
+	}
+	// restore the fields that v1beta1 cannot represent unless they are changed in v1beta1
+	prev := repositorySpecFrom(data, r.GetOwnedConfigMapName())
+	if equality.Semantic.DeepEqual(prev.GitCredentials, r.Spec.GitCredentials) {
+		dst.Spec.Source.Credentials = data.Source.Credentials
+		dst.Spec.Destination.Credentials = data.Destination.Credentials
+	}
+	if equality.Semantic.DeepEqual(prev.GitConfig, r.Spec.GitConfig) {
+		dst.Spec.GitConfig = data.GitConfig
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version v1 to r.
+//
+// GitCredentials is the credentials of the source, or the destination if the source has no credentials.
+// If the v1 object cannot be represented in v1beta1, its spec is kept in ConversionDataAnnotation.
+func (r *Repository) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1.Repository)
+	r.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(r.Annotations, ConversionDataAnnotation)
+	r.Spec = repositorySpecFrom(src.Spec, r.GetOwnedConfigMapName())
+	r.Status = RepositoryStatus{
+		Conditions:          src.Status.Conditions,
+		LastRun:             runStatusFrom(src.Status.LastRun),
+		LastSuccessTime:     src.Status.LastSuccessTime,
+		LastDryRun:          runStatusFrom(src.Status.LastDryRun),
+		ConsecutiveFailures: src.Status.ConsecutiveFailures,
+	}
+
+	if equality.Semantic.DeepEqual(repositorySpecTo(r.Spec, r.GetOwnedConfigMapName()), src.Spec) {
+		return nil
+	}
+	return setConversionData(&r.ObjectMeta, src.Spec)
+}
+
+func repositorySpecTo(s RepositorySpec, ownedGitConfig string) v1.RepositorySpec {
+	creds := s.GitCredentials
+	return v1.RepositorySpec{
+		Source:             v1.GitRemote{URL: s.Src, Credentials: creds},
+		Destination:        v1.GitRemote{URL: s.Dst, Credentials: creds},
+		Schedule:           s.Schedule,
+		TimeZone:           s.TimeZone,
+		Suspend:            s.Suspend,
+		BackupClassName:    s.BackupClassName,
+		GitImage:           s.GitImage,
+		ImagePullSecret:    s.ImagePullSecret,
+		GitConfig:          gitConfigTo(s.GitConfig, ownedGitConfig),
+		PodOptions:         v1.PodOptions(s.PodOptions),
+		JobPolicy:          jobPolicyTo(s.JobPolicy),
+		Refs:               (*v1.RefsSpec)(s.Refs),
+		Encryption:         encryptionTo(s.Encryption),
+		Metadata:           metadataTo(s.Metadata),
+		Snapshots:          (*v1.SnapshotsSpec)(s.Snapshots),
+		DeletionPolicy:     (*v1.DeletionPolicy)(s.DeletionPolicy),
+		DestinationForge:   destinationForgeTo(s.DestinationForge),
+		DryRun:             s.DryRun,
+		OnDestinationDrift: (*v1.DriftPolicy)(s.OnDestinationDrift),
+		Notifications:      (*v1.NotificationsSpec)(s.Notifications),
+		MaxAge:             s.MaxAge,
+	}
+}
+
+func repositorySpecFrom(s v1.RepositorySpec, ownedGitConfig string) RepositorySpec {
+	return RepositorySpec{
+		Src:                s.Source.URL,
+		Dst:                s.Destination.URL,
+		Schedule:           s.Schedule,
+		TimeZone:           s.TimeZone,
+		Suspend:            s.Suspend,
+		BackupClassName:    s.BackupClassName,
+		GitImage:           s.GitImage,
+		ImagePullSecret:    s.ImagePullSecret,
+		GitConfig:          gitConfigFrom(s.GitConfig, ownedGitConfig),
+		GitCredentials:     credentialsFrom(s.Source.Credentials, s.Destination.Credentials),
+		PodOptions:         PodOptions(s.PodOptions),
+		JobPolicy:          jobPolicyFrom(s.JobPolicy),
+		Refs:               (*RefsSpec)(s.Refs),
+		Encryption:         encryptionFrom(s.Encryption),
+		Metadata:           metadataFrom(s.Metadata),
+		Snapshots:          (*SnapshotsSpec)(s.Snapshots),
+		DeletionPolicy:     (*DeletionPolicy)(s.DeletionPolicy),
+		DestinationForge:   destinationForgeFrom(s.DestinationForge),
+		DryRun:             s.DryRun,
+		OnDestinationDrift: (*DriftPolicy)(s.OnDestinationDrift),
+		Notifications:      (*NotificationsSpec)(s.Notifications),
+		MaxAge:             s.MaxAge,
+	}
+}
+
+// gitConfigTo returns nil if gitConfig is the ConfigMap created by the controller.
+func gitConfigTo(gitConfig *corev1.LocalObjectReference, owned string) *corev1.LocalObjectReference {
+	if gitConfig != nil && gitConfig.Name == owned {
+		return nil
+	}
+	return gitConfig
+}
+
+// gitConfigFrom returns the ConfigMap created by the controller if gitConfig is nil as the defaulting webhook does.
+func gitConfigFrom(gitConfig *corev1.LocalObjectReference, owned string) *corev1.LocalObjectReference {
+	if gitConfig == nil {
+		return &corev1.LocalObjectReference{Name: owned}
+	}
+	return gitConfig
+}
+
+// credentialsFrom returns src or dst if src is nil.
+func credentialsFrom(src, dst *corev1.LocalObjectReference) *corev1.LocalObjectReference {
+	if src != nil {
+		return src
+	}
+	return dst
+}
+
+func jobPolicyTo(p *JobPolicy) *v1.JobPolicy {
+	if p == nil {
+		return nil
+	}
+	return &v1.JobPolicy{
+		BackoffLimit:               p.BackoffLimit,
+		ActiveDeadlineSeconds:      p.ActiveDeadlineSeconds,
+		TTLSecondsAfterFinished:    p.TTLSecondsAfterFinished,
+		SuccessfulJobsHistoryLimit: p.SuccessfulJobsHistoryLimit,
+		FailedJobsHistoryLimit:     p.FailedJobsHistoryLimit,
+		ConcurrencyPolicy:          p.ConcurrencyPolicy,
+		StartingDeadlineSeconds:    p.StartingDeadlineSeconds,
+		Retry:                      (*v1.RetryPolicy)(p.Retry),
+	}
+}
+
+func jobPolicyFrom(p *v1.JobPolicy) *JobPolicy {
+	if p == nil {
+		return nil
+	}
+	return &JobPolicy{
+		BackoffLimit:               p.BackoffLimit,
+		ActiveDeadlineSeconds:      p.ActiveDeadlineSeconds,
+		TTLSecondsAfterFinished:    p.TTLSecondsAfterFinished,
+		SuccessfulJobsHistoryLimit: p.SuccessfulJobsHistoryLimit,
+		FailedJobsHistoryLimit:     p.FailedJobsHistoryLimit,
+		ConcurrencyPolicy:          p.ConcurrencyPolicy,
+		StartingDeadlineSeconds:    p.StartingDeadlineSeconds,
+		Retry:                      (*RetryPolicy)(p.Retry),
+	}
+}
+
+func encryptionTo(e *EncryptionSpec) *v1.EncryptionSpec {
+	if e == nil {
+		return nil
+	}
+	return &v1.EncryptionSpec{Type: v1.EncryptionType(e.Type), PublicKey: e.PublicKey, PrivateKey: e.PrivateKey}
+}
+
+func encryptionFrom(e *v1.EncryptionSpec) *EncryptionSpec {
+	if e == nil {
+		return nil
+	}
+	return &EncryptionSpec{Type: EncryptionType(e.Type), PublicKey: e.PublicKey, PrivateKey: e.PrivateKey}
+}
+
+func metadataTo(m *MetadataSpec) *v1.MetadataSpec {
+	if m == nil {
+		return nil
+	}
+	return &v1.MetadataSpec{
+		Forge:   v1.ForgeType(m.Forge),
+		APIURL:  m.APIURL,
+		Project: m.Project,
+		Token:   m.Token,
+		Ref:     m.Ref,
+		Image:   m.Image,
+	}
+}
+
+func metadataFrom(m *v1.MetadataSpec) *MetadataSpec {
+	if m == nil {
+		return nil
+	}
+	return &MetadataSpec{
+		Forge:   ForgeType(m.Forge),
+		APIURL:  m.APIURL,
+		Project: m.Project,
+		Token:   m.Token,
+		Ref:     m.Ref,
+		Image:   m.Image,
+	}
+}
+
+func destinationForgeTo(f *DestinationForgeSpec) *v1.DestinationForgeSpec {
+	if f == nil {
+		return nil
+	}
+	return &v1.DestinationForgeSpec{
+		Forge:   v1.ForgeType(f.Forge),
+		APIURL:  f.APIURL,
+		Project: f.Project,
+		Token:   f.Token,
+		Image:   f.Image,
+	}
+}
+
+func destinationForgeFrom(f *v1.DestinationForgeSpec) *DestinationForgeSpec {
+	if f == nil {
+		return nil
+	}
+	return &DestinationForgeSpec{
+		Forge:   ForgeType(f.Forge),
+		APIURL:  f.APIURL,
+		Project: f.Project,
+		Token:   f.Token,
+		Image:   f.Image,
+	}
+}
+
+func runStatusTo(s *RunStatus) *v1.RunStatus {
+	if s == nil {
+		return nil
+	}
+	return &v1.RunStatus{
+		JobName:        s.JobName,
+		Result:         v1.RunResult(s.Result),
+		CompletionTime: s.CompletionTime,
+		Attempts:       s.Attempts,
+		Reason:         v1.FailureReason(s.Reason),
+		Message:        s.Message,
+		Duration:       s.Duration,
+		Stats:          (*v1.RunStats)(s.Stats),
+		RefsDigest:     s.RefsDigest,
+		DryRun:         dryRunResultTo(s.DryRun),
+	}
+}
+
+func runStatusFrom(s *v1.RunStatus) *RunStatus {
+	if s == nil {
+		return nil
+	}
+	return &RunStatus{
+		JobName:        s.JobName,
+		Result:         RunResult(s.Result),
+		CompletionTime: s.CompletionTime,
+		Attempts:       s.Attempts,
+		Reason:         FailureReason(s.Reason),
+		Message:        s.Message,
+		Duration:       s.Duration,
+		Stats:          (*RunStats)(s.Stats),
+		RefsDigest:     s.RefsDigest,
+		DryRun:         dryRunResultFrom(s.DryRun),
+	}
+}
+
+func dryRunResultTo(r *DryRunResult) *v1.DryRunResult {
+	if r == nil {
+		return nil
+	}
+	out := &v1.DryRunResult{Created: r.Created, Updated: r.Updated, Deleted: r.Deleted}
+	for _, c := range r.Changes {
+		out.Changes = append(out.Changes, v1.RefChange{Type: v1.RefChangeType(c.Type), Ref: c.Ref})
+	}
+	return out
+}
+
+func dryRunResultFrom(r *v1.DryRunResult) *DryRunResult {
+	if r == nil {
+		return nil
+	}
+	out := &DryRunResult{Created: r.Created, Updated: r.Updated, Deleted: r.Deleted}
+	for _, c := range r.Changes {
+		out.Changes = append(out.Changes, RefChange{Type: RefChangeType(c.Type), Ref: c.Ref})
+	}
+	return out
+}
+
+// setConversionData sets data as JSON to ConversionDataAnnotation of meta.
+func setConversionData(meta *metav1.ObjectMeta, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("unable to marshal conversion data: %w", err)
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[ConversionDataAnnotation] = string(b)
+	return nil
+}
+
+// popConversionData removes ConversionDataAnnotation from meta and unmarshals it to data.
+// It returns false if meta does not have the annotation.
+func popConversionData(meta *metav1.ObjectMeta, data any) (bool, error) {
+	s, ok := meta.Annotations[ConversionDataAnnotation]
+	if !ok {
+		return false, nil
+	}
+	delete(meta.Annotations, ConversionDataAnnotation)
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+	if err := json.Unmarshal([]byte(s), data); err != nil {
+		return false, fmt.Errorf("unable to unmarshal conversion data: %w", err)
+	}
+	return true, nil
+}
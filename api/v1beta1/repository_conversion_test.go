@@ -0,0 +1,128 @@
+package v1beta1_test
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+)
+
+func TestRepository_ConvertFrom(t *testing.T) {
+	meta := metav1.ObjectMeta{Name: "repo1", Namespace: "default"}
+	owned := &corev1.LocalObjectReference{Name: "gitbackup-repository-repo1-gitconfig"}
+	cred := &corev1.LocalObjectReference{Name: "cred"}
+	src := &corev1.LocalObjectReference{Name: "src"}
+	dst := &corev1.LocalObjectReference{Name: "dst"}
+
+	tests := []struct {
+		name         string
+		in           v1.RepositorySpec
+		want         v1beta1.RepositorySpec
+		wantConvData bool
+	}{
+		{"minimal",
+			v1.RepositorySpec{Source: v1.GitRemote{URL: "https://example.com/src"}, Destination: v1.GitRemote{URL: "https://example.com/dst"}},
+			v1beta1.RepositorySpec{Src: "https://example.com/src", Dst: "https://example.com/dst", GitConfig: owned},
+			false},
+		{"same credentials",
+			v1.RepositorySpec{Source: v1.GitRemote{Credentials: cred}, Destination: v1.GitRemote{Credentials: cred}},
+			v1beta1.RepositorySpec{GitConfig: owned, GitCredentials: cred},
+			false},
+		{"source credentials",
+			v1.RepositorySpec{Source: v1.GitRemote{Credentials: src}, Destination: v1.GitRemote{Credentials: dst}},
+			v1beta1.RepositorySpec{GitConfig: owned, GitCredentials: src},
+			true},
+		{"destination credentials",
+			v1.RepositorySpec{Destination: v1.GitRemote{Credentials: dst}},
+			v1beta1.RepositorySpec{GitConfig: owned, GitCredentials: dst},
+			true},
+		{"owned gitconfig",
+			v1.RepositorySpec{GitConfig: owned},
+			v1beta1.RepositorySpec{GitConfig: owned},
+			true},
+		{"user gitconfig",
+			v1.RepositorySpec{GitConfig: &corev1.LocalObjectReference{Name: "conf"}},
+			v1beta1.RepositorySpec{GitConfig: &corev1.LocalObjectReference{Name: "conf"}},
+			false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := v1.Repository{ObjectMeta: meta, Spec: tt.in}
+			var got v1beta1.Repository
+			if err := got.ConvertFrom(&in); err != nil {
+				t.Fatalf("ConvertFrom() error = %v", err)
+			}
+			if !equality.Semantic.DeepEqual(got.Spec, tt.want) {
+				t.Errorf("ConvertFrom() = %+v, want %+v", got.Spec, tt.want)
+			}
+			if _, ok := got.Annotations[v1beta1.ConversionDataAnnotation]; ok != tt.wantConvData {
+				t.Errorf("ConvertFrom() has conversion data = %v, want %v", ok, tt.wantConvData)
+			}
+
+			// v1 -> v1beta1 -> v1 must not change the object
+			var back v1.Repository
+			if err := got.ConvertTo(&back); err != nil {
+				t.Fatalf("ConvertTo() error = %v", err)
+			}
+			if !equality.Semantic.DeepEqual(back.Spec, tt.in) {
+				t.Errorf("ConvertTo() = %+v, want %+v", back.Spec, tt.in)
+			}
+			if _, ok := back.Annotations[v1beta1.ConversionDataAnnotation]; ok {
+				t.Errorf("ConvertTo() has conversion data")
+			}
+		})
+	}
+}
+
+func TestRepository_ConvertTo(t *testing.T) {
+	meta := metav1.ObjectMeta{Name: "repo1", Namespace: "default"}
+	src := &corev1.LocalObjectReference{Name: "src"}
+	dst := &corev1.LocalObjectReference{Name: "dst"}
+	changed := &corev1.LocalObjectReference{Name: "changed"}
+	in := v1.RepositorySpec{
+		Source:      v1.GitRemote{URL: "https://example.com/src", Credentials: src},
+		Destination: v1.GitRemote{URL: "https://example.com/dst", Credentials: dst},
+	}
+
+	tests := []struct {
+		name   string
+		update func(*v1beta1.RepositorySpec)
+		want   v1.RepositorySpec
+	}{
+		{"not changed",
+			func(s *v1beta1.RepositorySpec) {},
+			in},
+		{"schedule changed",
+			func(s *v1beta1.RepositorySpec) { s.Schedule = "0 7 * * *" },
+			v1.RepositorySpec{Source: in.Source, Destination: in.Destination, Schedule: "0 7 * * *"}},
+		{"credentials changed",
+			func(s *v1beta1.RepositorySpec) { s.GitCredentials = changed },
+			v1.RepositorySpec{
+				Source:      v1.GitRemote{URL: "https://example.com/src", Credentials: changed},
+				Destination: v1.GitRemote{URL: "https://example.com/dst", Credentials: changed},
+			}},
+		{"gitconfig changed",
+			func(s *v1beta1.RepositorySpec) { s.GitConfig = &corev1.LocalObjectReference{Name: "conf"} },
+			v1.RepositorySpec{Source: in.Source, Destination: in.Destination, GitConfig: &corev1.LocalObjectReference{Name: "conf"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spoke v1beta1.Repository
+			if err := spoke.ConvertFrom(&v1.Repository{ObjectMeta: meta, Spec: in}); err != nil {
+				t.Fatalf("ConvertFrom() error = %v", err)
+			}
+			tt.update(&spoke.Spec)
+			var got v1.Repository
+			if err := spoke.ConvertTo(&got); err != nil {
+				t.Fatalf("ConvertTo() error = %v", err)
+			}
+			if !equality.Semantic.DeepEqual(got.Spec, tt.want) {
+				t.Errorf("ConvertTo() = %+v, want %+v", got.Spec, tt.want)
+			}
+		})
+	}
+}
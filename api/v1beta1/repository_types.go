@@ -1,25 +1,61 @@
 package v1beta1
 
 import (
-	"strings"
-
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
 )
 
 const (
-	OperatorName    = "gitbackup"
-	DefaultGitImage = "alpine/git:2.36.2"
+	OperatorName       = "gitbackup"
+	DefaultGitImage    = "alpine/git:2.36.2"
+	DefaultMetadataRef = "refs/gitbackup/metadata"
+
+	// SnapshotsRef is the prefix of snapshots. Each snapshot is stored as "{SnapshotsRef}/{ID}/{ref without "refs/"}".
+	SnapshotsRef = "refs/gitbackup/snapshots"
+	// SnapshotIDFormat is the time layout of snapshot IDs. IDs are in UTC and sort in time order.
+	SnapshotIDFormat = "20060102T150405Z"
 )
 
+// hub returns r as v1.Repository so that the names, the forge settings and the refspecs
+// are computed by the same code in the webhooks and the controllers.
+func (r Repository) hub() v1.Repository {
+	return v1.Repository{ObjectMeta: r.ObjectMeta, Spec: repositorySpecTo(r.Spec, "")}
+}
+
 // GetOwnedConfigMapName returns "gitbackup-repository-{r.Name}-gitconfig"
 func (r Repository) GetOwnedConfigMapName() string {
-	return strings.Join([]string{OperatorName, "repository", r.Name, "gitconfig"}, "-")
+	return r.hub().GetOwnedConfigMapName()
 }
 
-// GetOwnedCronJobName returns "gitbackup-{r.Name}"
+// GetOwnedCronJobName returns "gitbackup-{r.Name}" truncated to MaxCronJobNameLength by TruncateName.
 func (r Repository) GetOwnedCronJobName() string {
-	return strings.Join([]string{OperatorName, r.Name}, "-")
+	return r.hub().GetOwnedCronJobName()
+}
+
+// GetMetadataProject returns r.Spec.Metadata.Project or the path of r.Spec.Src without ".git" suffix.
+func (r Repository) GetMetadataProject() (string, error) {
+	return r.hub().GetMetadataProject()
+}
+
+// GetMetadataAPIURL returns r.Spec.Metadata.APIURL or the default API URL of the forge inferred from r.Spec.Src.
+// See v1.Repository.GetMetadataAPIURL.
+func (r Repository) GetMetadataAPIURL() (string, error) {
+	return r.hub().GetMetadataAPIURL()
+}
+
+// GetDestinationForgeProject returns r.Spec.DestinationForge.Project or the path of r.Spec.Dst without ".git" suffix.
+func (r Repository) GetDestinationForgeProject() (string, error) {
+	return r.hub().GetDestinationForgeProject()
+}
+
+// GetDestinationForgeAPIURL returns r.Spec.DestinationForge.APIURL or the default API URL of the forge inferred from r.Spec.Dst
+// in the same way as GetMetadataAPIURL.
+func (r Repository) GetDestinationForgeAPIURL() (string, error) {
+	return r.hub().GetDestinationForgeAPIURL()
 }
 
 // RepositorySpec defines the desired state of Repository
@@ -35,6 +71,13 @@ type RepositorySpec struct {
 	// See also: https://kubernetes.io/docs/concepts/workloads/controllers/cron-jobs/#time-zones
 	// +optional
 	TimeZone *string `json:"timeZone,omitempty"`
+	// Suspend specifies to stop scheduling backups. Jobs that have already started are not stopped.
+	// +optional
+	Suspend *bool `json:"suspend,omitempty"`
+
+	// BackupClassName specifies the BackupClass to take defaults from. (default: the default BackupClass if exists)
+	// +optional
+	BackupClassName *string `json:"backupClassName,omitempty"`
 
 	// GitImage specifies the container image to run.
 	// +optional
@@ -50,17 +93,419 @@ type RepositorySpec struct {
 	// GitCredentials specifies the name of the Secret in the same namespace used to mount .git-credentials
 	// +optional
 	GitCredentials *corev1.LocalObjectReference `json:"gitCredentials,omitempty"`
+
+	PodOptions `json:",inline"`
+
+	// JobPolicy specifies how the CronJob runs the backup Jobs.
+	// +optional
+	JobPolicy *JobPolicy `json:"jobPolicy,omitempty"`
+
+	// Refs specifies refs to backup. All refs are mirrored if not specified.
+	// +optional
+	Refs *RefsSpec `json:"refs,omitempty"`
+
+	// Encryption specifies how to encrypt the backup pushed to the destination.
+	// +optional
+	Encryption *EncryptionSpec `json:"encryption,omitempty"`
+
+	// Metadata specifies how to export forge metadata (issues, pull requests, releases, etc.) as JSON.
+	// +optional
+	Metadata *MetadataSpec `json:"metadata,omitempty"`
+
+	// Snapshots specifies to keep the refs of each backup as a snapshot in the destination
+	// so that a Restore can restore the refs as of a point in time.
+	// +optional
+	Snapshots *SnapshotsSpec `json:"snapshots,omitempty"`
+
+	// DeletionPolicy specifies what to do with the backup in the destination when the Repository is deleted. (default: Retain)
+	// +optional
+	DeletionPolicy *DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// DestinationForge specifies the forge API of the destination repository to archive or delete it on deletion.
+	// +optional
+	DestinationForge *DestinationForgeSpec `json:"destinationForge,omitempty"`
+
+	// DryRun specifies that the backup Jobs only compare the refs in the source and the destination
+	// and report the refs that would be created, updated or deleted without pushing.
+	// +optional
+	DryRun *bool `json:"dryRun,omitempty"`
+
+	// OnDestinationDrift specifies what to do if refs in the destination have been changed
+	// by others since the last backup. (default: Overwrite)
+	// +optional
+	OnDestinationDrift *DriftPolicy `json:"onDestinationDrift,omitempty"`
+
+	// Notifications specifies Notifiers to invoke when the results of backups change.
+	// +optional
+	Notifications *NotificationsSpec `json:"notifications,omitempty"`
+
+	// MaxAge specifies how old the latest successful backup can be before the Repository is considered stale.
+	// The controller sets the Stale condition and records a Warning event when it is exceeded
+	// e.g. because the CronJob has stopped scheduling Jobs. Set it longer than the interval of Schedule.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// RefsSpec defines refs to fetch from the source and push to the destination.
+// Patterns are the same as the source side of refspecs e.g. "refs/heads/*".
+// Refs in the destination that match Include but not Exclude are deleted if they are deleted in the source.
+type RefsSpec struct {
+	// Include specifies patterns of refs to backup. (default: ["refs/*"])
+	// +optional
+	Include []string `json:"include,omitempty"`
+	// Exclude specifies patterns of refs not to backup e.g. "refs/pull/*".
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// GetRefspecs returns refspecs generated from r.Spec.Refs e.g. ["+refs/heads/*:refs/heads/*", "^refs/pull/*"]
+// or nil if r.Spec.Refs is not specified.
+func (r Repository) GetRefspecs() []string {
+	return r.hub().GetRefspecs()
+}
+
+// EncryptionType is the type of encryption.
+// +kubebuilder:validation:Enum=OpenPGP
+type EncryptionType string
+
+const (
+	// EncryptionOpenPGP pushes to the destination with git-remote-gcrypt so that the destination only stores OpenPGP-encrypted data.
+	// Note that GitImage must contain git-remote-gcrypt and gpg.
+	EncryptionOpenPGP EncryptionType = "OpenPGP"
+)
+
+// EncryptionSpec defines keys to encrypt backups at rest.
+type EncryptionSpec struct {
+	// Type specifies the encryption method. Only OpenPGP is supported as git-remote-gcrypt encrypts with gpg.
+	// Jobs fail without pushing if the keys are not ASCII-armored OpenPGP keys (e.g. age keys).
+	Type EncryptionType `json:"type"`
+	// PublicKey specifies the key of the Secret in the same namespace that contains ASCII-armored public keys of the recipients.
+	PublicKey corev1.SecretKeySelector `json:"publicKey"`
+	// PrivateKey specifies the key of the Secret in the same namespace that contains an ASCII-armored private key.
+	// It is used to sign and to read the encrypted destination on backups, and to decrypt it on restores.
+	PrivateKey corev1.SecretKeySelector `json:"privateKey"`
+}
+
+// ForgeType is the type of the forge that hosts a repository.
+// +kubebuilder:validation:Enum=GitHub;GitLab;Gitea
+type ForgeType string
+
+const (
+	ForgeGitHub ForgeType = "GitHub"
+	ForgeGitLab ForgeType = "GitLab"
+	ForgeGitea  ForgeType = "Gitea"
+)
+
+// MetadataSpec defines how to export forge metadata.
+// The exported JSON files are committed to `Ref` and pushed to the destination repository together with the mirror.
+type MetadataSpec struct {
+	// Forge specifies the type of the forge that hosts the source repository.
+	Forge ForgeType `json:"forge"`
+	// APIURL specifies the base URL of the forge API. (default: inferred from `Src`)
+	// +optional
+	APIURL *string `json:"apiURL,omitempty"`
+	// Project specifies the path of the project on the forge e.g. "owner/name". (default: inferred from `Src`)
+	// +optional
+	Project *string `json:"project,omitempty"`
+	// Token specifies the key of the Secret in the same namespace that contains an API token.
+	// +optional
+	Token *corev1.SecretKeySelector `json:"token,omitempty"`
+
+	// Ref specifies the ref in the destination repository to commit the metadata to.
+	// It must be under "refs/gitbackup/" and not under the snapshots, drift or state refs. (default: "refs/gitbackup/metadata")
+	// +optional
+	Ref *string `json:"ref,omitempty"`
+	// Image specifies the container image to export metadata. (default: the controller image)
+	// +optional
+	Image *string `json:"image,omitempty"`
+}
+
+// SnapshotsSpec defines how to keep snapshots.
+// Snapshots are refs under SnapshotsRef so note that the number of refs grows with every backup.
+type SnapshotsSpec struct {
+	// Keep specifies the number of the latest snapshots to keep. All snapshots are kept if not specified.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Keep *int32 `json:"keep,omitempty"`
+}
+
+// DeletionPolicy is what to do with the backup when the Repository is deleted.
+// +kubebuilder:validation:Enum=Retain;Delete;Archive
+type DeletionPolicy string
+
+const (
+	// DeletionRetain keeps the backup.
+	DeletionRetain DeletionPolicy = "Retain"
+	// DeletionDelete deletes the destination repository via the forge API if DestinationForge is specified.
+	// Otherwise, it deletes all refs in the destination including snapshots and metadata with git,
+	// except the default branch that forges refuse to delete.
+	DeletionDelete DeletionPolicy = "Delete"
+	// DeletionArchive archives the destination repository via the forge API. DestinationForge is required.
+	DeletionArchive DeletionPolicy = "Archive"
+)
+
+// DriftPolicy is what to do with refs in the destination that have been changed since the last backup.
+// +kubebuilder:validation:Enum=Overwrite;Fail;PreserveUnderRef
+type DriftPolicy string
+
+const (
+	// DriftOverwrite pushes without checking the destination.
+	DriftOverwrite DriftPolicy = "Overwrite"
+	// DriftFail fails the backup Job without pushing.
+	DriftFail DriftPolicy = "Fail"
+	// DriftPreserveUnderRef saves the changed refs whose commits would be discarded by the push
+	// under "refs/gitbackup/drift/{ID}/" and then pushes. IDs are in the same format as snapshot IDs.
+	DriftPreserveUnderRef DriftPolicy = "PreserveUnderRef"
+)
+
+// NotificationsSpec defines when to invoke which Notifiers.
+// Notifications are sent when a backup fails after a succeeded one (or the first backup fails)
+// and when a backup succeeds after a failed one.
+type NotificationsSpec struct {
+	// Notifiers specifies the names of the Notifiers in the same namespace.
+	// +kubebuilder:validation:MinItems=1
+	Notifiers []corev1.LocalObjectReference `json:"notifiers"`
+	// ConsecutiveFailures additionally notifies when backups fail this number of times in a row.
+	// +kubebuilder:validation:Minimum=2
+	// +optional
+	ConsecutiveFailures *int32 `json:"consecutiveFailures,omitempty"`
+}
+
+// DestinationForgeSpec defines the forge API of the destination repository.
+type DestinationForgeSpec struct {
+	// Forge specifies the type of the forge that hosts the destination repository.
+	Forge ForgeType `json:"forge"`
+	// APIURL specifies the base URL of the forge API. (default: inferred from `Dst`)
+	// +optional
+	APIURL *string `json:"apiURL,omitempty"`
+	// Project specifies the path of the project on the forge e.g. "owner/name". (default: inferred from `Dst`)
+	// +optional
+	Project *string `json:"project,omitempty"`
+	// Token specifies the key of the Secret in the same namespace that contains an API token
+	// with the permission to archive or delete the project.
+	Token corev1.SecretKeySelector `json:"token"`
+	// Image specifies the container image to call the forge API. (default: the controller image)
+	// +optional
+	Image *string `json:"image,omitempty"`
+}
+
+// PodOptions specifies the pod of the backup Jobs.
+type PodOptions struct {
+	// Resources specifies the compute resources of the containers.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// NodeSelector specifies the node selector of the pod.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations specifies the tolerations of the pod.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Affinity specifies the scheduling constraints of the pod.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// ServiceAccountName specifies the ServiceAccount in the same namespace to run the pod.
+	// +optional
+	ServiceAccountName *string `json:"serviceAccountName,omitempty"`
+	// PriorityClassName specifies the PriorityClass of the pod.
+	// +optional
+	PriorityClassName *string `json:"priorityClassName,omitempty"`
+	// PodSecurityContext specifies the security context of the pod.
+	// (default: run as user 65532 with the RuntimeDefault seccomp profile)
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// SecurityContext specifies the security context of the containers.
+	// (default: read-only root filesystem, no privilege escalation and no capabilities)
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+}
+
+// JobPolicy specifies the CronJob and Job settings of backups.
+type JobPolicy struct {
+	// BackoffLimit specifies the number of retries before marking the Job failed. (default: 6)
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+	// ActiveDeadlineSeconds specifies the duration in seconds a Job may run before it is terminated.
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// TTLSecondsAfterFinished specifies the duration in seconds to keep finished Jobs. (default: 360000)
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// SuccessfulJobsHistoryLimit specifies the number of successful Jobs to keep. (default: 3)
+	// +optional
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// FailedJobsHistoryLimit specifies the number of failed Jobs to keep. (default: 1)
+	// +optional
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+	// ConcurrencyPolicy specifies how to treat a Job that starts while the previous one is running. (default: Replace)
+	// +optional
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	ConcurrencyPolicy *batchv1.ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+	// StartingDeadlineSeconds specifies the deadline in seconds to start a Job that missed its scheduled time. (default: 14400)
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+	// Retry specifies how to retry git commands that fail with transient errors (DNS, connection and 5xx errors) in a Job.
+	// +optional
+	Retry *RetryPolicy `json:"retry,omitempty"`
+}
+
+// RetryPolicy specifies retries with exponential backoff in a backup Job.
+type RetryPolicy struct {
+	// Attempts specifies the maximum number of attempts of each git command. 1 disables retries. (default: 3)
+	// +optional
+	Attempts *int32 `json:"attempts,omitempty"`
+	// InitialDelaySeconds specifies the delay before the first retry. The delay doubles on each retry. (default: 10)
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+	// MaxDelaySeconds specifies the maximum delay between retries. (default: 300)
+	// +optional
+	MaxDelaySeconds *int32 `json:"maxDelaySeconds,omitempty"`
+}
+
+const (
+	// ConditionReferencesResolved is True if all Secrets and ConfigMaps the Repository refers to exist.
+	ConditionReferencesResolved = "ReferencesResolved"
+
+	// ReferencesHashAnnotation is set to the pod template of the CronJob with a hash of the contents of
+	// the Secrets and ConfigMaps the Repository refers to.
+	ReferencesHashAnnotation = "gitbackup.ebiiim.com/references-hash"
+)
+
+// RunResult is the result of a backup Job.
+type RunResult string
+
+const (
+	RunSucceeded RunResult = "Succeeded"
+	RunFailed    RunResult = "Failed"
+)
+
+// FailureReason is the classified reason of a failed backup Job.
+type FailureReason string
+
+const (
+	// FailureTransient is a DNS, connection or 5xx error that remained after retries.
+	FailureTransient FailureReason = "Transient"
+	// FailureAuth is an authentication or authorization error.
+	FailureAuth FailureReason = "Auth"
+	// FailureNotFound is a repository that does not exist.
+	FailureNotFound FailureReason = "NotFound"
+	// FailureDrift is refs in the destination changed by others with OnDestinationDrift Fail.
+	FailureDrift FailureReason = "Drift"
+	// FailurePolicy is a git config that rewrites URLs in a namespace whose URLs are restricted by BackupPolicies.
+	FailurePolicy FailureReason = "Policy"
+	// FailureUnknown is any other error e.g. the Job exceeded its deadline.
+	FailureUnknown FailureReason = "Unknown"
+)
+
+// RunStatus is the result of a finished backup Job.
+type RunStatus struct {
+	// JobName is the name of the Job.
+	JobName string `json:"jobName"`
+	// Result is Succeeded or Failed.
+	Result RunResult `json:"result"`
+	// CompletionTime is when the Job succeeded or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Attempts is the largest number of attempts of a git command in the Job. 1 means no retries.
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+	// Reason is the classified reason of the failure.
+	// +optional
+	Reason FailureReason `json:"reason,omitempty"`
+	// Message is the last error message of the failure.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Duration is how long the Job ran.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// Stats is the statistics of the backup reported by a succeeded backup Job.
+	// +optional
+	Stats *RunStats `json:"stats,omitempty"`
+	// RefsDigest is the SHA-256 digest of the list of refs pushed to "refs/gitbackup/state".
+	// It is recorded if OnDestinationDrift is not Overwrite to detect changes by others on the next backup.
+	// +optional
+	RefsDigest string `json:"refsDigest,omitempty"`
+	// DryRun is the difference between the source and the destination found by a dry-run Job.
+	// +optional
+	DryRun *DryRunResult `json:"dryRun,omitempty"`
+}
+
+// RunStats is the statistics of the backup pushed by a backup Job.
+type RunStats struct {
+	// Refs is the number of refs pushed to the destination except the ones used by gitbackup itself.
+	Refs int32 `json:"refs"`
+	// DefaultBranch is the default branch of the source.
+	// +optional
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+	// HeadCommit is the commit of the default branch.
+	// +optional
+	HeadCommit string `json:"headCommit,omitempty"`
+	// Size is the total size of the objects in the backup.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+}
+
+// RefChangeType is how a ref in the destination would be changed by a backup.
+// +kubebuilder:validation:Enum=Created;Updated;Deleted
+type RefChangeType string
+
+const (
+	RefCreated RefChangeType = "Created"
+	RefUpdated RefChangeType = "Updated"
+	RefDeleted RefChangeType = "Deleted"
+)
+
+// RefChange is a ref in the destination that would be changed by a backup.
+type RefChange struct {
+	// Type is Created, Updated or Deleted.
+	Type RefChangeType `json:"type"`
+	// Ref is the name of the ref e.g. "refs/heads/main".
+	Ref string `json:"ref"`
+}
+
+// DryRunResult is the number of refs that would be changed in the destination by a backup.
+// Refs used by gitbackup itself (refs/gitbackup/*) are not compared.
+type DryRunResult struct {
+	Created int32 `json:"created"`
+	Updated int32 `json:"updated"`
+	Deleted int32 `json:"deleted"`
+	// Changes lists the first changed refs in name order. See the logs of the Job for all changes.
+	// +optional
+	Changes []RefChange `json:"changes,omitempty"`
 }
 
 // RepositoryStatus defines the observed state of Repository
 type RepositoryStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Conditions represent the latest available observations of the Repository.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// LastRun is the result of the latest finished backup Job.
+	// +optional
+	LastRun *RunStatus `json:"lastRun,omitempty"`
+	// LastSuccessTime is when the latest succeeded backup Job finished.
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+	// LastDryRun is the result of the latest finished dry-run Job.
+	// +optional
+	LastDryRun *RunStatus `json:"lastDryRun,omitempty"`
+	// ConsecutiveFailures is the number of backup Jobs that have failed in a row.
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
-//+kubebuilder:resource:shortName=repo;repos
+//+kubebuilder:resource:shortName=repo;repos,categories=gitbackup
+//+kubebuilder:printcolumn:name="Src",type=string,JSONPath=`.spec.src`
+//+kubebuilder:printcolumn:name="Dst",type=string,JSONPath=`.spec.dst`
+//+kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Suspended",type=boolean,JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="Last Success",type=date,JSONPath=`.status.lastSuccessTime`
+//+kubebuilder:printcolumn:name="Last Result",type=string,JSONPath=`.status.lastRun.result`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+//+kubebuilder:printcolumn:name="Commit",type=string,JSONPath=`.status.lastRun.stats.headCommit`,priority=1
+//+kubebuilder:printcolumn:name="Size",type=string,JSONPath=`.status.lastRun.stats.size`,priority=1
 
 // Repository is the Schema for the repositories API
 type Repository struct {
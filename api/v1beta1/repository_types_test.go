@@ -1,9 +1,12 @@
 package v1beta1_test
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
 
 	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
 )
@@ -52,6 +55,7 @@ func TestRepository_GetOwnedCronJobName(t *testing.T) {
 	}{
 		{"a", fields{ObjectMeta: metav1.ObjectMeta{Name: "a"}}, "gitbackup-a"},
 		{"b-c", fields{ObjectMeta: metav1.ObjectMeta{Name: "b-c"}}, "gitbackup-b-c"},
+		{"long", fields{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 50)}}, "gitbackup-aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-dc66fb31"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -67,3 +71,121 @@ func TestRepository_GetOwnedCronJobName(t *testing.T) {
 		})
 	}
 }
+
+func TestRepository_GetMetadataProject(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    v1beta1.RepositorySpec
+		want    string
+		wantErr bool
+	}{
+		{"https", v1beta1.RepositorySpec{Src: "https://github.com/ebiiim/gitbackup"}, "ebiiim/gitbackup", false},
+		{"https .git", v1beta1.RepositorySpec{Src: "https://gitlab.com/group/sub/repo.git"}, "group/sub/repo", false},
+		{"specified", v1beta1.RepositorySpec{Src: "git@github.com:foo/bar", Metadata: &v1beta1.MetadataSpec{Project: pointer.String("foo/bar")}}, "foo/bar", false},
+		{"scp-like", v1beta1.RepositorySpec{Src: "git@github.com:foo/bar"}, "", true},
+		{"no owner", v1beta1.RepositorySpec{Src: "https://example.com/foo"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1beta1.Repository{Spec: tt.spec}
+			got, err := r.GetMetadataProject()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Repository.GetMetadataProject() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Repository.GetMetadataProject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_GetMetadataAPIURL(t *testing.T) {
+	md := func(f v1beta1.ForgeType) *v1beta1.MetadataSpec { return &v1beta1.MetadataSpec{Forge: f} }
+	tests := []struct {
+		name    string
+		spec    v1beta1.RepositorySpec
+		want    string
+		wantErr bool
+	}{
+		{"github.com", v1beta1.RepositorySpec{Src: "https://github.com/a/b", Metadata: md(v1beta1.ForgeGitHub)}, "https://api.github.com", false},
+		{"GHES", v1beta1.RepositorySpec{Src: "https://ghe.example.com/a/b", Metadata: md(v1beta1.ForgeGitHub)}, "https://ghe.example.com/api/v3", false},
+		{"GitLab", v1beta1.RepositorySpec{Src: "https://gitlab.com/a/b", Metadata: md(v1beta1.ForgeGitLab)}, "https://gitlab.com/api/v4", false},
+		{"Gitea", v1beta1.RepositorySpec{Src: "http://gitea.local:3000/a/b", Metadata: md(v1beta1.ForgeGitea)}, "http://gitea.local:3000/api/v1", false},
+		{"specified", v1beta1.RepositorySpec{Src: "git@example.com:a/b", Metadata: &v1beta1.MetadataSpec{Forge: v1beta1.ForgeGitea, APIURL: pointer.String("https://example.com/api/v1")}}, "https://example.com/api/v1", false},
+		{"ssh", v1beta1.RepositorySpec{Src: "ssh://git@example.com/a/b", Metadata: md(v1beta1.ForgeGitHub)}, "", true},
+		{"unknown forge", v1beta1.RepositorySpec{Src: "https://example.com/a/b", Metadata: md("Foo")}, "", true},
+		{"no metadata", v1beta1.RepositorySpec{Src: "https://example.com/a/b"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1beta1.Repository{Spec: tt.spec}
+			got, err := r.GetMetadataAPIURL()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Repository.GetMetadataAPIURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Repository.GetMetadataAPIURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_GetDestinationForge(t *testing.T) {
+	f := func(forge v1beta1.ForgeType) *v1beta1.DestinationForgeSpec {
+		return &v1beta1.DestinationForgeSpec{Forge: forge}
+	}
+	tests := []struct {
+		name        string
+		spec        v1beta1.RepositorySpec
+		wantProject string
+		wantAPIURL  string
+		wantErr     bool
+	}{
+		{"github.com", v1beta1.RepositorySpec{Dst: "https://github.com/a/b.git", DestinationForge: f(v1beta1.ForgeGitHub)}, "a/b", "https://api.github.com", false},
+		{"GitLab", v1beta1.RepositorySpec{Dst: "https://gitlab.example.com/g/a/b", DestinationForge: f(v1beta1.ForgeGitLab)}, "g/a/b", "https://gitlab.example.com/api/v4", false},
+		{"specified", v1beta1.RepositorySpec{Dst: "git@example.com:a/b", DestinationForge: &v1beta1.DestinationForgeSpec{
+			Forge: v1beta1.ForgeGitea, APIURL: pointer.String("https://example.com/api/v1"), Project: pointer.String("a/b")}}, "a/b", "https://example.com/api/v1", false},
+		{"scp-like", v1beta1.RepositorySpec{Dst: "git@example.com:a/b", DestinationForge: f(v1beta1.ForgeGitHub)}, "", "", true},
+		{"no forge", v1beta1.RepositorySpec{Dst: "https://github.com/a/b"}, "a/b", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1beta1.Repository{Spec: tt.spec}
+			project, err1 := r.GetDestinationForgeProject()
+			apiURL, err2 := r.GetDestinationForgeAPIURL()
+			if gotErr := err1 != nil || err2 != nil; gotErr != tt.wantErr {
+				t.Errorf("Repository.GetDestinationForge*() error = %v %v, wantErr %v", err1, err2, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if project != tt.wantProject || apiURL != tt.wantAPIURL {
+				t.Errorf("Repository.GetDestinationForge*() = %v %v, want %v %v", project, apiURL, tt.wantProject, tt.wantAPIURL)
+			}
+		})
+	}
+}
+
+func TestRepository_GetRefspecs(t *testing.T) {
+	tests := []struct {
+		name string
+		refs *v1beta1.RefsSpec
+		want []string
+	}{
+		{"nil", nil, nil},
+		{"include", &v1beta1.RefsSpec{Include: []string{"refs/heads/*", "refs/tags/*"}}, []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}},
+		{"exclude", &v1beta1.RefsSpec{Exclude: []string{"refs/pull/*"}}, []string{"+refs/*:refs/*", "^refs/pull/*"}},
+		{"both", &v1beta1.RefsSpec{Include: []string{"refs/heads/*"}, Exclude: []string{"refs/heads/tmp-*"}}, []string{"+refs/heads/*:refs/heads/*", "^refs/heads/tmp-*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1beta1.Repository{Spec: v1beta1.RepositorySpec{Refs: tt.refs}}
+			if got := r.GetRefspecs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Repository.GetRefspecs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,32 +1,54 @@
 package v1beta1
 
 import (
-	"errors"
+	"fmt"
 	"strings"
+	"time"
+	// embed the TZ database as the manager image may not have one
+	_ "time/tzdata"
 
 	cron "github.com/robfig/cron/v3"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
 )
 
 // log is for logging in this package.
 var repositorylog = logf.Log.WithName("repository-resource")
 
 func (r *Repository) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// register the validating webhook first so that the builder does not register another one on the path
+	mgr.GetWebhookServer().Register("/validate-gitbackup-ebiiim-com-v1beta1-repository",
+		withReferenceWarnings(r, &backupPolicyValidator{Reader: mgr.GetClient()}, mgr.GetClient()))
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(r).
+		WithDefaulter(&backupClassDefaulter{Reader: mgr.GetClient()}).
 		Complete()
 }
 
+func (r *Repository) getBackupClassName() *string { return r.Spec.BackupClassName }
+
+// applyBackupClass sets BackupClassName to cls and fills unspecified fields from cls.
+func (r *Repository) applyBackupClass(cls BackupClass) {
+	r.Spec.BackupClassName = &cls.Name
+	cls.Spec.fill(&r.Spec.TimeZone, &r.Spec.GitImage, &r.Spec.ImagePullSecret, &r.Spec.GitConfig, &r.Spec.GitCredentials,
+		&r.Spec.PodOptions, &r.Spec.JobPolicy)
+}
+
 //+kubebuilder:webhook:path=/mutate-gitbackup-ebiiim-com-v1beta1-repository,mutating=true,failurePolicy=fail,sideEffects=None,groups=gitbackup.ebiiim.com,resources=repositories,verbs=create;update,versions=v1beta1,name=mrepository.kb.io,admissionReviewVersions=v1
 
 var _ webhook.Defaulter = &Repository{}
 
 // Default implements webhook.Defaulter so a webhook will be registered for the type
+// NOTE: the webhook is registered with backupClassDefaulter that calls Default after applying the BackupClass.
 func (r *Repository) Default() {
 	repositorylog.Info("default", "name", r.Name)
 
@@ -36,6 +58,10 @@ func (r *Repository) Default() {
 	if r.Spec.GitConfig == nil {
 		r.Spec.GitConfig = &corev1.LocalObjectReference{Name: r.GetOwnedConfigMapName()}
 	}
+	// Metadata.Image and DestinationForge.Image are resolved by the controller so that they follow its upgrades.
+	if r.Spec.Metadata != nil && r.Spec.Metadata.Ref == nil {
+		r.Spec.Metadata.Ref = pointer.String(DefaultMetadataRef)
+	}
 }
 
 // NOTE: change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
@@ -43,63 +69,214 @@ func (r *Repository) Default() {
 
 var _ webhook.Validator = &Repository{}
 
+func (r *Repository) getURLs() (srcs, dsts []string) {
+	return []string{r.Spec.Src}, []string{r.Spec.Dst}
+}
+
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+// NOTE: the webhook is registered with backupPolicyValidator that calls the methods of webhook.Validator before checking BackupPolicies.
 func (r *Repository) ValidateCreate() error {
 	repositorylog.Info("validate create", "name", r.Name)
 
-	if err := r.validateCron(); err != nil {
-		return err
-	}
-	if err := r.validateURL(); err != nil {
-		return err
-	}
-
-	return nil
+	return r.validateSpec()
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
 func (r *Repository) ValidateUpdate(old runtime.Object) error {
 	repositorylog.Info("validate update", "name", r.Name)
 
-	if err := r.validateCron(); err != nil {
-		return err
-	}
-	if err := r.validateURL(); err != nil {
-		return err
-	}
-
-	return nil
+	return r.validateSpec()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
 // NOTE: nothing to validate upon object deletion.
 func (r *Repository) ValidateDelete() error { return nil }
 
-func (r *Repository) validateCron() error {
-	_, err := cron.ParseStandard(r.Spec.Schedule)
-	return err
+// Ranges of JobPolicy fields.
+const (
+	maxBackoffLimit            = 10
+	minActiveDeadlineSeconds   = 60
+	maxActiveDeadlineSeconds   = 7 * 24 * 3600
+	maxTTLSecondsAfterFinished = 30 * 24 * 3600
+	maxJobsHistoryLimit        = 100
+	// the CronJob controller checks schedules every 10 seconds
+	minStartingDeadlineSeconds = 10
+	maxStartingDeadlineSeconds = 24 * 3600
+	maxRetryAttempts           = 10
+	maxRetryDelaySeconds       = 3600
+)
+
+// validateTimeZone tests if tz is a name in the TZ database.
+func validateTimeZone(tz *string, fldPath *field.Path) field.ErrorList {
+	if tz == nil {
+		return nil
+	}
+	// LoadLocation accepts "" and "Local" but CronJobs do not
+	if *tz == "" || *tz == "Local" {
+		return field.ErrorList{field.Invalid(fldPath, *tz, "must be a name in the TZ database")}
+	}
+	if _, err := time.LoadLocation(*tz); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, *tz, err.Error())}
+	}
+	return nil
 }
 
-func (r *Repository) validateURL() error {
-	if !isValidURLSet(r.Spec.Src, r.Spec.Dst) {
-		return errors.New("invalid src or dst URL")
+// validateJobPolicy tests if the fields of p are in sane ranges.
+func validateJobPolicy(p *JobPolicy, fldPath *field.Path) field.ErrorList {
+	if p == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	inRange := func(fldPath *field.Path, v *int64, min, max int64) {
+		if v != nil && (*v < min || *v > max) {
+			errs = append(errs, field.Invalid(fldPath, *v, fmt.Sprintf("must be between %d and %d", min, max)))
+		}
+	}
+	int64p := func(v *int32) *int64 {
+		if v == nil {
+			return nil
+		}
+		i := int64(*v)
+		return &i
+	}
+	inRange(fldPath.Child("backoffLimit"), int64p(p.BackoffLimit), 0, maxBackoffLimit)
+	inRange(fldPath.Child("activeDeadlineSeconds"), p.ActiveDeadlineSeconds, minActiveDeadlineSeconds, maxActiveDeadlineSeconds)
+	inRange(fldPath.Child("ttlSecondsAfterFinished"), int64p(p.TTLSecondsAfterFinished), 0, maxTTLSecondsAfterFinished)
+	inRange(fldPath.Child("successfulJobsHistoryLimit"), int64p(p.SuccessfulJobsHistoryLimit), 0, maxJobsHistoryLimit)
+	inRange(fldPath.Child("failedJobsHistoryLimit"), int64p(p.FailedJobsHistoryLimit), 0, maxJobsHistoryLimit)
+	inRange(fldPath.Child("startingDeadlineSeconds"), p.StartingDeadlineSeconds, minStartingDeadlineSeconds, maxStartingDeadlineSeconds)
+	if c := p.ConcurrencyPolicy; c != nil {
+		switch *c {
+		case batchv1.AllowConcurrent, batchv1.ForbidConcurrent, batchv1.ReplaceConcurrent:
+		default:
+			errs = append(errs, field.NotSupported(fldPath.Child("concurrencyPolicy"), *c, []string{
+				string(batchv1.AllowConcurrent), string(batchv1.ForbidConcurrent), string(batchv1.ReplaceConcurrent)}))
+		}
+	}
+	if rp := p.Retry; rp != nil {
+		retry := fldPath.Child("retry")
+		inRange(retry.Child("attempts"), int64p(rp.Attempts), 1, maxRetryAttempts)
+		inRange(retry.Child("initialDelaySeconds"), int64p(rp.InitialDelaySeconds), 1, maxRetryDelaySeconds)
+		inRange(retry.Child("maxDelaySeconds"), int64p(rp.MaxDelaySeconds), 1, maxRetryDelaySeconds)
+		if rp.InitialDelaySeconds != nil && rp.MaxDelaySeconds != nil && *rp.InitialDelaySeconds > *rp.MaxDelaySeconds {
+			errs = append(errs, field.Invalid(retry.Child("maxDelaySeconds"), *rp.MaxDelaySeconds, "must not be less than initialDelaySeconds"))
+		}
+	}
+	return errs
+}
+
+// validateSpec validates all fields of the spec and returns the errors as one Invalid error.
+func (r *Repository) validateSpec() error {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	if _, err := cron.ParseStandard(r.Spec.Schedule); err != nil {
+		errs = append(errs, field.Invalid(spec.Child("schedule"), r.Spec.Schedule, err.Error()))
+	}
+	errs = append(errs, validateTimeZone(r.Spec.TimeZone, spec.Child("timeZone"))...)
+	errs = append(errs, validateURLs([]*field.Path{spec.Child("src"), spec.Child("dst")}, []string{r.Spec.Src, r.Spec.Dst})...)
+	errs = append(errs, r.validateRefs(spec.Child("refs"))...)
+	errs = append(errs, r.validateMetadata(spec.Child("metadata"))...)
+	errs = append(errs, r.validateDeletion(spec)...)
+	errs = append(errs, validateJobPolicy(r.Spec.JobPolicy, spec.Child("jobPolicy"))...)
+	if len(errs) != 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("Repository").GroupKind(), r.Name, errs)
 	}
 	return nil
 }
 
-// isValidURLSet tests if URLs are unique and valid.
-func isValidURLSet(s ...string) bool {
-	m := make(map[string]struct{}, len(s))
-	for _, ss := range s {
-		_, ok := m[ss]
-		if !ok {
-			m[ss] = struct{}{}
+func (r *Repository) validateRefs(fldPath *field.Path) field.ErrorList {
+	if r.Spec.Refs == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	for i, p := range r.Spec.Refs.Include {
+		if !isValidRefPattern(p) {
+			errs = append(errs, field.Invalid(fldPath.Child("include").Index(i), p, "invalid ref pattern"))
+		}
+	}
+	for i, p := range r.Spec.Refs.Exclude {
+		if !isValidRefPattern(p) {
+			errs = append(errs, field.Invalid(fldPath.Child("exclude").Index(i), p, "invalid ref pattern"))
+		}
+	}
+	return errs
+}
+
+func (r *Repository) validateMetadata(fldPath *field.Path) field.ErrorList {
+	m := r.Spec.Metadata
+	if m == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if _, err := r.GetMetadataProject(); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("project"), pointer.StringDeref(m.Project, ""), err.Error()))
+	}
+	if _, err := r.GetMetadataAPIURL(); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("apiURL"), pointer.StringDeref(m.APIURL, ""), err.Error()))
+	}
+	if ref := m.Ref; ref != nil {
+		if !isValidRefName(*ref) {
+			errs = append(errs, field.Invalid(fldPath.Child("ref"), *ref, "invalid ref name"))
+		} else if !strings.HasPrefix(*ref, "refs/"+OperatorName+"/") {
+			// Other refs are mirrored from the source and the metadata commit would overwrite them.
+			errs = append(errs, field.Invalid(fldPath.Child("ref"), *ref, "must be under refs/"+OperatorName+"/"))
 		} else {
+			for _, reserved := range []string{SnapshotsRef, v1.DriftRef, v1.StateRef} {
+				if strings.HasPrefix(*ref+"/", reserved+"/") {
+					errs = append(errs, field.Invalid(fldPath.Child("ref"), *ref, "must not be under "+reserved))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+func (r *Repository) validateDeletion(spec *field.Path) field.ErrorList {
+	f := r.Spec.DestinationForge
+	if f == nil {
+		if p := r.Spec.DeletionPolicy; p != nil && *p == DeletionArchive {
+			return field.ErrorList{field.Invalid(spec.Child("deletionPolicy"), *p, "Archive requires destinationForge")}
+		}
+		return nil
+	}
+	var errs field.ErrorList
+	fldPath := spec.Child("destinationForge")
+	if _, err := r.GetDestinationForgeProject(); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("project"), pointer.StringDeref(f.Project, ""), err.Error()))
+	}
+	if _, err := r.GetDestinationForgeAPIURL(); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("apiURL"), pointer.StringDeref(f.APIURL, ""), err.Error()))
+	}
+	return errs
+}
+
+// isValidRefName tests if s is a full ref name like "refs/foo/bar" that is safe to use in scripts.
+// See also: git check-ref-format
+func isValidRefName(s string) bool {
+	if !strings.HasPrefix(s, "refs/") || strings.HasSuffix(s, "/") || strings.HasSuffix(s, ".") {
+		return false
+	}
+	if strings.Contains(s, "..") || strings.Contains(s, "//") || strings.Contains(s, "@{") {
+		return false
+	}
+	for _, c := range s {
+		if c <= ' ' || c == 0x7f || strings.ContainsRune("~^:?*[\\'\"", c) {
 			return false
 		}
-		if strings.Contains(ss, " ") {
+	}
+	for _, e := range strings.Split(s, "/") {
+		if strings.HasPrefix(e, ".") || strings.HasSuffix(e, ".lock") {
 			return false
 		}
 	}
 	return true
 }
+
+// isValidRefPattern tests if s is a full ref name that may contain a "*" like "refs/heads/*".
+// See also: git check-ref-format --refspec-pattern
+func isValidRefPattern(s string) bool {
+	if strings.Count(s, "*") > 1 {
+		return false
+	}
+	return isValidRefName(strings.Replace(s, "*", "x", 1))
+}
@@ -1,28 +1,226 @@
 package v1beta1
 
-import "testing"
+import (
+	"reflect"
+	"testing"
 
-func Test_testIsValidURLSet(t *testing.T) {
-	type args struct {
-		s []string
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+)
+
+func Test_isValidRefName(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"refs/gitbackup/metadata", true},
+		{"refs/heads/gitbackup-metadata", true},
+		{"refs/heads/v1.0", true},
+		{"gitbackup/metadata", false},
+		{"refs/gitbackup/", false},
+		{"refs/gitbackup/a..b", false},
+		{"refs/gitbackup//a", false},
+		{"refs/gitbackup/.a", false},
+		{"refs/gitbackup/a.lock", false},
+		{"refs/gitbackup/a b", false},
+		{"refs/gitbackup/a'b", false},
+		{"refs/gitbackup/a*", false},
+		{"refs/gitbackup/a@{1}", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := isValidRefName(tt.s); got != tt.want {
+				t.Errorf("isValidRefName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isValidRefPattern(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"refs/*", true},
+		{"refs/heads/*", true},
+		{"refs/heads/feature-*", true},
+		{"refs/tags/v1.0", true},
+		{"refs/pull/*", true},
+		{"refs/*/*", false},
+		{"heads/*", false},
+		{"refs/heads/*/", false},
+		{"refs/heads/a b", false},
+		{"refs/heads/a'b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := isValidRefPattern(tt.s); got != tt.want {
+				t.Errorf("isValidRefPattern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateJobPolicy(t *testing.T) {
+	concurrencyPolicy := func(s string) *batchv1.ConcurrencyPolicy {
+		p := batchv1.ConcurrencyPolicy(s)
+		return &p
 	}
 	tests := []struct {
 		name string
-		args args
+		p    *JobPolicy
+		want []string
+	}{
+		{"nil", nil, nil},
+		{"empty", &JobPolicy{}, nil},
+		{"min", &JobPolicy{
+			BackoffLimit:               pointer.Int32(0),
+			ActiveDeadlineSeconds:      pointer.Int64(60),
+			TTLSecondsAfterFinished:    pointer.Int32(0),
+			SuccessfulJobsHistoryLimit: pointer.Int32(0),
+			FailedJobsHistoryLimit:     pointer.Int32(0),
+			ConcurrencyPolicy:          concurrencyPolicy("Allow"),
+			StartingDeadlineSeconds:    pointer.Int64(10),
+			Retry:                      &RetryPolicy{Attempts: pointer.Int32(1), InitialDelaySeconds: pointer.Int32(1), MaxDelaySeconds: pointer.Int32(1)},
+		}, nil},
+		{"max", &JobPolicy{
+			BackoffLimit:               pointer.Int32(10),
+			ActiveDeadlineSeconds:      pointer.Int64(7 * 24 * 3600),
+			TTLSecondsAfterFinished:    pointer.Int32(30 * 24 * 3600),
+			SuccessfulJobsHistoryLimit: pointer.Int32(100),
+			FailedJobsHistoryLimit:     pointer.Int32(100),
+			ConcurrencyPolicy:          concurrencyPolicy("Replace"),
+			StartingDeadlineSeconds:    pointer.Int64(24 * 3600),
+			Retry:                      &RetryPolicy{Attempts: pointer.Int32(10), InitialDelaySeconds: pointer.Int32(3600), MaxDelaySeconds: pointer.Int32(3600)},
+		}, nil},
+		{"out of range", &JobPolicy{
+			BackoffLimit:               pointer.Int32(-1),
+			ActiveDeadlineSeconds:      pointer.Int64(59),
+			TTLSecondsAfterFinished:    pointer.Int32(30*24*3600 + 1),
+			SuccessfulJobsHistoryLimit: pointer.Int32(101),
+			FailedJobsHistoryLimit:     pointer.Int32(-1),
+			ConcurrencyPolicy:          concurrencyPolicy("Never"),
+			StartingDeadlineSeconds:    pointer.Int64(9),
+			Retry:                      &RetryPolicy{Attempts: pointer.Int32(0), InitialDelaySeconds: pointer.Int32(3601), MaxDelaySeconds: pointer.Int32(0)},
+		}, []string{
+			"spec.jobPolicy.backoffLimit",
+			"spec.jobPolicy.activeDeadlineSeconds",
+			"spec.jobPolicy.ttlSecondsAfterFinished",
+			"spec.jobPolicy.successfulJobsHistoryLimit",
+			"spec.jobPolicy.failedJobsHistoryLimit",
+			"spec.jobPolicy.startingDeadlineSeconds",
+			"spec.jobPolicy.concurrencyPolicy",
+			"spec.jobPolicy.retry.attempts",
+			"spec.jobPolicy.retry.initialDelaySeconds",
+			"spec.jobPolicy.retry.maxDelaySeconds",
+			"spec.jobPolicy.retry.maxDelaySeconds",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateJobPolicy(tt.p, field.NewPath("spec", "jobPolicy"))
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Field)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("validateJobPolicy() = %v, want %v", errs, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("validateJobPolicy()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRepository_validateMetadata(t *testing.T) {
+	tests := []struct {
+		ref  string
 		want bool
 	}{
-		{"0", args{s: []string{}}, true},
-		{"1", args{s: []string{"http://example.com/src/foo"}}, true},
-		{"2", args{s: []string{"http://example.com/src/foo", "http://example.com/dst/foo"}}, true},
-		{"3", args{s: []string{"http://example.com/src/foo", "http://example.com/dst/foo", "http://example.com/dst2/foo"}}, true},
-		{"1x", args{s: []string{"http://example.com/s c/foo"}}, false},
-		{"2x", args{s: []string{"http://example.com/src/foo", "http://example.com/src/foo"}}, false},
-		{"3x", args{s: []string{"http://example.com/src/foo", "http://example.com/dst/foo", "http://example.com/dst/foo"}}, false},
+		{"refs/gitbackup/metadata", true},
+		{"refs/gitbackup/issues/foo", true},
+		{"refs/gitbackup/snapshotsx", true},
+		{"refs/heads/main", false},
+		{"refs/tags/metadata", false},
+		{"refs/gitbackup", false},
+		{"refs/gitbackup/snapshots", false},
+		{"refs/gitbackup/snapshots/metadata", false},
+		{"refs/gitbackup/drift", false},
+		{"refs/gitbackup/drift/metadata", false},
+		{"refs/gitbackup/state", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			r := Repository{Spec: RepositorySpec{Src: "https://github.com/foo/bar", Metadata: &MetadataSpec{Forge: ForgeGitHub, Ref: pointer.String(tt.ref)}}}
+			errs := r.validateMetadata(field.NewPath("spec", "metadata"))
+			if got := len(errs) == 0; got != tt.want {
+				t.Errorf("validateMetadata() = %v, want valid %v", errs, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepository_validateSpec(t *testing.T) {
+	archive := DeletionArchive
+	base := RepositorySpec{Src: "https://github.com/foo/bar", Dst: "https://example.com/dst", Schedule: "0 6 * * *"}
+	tests := []struct {
+		name string
+		mod  func(s *RepositorySpec)
+		want []string
+	}{
+		{"valid", func(s *RepositorySpec) {}, nil},
+		{"all errors", func(s *RepositorySpec) {
+			s.Schedule = "foo"
+			s.TimeZone = pointer.String("Asia/Foo")
+			s.Dst = "file:///dst"
+			s.Refs = &RefsSpec{Include: []string{"refs/heads/*", "heads/*"}, Exclude: []string{"refs/tags/**"}}
+			s.Metadata = &MetadataSpec{Forge: ForgeGitHub, Ref: pointer.String(SnapshotsRef + "/foo")}
+			s.DeletionPolicy = &archive
+			s.JobPolicy = &JobPolicy{BackoffLimit: pointer.Int32(-1)}
+		}, []string{
+			"spec.schedule",
+			"spec.timeZone",
+			"spec.dst",
+			"spec.refs.include[1]",
+			"spec.refs.exclude[0]",
+			"spec.metadata.ref",
+			"spec.deletionPolicy",
+			"spec.jobPolicy.backoffLimit",
+		}},
+		{"forges", func(s *RepositorySpec) {
+			s.Src = "git@github.com:foo/bar"
+			s.Metadata = &MetadataSpec{Forge: ForgeGitHub}
+			s.Dst = "git@example.com:dst"
+			s.DestinationForge = &DestinationForgeSpec{Forge: ForgeGitea}
+		}, []string{
+			"spec.metadata.project",
+			"spec.metadata.apiURL",
+			"spec.destinationForge.project",
+			"spec.destinationForge.apiURL",
+		}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := isValidURLSet(tt.args.s...); got != tt.want {
-				t.Errorf("testURLSet() = %v, want %v", got, tt.want)
+			r := Repository{Spec: base}
+			tt.mod(&r.Spec)
+			err := r.validateSpec()
+			var got []string
+			if err != nil {
+				status, ok := err.(apierrors.APIStatus)
+				if !ok {
+					t.Fatalf("validateSpec() = %v, want an API status error", err)
+				}
+				for _, c := range status.Status().Details.Causes {
+					got = append(got, c.Field)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateSpec() = %v, want fields %v", err, tt.want)
 			}
 		})
 	}
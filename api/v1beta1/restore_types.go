@@ -0,0 +1,121 @@
+package v1beta1
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetOwnedConfigMapName returns "gitbackup-restore-{r.Name}-gitconfig"
+func (r Restore) GetOwnedConfigMapName() string {
+	return strings.Join([]string{OperatorName, "restore", r.Name, "gitconfig"}, "-")
+}
+
+// GetOwnedJobName returns "gitbackup-restore-{r.Name}"
+func (r Restore) GetOwnedJobName() string {
+	return strings.Join([]string{OperatorName, "restore", r.Name}, "-")
+}
+
+// RestoreSpec defines the desired state of Restore
+type RestoreSpec struct {
+	// Repository specifies the Repository in the same namespace to restore.
+	// Its `Dst` is used as the backup and its settings are used as defaults.
+	// +optional
+	Repository *corev1.LocalObjectReference `json:"repository,omitempty"`
+	// Src specifies the backup repository in URL format. Required if `Repository` is not specified.
+	// +optional
+	Src *string `json:"src,omitempty"`
+
+	// Target specifies the repository in URL format to push the backup to.
+	Target string `json:"target"`
+
+	// Snapshot specifies the ID of the snapshot to restore e.g. "20230105T060000Z".
+	// The refs of the snapshot are restored exactly; refs not in the snapshot are deleted from the target.
+	// The latest refs are restored if neither `Snapshot` nor `AsOf` is specified.
+	// +optional
+	Snapshot *string `json:"snapshot,omitempty"`
+	// AsOf restores the latest snapshot taken at or before the time. The restore fails if there is no such snapshot.
+	// +optional
+	AsOf *metav1.Time `json:"asOf,omitempty"`
+
+	// GitImage specifies the container image to run. (default: `Repository` or DefaultGitImage)
+	// +optional
+	GitImage *string `json:"gitImage,omitempty"`
+	// ImagePullSecret specifies the name of the Secret in the same namespace used to pull the GitImage. (default: `Repository`)
+	// +optional
+	ImagePullSecret *corev1.LocalObjectReference `json:"imagePullSecret,omitempty"`
+
+	// GitConfig specifies the name of the configmap resource in the same namespace used to mount .git-config (default: `Repository`)
+	// Note that "[credential]\nhelper=store" is required to use GitCredentials.
+	// +optional
+	GitConfig *corev1.LocalObjectReference `json:"gitConfig,omitempty"`
+	// GitCredentials specifies the name of the Secret in the same namespace used to mount .git-credentials (default: `Repository`)
+	// Note that the credentials must be able to read the backup and to write the target.
+	// +optional
+	GitCredentials *corev1.LocalObjectReference `json:"gitCredentials,omitempty"`
+
+	// Encryption specifies the keys to decrypt the backup. (default: `Repository`)
+	// +optional
+	Encryption *EncryptionSpec `json:"encryption,omitempty"`
+}
+
+// RestorePhase is the phase of a Restore.
+type RestorePhase string
+
+const (
+	RestorePending   RestorePhase = "Pending"
+	RestoreRunning   RestorePhase = "Running"
+	RestoreSucceeded RestorePhase = "Succeeded"
+	RestoreFailed    RestorePhase = "Failed"
+)
+
+// RestoreStatus defines the observed state of Restore
+type RestoreStatus struct {
+	// Phase is the current phase of the restore.
+	// +optional
+	Phase RestorePhase `json:"phase,omitempty"`
+	// Snapshot is the ID of the restored snapshot.
+	// +optional
+	Snapshot string `json:"snapshot,omitempty"`
+	// JobName is the name of the Job that runs the restore.
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+	// StartTime is the time when the Job started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is the time when the Job succeeded or failed.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message is a human readable message about the phase.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.target`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Restore is the Schema for the restores API
+type Restore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RestoreSpec   `json:"spec,omitempty"`
+	Status RestoreStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RestoreList contains a list of Restore
+type RestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Restore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Restore{}, &RestoreList{})
+}
@@ -0,0 +1,47 @@
+package v1beta1_test
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+)
+
+func TestRestore_GetOwnedConfigMapName(t *testing.T) {
+	tests := []struct {
+		name string
+		meta metav1.ObjectMeta
+		want string
+	}{
+		{"a", metav1.ObjectMeta{Name: "a"}, "gitbackup-restore-a-gitconfig"},
+		{"b-c", metav1.ObjectMeta{Name: "b-c"}, "gitbackup-restore-b-c-gitconfig"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1beta1.Restore{ObjectMeta: tt.meta}
+			if got := r.GetOwnedConfigMapName(); got != tt.want {
+				t.Errorf("Restore.GetOwnedConfigMapName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestore_GetOwnedJobName(t *testing.T) {
+	tests := []struct {
+		name string
+		meta metav1.ObjectMeta
+		want string
+	}{
+		{"a", metav1.ObjectMeta{Name: "a"}, "gitbackup-restore-a"},
+		{"b-c", metav1.ObjectMeta{Name: "b-c"}, "gitbackup-restore-b-c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := v1beta1.Restore{ObjectMeta: tt.meta}
+			if got := r.GetOwnedJobName(); got != tt.want {
+				t.Errorf("Restore.GetOwnedJobName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
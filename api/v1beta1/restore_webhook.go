@@ -0,0 +1,103 @@
+package v1beta1
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var restorelog = logf.Log.WithName("restore-resource")
+
+func (r *Restore) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&backupPolicyValidator{Reader: mgr.GetClient()}).
+		Complete()
+}
+
+// NOTE: change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
+//+kubebuilder:webhook:path=/validate-gitbackup-ebiiim-com-v1beta1-restore,mutating=false,failurePolicy=fail,sideEffects=None,groups=gitbackup.ebiiim.com,resources=restores,verbs=create;update,versions=v1beta1,name=vrestore.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &Restore{}
+
+// getURLs returns Src as a source and Target as a destination
+// so that backups are restored only to the destinations allowed by BackupPolicies.
+func (r *Restore) getURLs() (srcs, dsts []string) {
+	if r.Spec.Src != nil {
+		srcs = []string{*r.Spec.Src}
+	}
+	return srcs, []string{r.Spec.Target}
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+// NOTE: the webhook is registered with backupPolicyValidator that calls the methods of webhook.Validator before checking BackupPolicies.
+func (r *Restore) ValidateCreate() error {
+	restorelog.Info("validate create", "name", r.Name)
+
+	spec := field.NewPath("spec")
+	errs := r.validateSource(spec)
+	errs = append(errs, r.validateURL(spec)...)
+	errs = append(errs, r.validateSnapshot(spec)...)
+	if len(errs) != 0 {
+		return apierrors.NewInvalid(GroupVersion.WithKind("Restore").GroupKind(), r.Name, errs)
+	}
+	return nil
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Restore) ValidateUpdate(old runtime.Object) error {
+	restorelog.Info("validate update", "name", r.Name)
+
+	// a Restore runs only once so changing the spec does not make sense
+	if o, ok := old.(*Restore); ok && !equality.Semantic.DeepEqual(o.Spec, r.Spec) {
+		return apierrors.NewInvalid(GroupVersion.WithKind("Restore").GroupKind(), r.Name,
+			field.ErrorList{field.Forbidden(field.NewPath("spec"), "spec is immutable")})
+	}
+
+	return nil
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+// NOTE: nothing to validate upon object deletion.
+func (r *Restore) ValidateDelete() error { return nil }
+
+func (r *Restore) validateSource(spec *field.Path) field.ErrorList {
+	switch {
+	case r.Spec.Repository == nil && r.Spec.Src == nil:
+		return field.ErrorList{field.Required(spec.Child("repository"), "exactly one of repository or src must be specified")}
+	case r.Spec.Repository != nil && r.Spec.Src != nil:
+		return field.ErrorList{field.Forbidden(spec.Child("src"), "exactly one of repository or src must be specified")}
+	}
+	return nil
+}
+
+func (r *Restore) validateURL(spec *field.Path) field.ErrorList {
+	paths := []*field.Path{spec.Child("target")}
+	urls := []string{r.Spec.Target}
+	if r.Spec.Src != nil {
+		paths = append(paths, spec.Child("src"))
+		urls = append(urls, *r.Spec.Src)
+	}
+	return validateURLs(paths, urls)
+}
+
+func (r *Restore) validateSnapshot(spec *field.Path) field.ErrorList {
+	if r.Spec.Snapshot == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if r.Spec.AsOf != nil {
+		errs = append(errs, field.Forbidden(spec.Child("asOf"), "snapshot and asOf are mutually exclusive"))
+	}
+	if _, err := time.Parse(SnapshotIDFormat, *r.Spec.Snapshot); err != nil {
+		errs = append(errs, field.Invalid(spec.Child("snapshot"), *r.Spec.Snapshot, "must be a snapshot ID in the format "+SnapshotIDFormat))
+	}
+	return errs
+}
@@ -0,0 +1,51 @@
+package v1beta1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+func TestRestore_ValidateCreate(t *testing.T) {
+	repo := &corev1.LocalObjectReference{Name: "repo1"}
+	tests := []struct {
+		name string
+		spec RestoreSpec
+		want []string
+	}{
+		{"repository", RestoreSpec{Repository: repo, Target: "https://example.com/target"}, nil},
+		{"src and snapshot", RestoreSpec{Src: pointer.String("https://example.com/dst"), Target: "https://example.com/target", Snapshot: pointer.String("20230102T060000Z")}, nil},
+		{"no source", RestoreSpec{Target: "https://example.com/target"}, []string{"spec.repository"}},
+		{"all errors", RestoreSpec{
+			Repository: repo,
+			Src:        pointer.String("file:///dst"),
+			Target:     "ext::sh",
+			Snapshot:   pointer.String("latest"),
+			AsOf:       &metav1.Time{Time: time.Date(2023, 1, 2, 6, 0, 0, 0, time.UTC)},
+		}, []string{"spec.src", "spec.target", "spec.src", "spec.asOf", "spec.snapshot"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Restore{Spec: tt.spec}
+			err := r.ValidateCreate()
+			var got []string
+			if err != nil {
+				status, ok := err.(apierrors.APIStatus)
+				if !ok {
+					t.Fatalf("ValidateCreate() = %v, want an API status error", err)
+				}
+				for _, c := range status.Status().Details.Causes {
+					got = append(got, c.Field)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateCreate() = %v, want fields %v", err, tt.want)
+			}
+		})
+	}
+}
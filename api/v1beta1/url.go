@@ -0,0 +1,137 @@
+package v1beta1
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// allowedSchemes are the schemes of Git remote URLs accepted by the webhooks.
+// Other transports such as "file://" and "ext::" are rejected as they can read local files or run commands.
+var allowedSchemes = map[string]struct{}{
+	"https": {},
+	"http":  {},
+	"ssh":   {},
+}
+
+// gitURL is a parsed Git remote URL.
+type gitURL struct {
+	Scheme string
+	// Host is the lower-cased host name without the port.
+	Host string
+	Port string
+	Path string
+}
+
+// defaultPorts are the ports omitted in the keys of URLs.
+var defaultPorts = map[string]string{
+	"https": "443",
+	"http":  "80",
+	"ssh":   "22",
+}
+
+// key returns a normalized form of u to detect duplicates.
+// The scheme, the user, the default port of the scheme and the ".git" suffix are ignored
+// so that "https://host/a", "ssh://host:22/a" and "git@host:a.git" are the same.
+// The path is case-sensitive as it is on most Git servers.
+func (u gitURL) key() string {
+	host := u.Host
+	if u.Port != "" && u.Port != defaultPorts[u.Scheme] {
+		host += ":" + u.Port
+	}
+	return host + "/" + strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+}
+
+// parseGitURL parses Git remote URLs in https, http, ssh and scp-like ("user@host:path") forms.
+// scp-like URLs are parsed as "ssh".
+func parseGitURL(s string) (gitURL, error) {
+	if s == "" {
+		return gitURL{}, errors.New("must not be empty")
+	}
+	for _, c := range s {
+		// the URLs are single-quoted in the backup scripts
+		if c <= ' ' || c == 0x7f || strings.ContainsRune("'\"`\\", c) {
+			return gitURL{}, errors.New("must not contain spaces, control characters, quotes or backslashes")
+		}
+	}
+	if i := strings.Index(s, "::"); i >= 0 && !strings.Contains(s[:i], "/") {
+		return gitURL{}, fmt.Errorf("transport %s:: is not allowed", s[:i])
+	}
+
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return gitURL{}, errors.New("unable to parse URL")
+		}
+		scheme := strings.ToLower(u.Scheme)
+		if _, ok := allowedSchemes[scheme]; !ok {
+			return gitURL{}, fmt.Errorf("scheme %s is not allowed; use https, http, ssh or scp-like syntax", u.Scheme)
+		}
+		if u.Hostname() == "" {
+			return gitURL{}, errors.New("host must be specified")
+		}
+		if u.RawQuery != "" || u.Fragment != "" {
+			return gitURL{}, errors.New("query and fragment are not allowed")
+		}
+		// ssh takes "-" as the beginning of an option
+		if strings.HasPrefix(u.Hostname(), "-") || strings.HasPrefix(u.User.Username(), "-") {
+			return gitURL{}, errors.New("user and host must not start with \"-\"")
+		}
+		if err := validatePathSegments(u.Path); err != nil {
+			return gitURL{}, err
+		}
+		return gitURL{Scheme: scheme, Host: strings.ToLower(u.Hostname()), Port: u.Port(), Path: u.Path}, nil
+	}
+
+	// scp-like syntax is recognized by git only if there is no slash before the first colon
+	colon := strings.Index(s, ":")
+	if colon < 0 || strings.Contains(s[:colon], "/") {
+		return gitURL{}, errors.New("local paths are not allowed")
+	}
+	userHost, p := s[:colon], s[colon+1:]
+	host := userHost[strings.LastIndex(userHost, "@")+1:]
+	if host == "" || p == "" {
+		return gitURL{}, errors.New("scp-like URL must be in \"[user@]host:path\" form")
+	}
+	if strings.HasPrefix(userHost, "-") || strings.HasPrefix(host, "-") {
+		return gitURL{}, errors.New("user and host must not start with \"-\"")
+	}
+	if err := validatePathSegments(p); err != nil {
+		return gitURL{}, err
+	}
+	return gitURL{Scheme: "ssh", Host: strings.ToLower(host), Path: "/" + strings.TrimPrefix(p, "/")}, nil
+}
+
+// validatePathSegments rejects "." and ".." segments in p.
+// Forges and git clients may resolve them, so the path that BackupPolicies match would differ from the accessed one.
+func validatePathSegments(p string) error {
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "." || seg == ".." {
+			return errors.New("path must not contain \".\" or \"..\" segments")
+		}
+	}
+	return nil
+}
+
+// validateURLs validates each of urls and tests if they are unique after normalization.
+// fldPaths[i] is the field path of urls[i].
+func validateURLs(fldPaths []*field.Path, urls []string) field.ErrorList {
+	var errs field.ErrorList
+	seen := make(map[string]*field.Path, len(urls))
+	for i, s := range urls {
+		u, err := parseGitURL(s)
+		if err != nil {
+			errs = append(errs, field.Invalid(fldPaths[i], s, err.Error()))
+			continue
+		}
+		if p, ok := seen[u.key()]; ok {
+			errs = append(errs, field.Duplicate(fldPaths[i], fmt.Sprintf("%s (same repository as %s)", s, p)))
+			continue
+		}
+		seen[u.key()] = fldPaths[i]
+	}
+	return errs
+}
@@ -0,0 +1,92 @@
+package v1beta1
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func Test_parseGitURL(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    gitURL
+		wantErr bool
+	}{
+		{"https://example.com/src/foo", gitURL{Scheme: "https", Host: "example.com", Path: "/src/foo"}, false},
+		{"HTTP://Example.com:8080/src/foo.git", gitURL{Scheme: "http", Host: "example.com", Port: "8080", Path: "/src/foo.git"}, false},
+		{"ssh://git@example.com:2222/src/foo", gitURL{Scheme: "ssh", Host: "example.com", Port: "2222", Path: "/src/foo"}, false},
+		{"git@github.com:foo/bar.git", gitURL{Scheme: "ssh", Host: "github.com", Path: "/foo/bar.git"}, false},
+		{"github.com:foo/bar", gitURL{Scheme: "ssh", Host: "github.com", Path: "/foo/bar"}, false},
+		{"", gitURL{}, true},
+		{"file:///etc", gitURL{}, true},
+		{"ext::sh -c touch% /tmp/pwned", gitURL{}, true},
+		{"ext::sh", gitURL{}, true},
+		{"gcrypt::https://example.com/foo", gitURL{}, true},
+		{"git://example.com/foo", gitURL{}, true},
+		{"/path/to/repo", gitURL{}, true},
+		{"./repo:foo", gitURL{}, true},
+		{"https://example.com/s c/foo", gitURL{}, true},
+		{"https://example.com/foo';touch /tmp/pwned;'", gitURL{}, true},
+		{"https://example.com/foo\nbar", gitURL{}, true},
+		{"https:///foo", gitURL{}, true},
+		{"https://example.com/foo?a=b", gitURL{}, true},
+		{"ssh://-oProxyCommand=x/foo", gitURL{}, true},
+		{"-oProxyCommand=x:foo", gitURL{}, true},
+		{"git@:foo", gitURL{}, true},
+		{"git@host:", gitURL{}, true},
+		{"https://example.com/foo/bar..git", gitURL{Scheme: "https", Host: "example.com", Path: "/foo/bar..git"}, false},
+		{"https://example.com/foo/x/../../bar", gitURL{}, true},
+		{"https://example.com/foo/%2e%2e/bar", gitURL{}, true},
+		{"https://example.com/./foo", gitURL{}, true},
+		{"git@github.com:foo/../bar", gitURL{}, true},
+		{"git@github.com:./foo", gitURL{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseGitURL(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseGitURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseGitURL() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		s    []string
+		want bool
+	}{
+		{"0", []string{}, true},
+		{"1", []string{"http://example.com/src/foo"}, true},
+		{"2", []string{"http://example.com/src/foo", "http://example.com/dst/foo"}, true},
+		{"3", []string{"http://example.com/src/foo", "http://example.com/dst/foo", "http://example.com/dst2/foo"}, true},
+		{"port", []string{"http://example.com/src/foo", "http://example.com:8080/src/foo"}, true},
+		{"1x", []string{"http://example.com/s c/foo"}, false},
+		{"2x", []string{"http://example.com/src/foo", "http://example.com/src/foo"}, false},
+		{"3x", []string{"http://example.com/src/foo", "http://example.com/dst/foo", "http://example.com/dst/foo"}, false},
+		{".git", []string{"https://example.com/a", "https://example.com/a.git"}, false},
+		{"trailing slash", []string{"https://example.com/a", "https://example.com/a/"}, false},
+		{"case", []string{"https://example.com/a", "https://EXAMPLE.com/a"}, false},
+		{"scp-like", []string{"https://github.com/foo/bar", "git@github.com:foo/bar.git"}, false},
+		{"default port https", []string{"https://example.com/a", "https://example.com:443/a"}, false},
+		{"default port ssh", []string{"ssh://git@example.com:22/a", "git@example.com:a"}, false},
+		{"non-default port", []string{"https://example.com:22/a", "git@example.com:a"}, true},
+		{"path case", []string{"https://example.com/a", "https://example.com/A"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := make([]*field.Path, len(tt.s))
+			for i := range tt.s {
+				paths[i] = field.NewPath("spec").Index(i)
+			}
+			if got := validateURLs(paths, tt.s); (len(got) == 0) != tt.want {
+				t.Errorf("validateURLs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
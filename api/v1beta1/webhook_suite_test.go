@@ -16,8 +16,10 @@ import (
 
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	//+kubebuilder:scaffold:imports
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -25,6 +27,7 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	v1 "github.com/ebiiim/gitbackup/api/v1"
 	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
 )
 
@@ -48,8 +51,28 @@ var _ = BeforeSuite(func() {
 
 	ctx, cancel = context.WithCancel(context.Background())
 
+	scheme := runtime.NewScheme()
+	// the webhooks get Namespaces, Secrets and ConfigMaps
+	err := clientgoscheme.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = v1beta1.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = v1.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = admissionv1beta1.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	//+kubebuilder:scaffold:scheme
+
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
+		Scheme: scheme,
+		// the scheme of CRDInstallOptions is used to enable the conversion webhook of the CRDs
+		// as Environment.Scheme is not passed to it
+		CRDInstallOptions:     envtest.CRDInstallOptions{Scheme: scheme},
 		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
 		ErrorIfCRDPathMissing: false,
 		WebhookInstallOptions: envtest.WebhookInstallOptions{
@@ -57,21 +80,11 @@ var _ = BeforeSuite(func() {
 		},
 	}
 
-	var err error
 	// cfg is defined in this file globally.
 	cfg, err = testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
-	scheme := runtime.NewScheme()
-	err = v1beta1.AddToScheme(scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	err = admissionv1beta1.AddToScheme(scheme)
-	Expect(err).NotTo(HaveOccurred())
-
-	//+kubebuilder:scaffold:scheme
-
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
@@ -94,6 +107,24 @@ var _ = BeforeSuite(func() {
 	err = (&v1beta1.Collection{}).SetupWebhookWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = (&v1beta1.Restore{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&v1beta1.ClusterCollection{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&v1beta1.BackupPolicy{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&v1beta1.Notifier{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&v1.Repository{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&v1.Collection{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:webhook
 
 	go func() {
@@ -129,6 +160,16 @@ var _ = Describe("Repository webhook", func() {
 		It("should mutate repositories", func() {
 			testMutateRepository(mustOpen(dir, "mutate_minimal_before.yaml"), mustOpen(dir, "mutate_minimal_after.yaml"))
 			testMutateRepository(mustOpen(dir, "mutate_all_before.yaml"), mustOpen(dir, "mutate_all_after.yaml"))
+			testMutateRepository(mustOpen(dir, "mutate_metadata_before.yaml"), mustOpen(dir, "mutate_metadata_after.yaml"))
+			testMutateRepository(mustOpen(dir, "mutate_deletion_before.yaml"), mustOpen(dir, "mutate_deletion_after.yaml"))
+		})
+		It("should mutate repositories with a BackupClass", func() {
+			cls := mustCreateBackupClass(mustOpen("testdata/backupclass", "testclass.yaml"))
+			defer func() { Expect(k8sClient.Delete(context.Background(), cls)).To(Succeed()) }()
+			Eventually(func() error {
+				return k8sClient.Get(context.Background(), client.ObjectKeyFromObject(cls), &v1beta1.BackupClass{})
+			}).Should(Succeed())
+			testMutateRepository(mustOpen(dir, "mutate_class_before.yaml"), mustOpen(dir, "mutate_class_after.yaml"))
 		})
 	})
 	Context("validating", func() {
@@ -138,17 +179,45 @@ var _ = Describe("Repository webhook", func() {
 			testValidateRepository(mustOpen(dir, "validate_minimal.yaml"), want)
 			testValidateRepository(mustOpen(dir, "validate_cron_weekly.yaml"), want)
 			testValidateRepository(mustOpen(dir, "validate_cron_sun.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_metadata.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_refs.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_encryption.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_snapshots.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_url_scp.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_jobpolicy.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_deletion.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_deletion_forge.yaml"), want)
 			_ = want
 		})
 		It("should not create invalid repositories", func() {
 			want := false
 			testValidateRepository(mustOpen(dir, "validate_wrong_cron.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_class.yaml"), want)
 			testValidateRepository(mustOpen(dir, "validate_wrong_url_src.yaml"), want)
 			testValidateRepository(mustOpen(dir, "validate_wrong_url_dst.yaml"), want)
 			testValidateRepository(mustOpen(dir, "validate_wrong_url_eq.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_url_file.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_url_ext.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_url_quote.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_url_eq_git.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_metadata_ref.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_metadata_src.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_refs.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_encryption_dst.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_snapshots_metadata_ref.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_metadata_ref_heads.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_jobpolicy.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_deletion_archive.yaml"), want)
+			testValidateRepository(mustOpen(dir, "validate_wrong_deletion_dst.yaml"), want)
 			_ = want
 		})
 	})
+	Context("converting", func() {
+		It("should convert repositories between v1 and v1beta1", func() {
+			testConvertRepository(mustOpen(dir, "convert_v1_before.yaml"), mustOpen(dir, "convert_v1_after.yaml"), mustOpen(dir, "convert_v1_after_v1beta1.yaml"))
+			testConvertRepository(mustOpen(dir, "convert_v1beta1_before.yaml"), mustOpen(dir, "convert_v1beta1_after_v1.yaml"), mustOpen(dir, "convert_v1beta1_after.yaml"))
+		})
+	})
 })
 
 func testMutateRepository(rIn, rWant io.Reader) {
@@ -194,6 +263,46 @@ func testValidateRepository(rIn io.Reader, shouldBeValid bool) {
 	}
 }
 
+// testConvertRepository creates rIn in its version and checks that it is served as rWantV1 and rWantV1beta1.
+// It also checks that updating the v1beta1 object does not change the fields that v1beta1 cannot represent.
+func testConvertRepository(rIn, rWantV1, rWantV1beta1 io.Reader) {
+	ctx2 := context.Background()
+
+	var in unstructured.Unstructured
+	var got, want v1.Repository
+	var gotV1beta1, wantV1beta1 v1beta1.Repository
+
+	err := yaml.NewYAMLOrJSONDecoder(rIn, 32).Decode(&in)
+	Expect(err).NotTo(HaveOccurred())
+	err = yaml.NewYAMLOrJSONDecoder(rWantV1, 32).Decode(&want)
+	Expect(err).NotTo(HaveOccurred())
+	err = yaml.NewYAMLOrJSONDecoder(rWantV1beta1, 32).Decode(&wantV1beta1)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = k8sClient.Create(ctx2, &in)
+	Expect(err).NotTo(HaveOccurred())
+	key := client.ObjectKeyFromObject(&in)
+
+	err = k8sClient.Get(ctx2, key, &got)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(got.Spec).Should(Equal(want.Spec))
+	err = k8sClient.Get(ctx2, key, &gotV1beta1)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(gotV1beta1.Spec).Should(Equal(wantV1beta1.Spec))
+
+	gotV1beta1.Spec.Schedule = "0 7 * * *"
+	err = k8sClient.Update(ctx2, &gotV1beta1)
+	Expect(err).NotTo(HaveOccurred())
+	err = k8sClient.Get(ctx2, key, &got)
+	Expect(err).NotTo(HaveOccurred())
+	want.Spec.Schedule = "0 7 * * *"
+	Expect(got.Spec).Should(Equal(want.Spec))
+	Expect(got.Annotations).ShouldNot(HaveKey(v1beta1.ConversionDataAnnotation))
+
+	err = k8sClient.Delete(ctx2, &got)
+	Expect(err).NotTo(HaveOccurred())
+}
+
 var _ = Describe("Collection webhook", func() {
 	dir := "testdata/collection"
 	Context("mutating", func() {
@@ -201,6 +310,14 @@ var _ = Describe("Collection webhook", func() {
 			testMutateCollection(mustOpen(dir, "mutate_minimal_before.yaml"), mustOpen(dir, "mutate_minimal_after.yaml"))
 			testMutateCollection(mustOpen(dir, "mutate_all_before.yaml"), mustOpen(dir, "mutate_all_after.yaml"))
 		})
+		It("should mutate collections with a BackupClass", func() {
+			cls := mustCreateBackupClass(mustOpen("testdata/backupclass", "testclass.yaml"))
+			defer func() { Expect(k8sClient.Delete(context.Background(), cls)).To(Succeed()) }()
+			Eventually(func() error {
+				return k8sClient.Get(context.Background(), client.ObjectKeyFromObject(cls), &v1beta1.BackupClass{})
+			}).Should(Succeed())
+			testMutateCollection(mustOpen(dir, "mutate_class_before.yaml"), mustOpen(dir, "mutate_class_after.yaml"))
+		})
 	})
 	Context("validating", func() {
 		It("should create valid collections", func() {
@@ -217,12 +334,63 @@ var _ = Describe("Collection webhook", func() {
 			testValidateCollection(mustOpen(dir, "validate_wrong_url_src.yaml"), want)
 			testValidateCollection(mustOpen(dir, "validate_wrong_url_dst.yaml"), want)
 			testValidateCollection(mustOpen(dir, "validate_wrong_url_eq.yaml"), want)
+			testValidateCollection(mustOpen(dir, "validate_wrong_url_dup_dst.yaml"), want)
 			testValidateCollection(mustOpen(dir, "validate_wrong_reponame.yaml"), want)
+			testValidateCollection(mustOpen(dir, "validate_wrong_reponame_dup.yaml"), want)
+			testValidateCollection(mustOpen(dir, "validate_wrong_reponame_long.yaml"), want)
+			testValidateCollection(mustOpen(dir, "validate_wrong_reponame_src.yaml"), want)
+			testValidateCollection(mustOpen(dir, "validate_wrong_jobpolicy.yaml"), want)
 			_ = want
 		})
 	})
+	Context("converting", func() {
+		It("should convert collections between v1 and v1beta1", func() {
+			testConvertCollection(mustOpen(dir, "convert_v1_before.yaml"), mustOpen(dir, "convert_v1_after.yaml"), mustOpen(dir, "convert_v1_after_v1beta1.yaml"))
+			testConvertCollection(mustOpen(dir, "convert_v1beta1_before.yaml"), mustOpen(dir, "convert_v1beta1_after_v1.yaml"), mustOpen(dir, "convert_v1beta1_after.yaml"))
+		})
+	})
 })
 
+// testConvertCollection creates rIn in its version and checks that it is served as rWantV1 and rWantV1beta1.
+// It also checks that updating the v1beta1 object does not change the fields that v1beta1 cannot represent.
+func testConvertCollection(rIn, rWantV1, rWantV1beta1 io.Reader) {
+	ctx2 := context.Background()
+
+	var in unstructured.Unstructured
+	var got, want v1.Collection
+	var gotV1beta1, wantV1beta1 v1beta1.Collection
+
+	err := yaml.NewYAMLOrJSONDecoder(rIn, 32).Decode(&in)
+	Expect(err).NotTo(HaveOccurred())
+	err = yaml.NewYAMLOrJSONDecoder(rWantV1, 32).Decode(&want)
+	Expect(err).NotTo(HaveOccurred())
+	err = yaml.NewYAMLOrJSONDecoder(rWantV1beta1, 32).Decode(&wantV1beta1)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = k8sClient.Create(ctx2, &in)
+	Expect(err).NotTo(HaveOccurred())
+	key := client.ObjectKeyFromObject(&in)
+
+	err = k8sClient.Get(ctx2, key, &got)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(got.Spec).Should(Equal(want.Spec))
+	err = k8sClient.Get(ctx2, key, &gotV1beta1)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(gotV1beta1.Spec).Should(Equal(wantV1beta1.Spec))
+
+	gotV1beta1.Spec.Schedule = "0 7 * * *"
+	err = k8sClient.Update(ctx2, &gotV1beta1)
+	Expect(err).NotTo(HaveOccurred())
+	err = k8sClient.Get(ctx2, key, &got)
+	Expect(err).NotTo(HaveOccurred())
+	want.Spec.Schedule = "0 7 * * *"
+	Expect(got.Spec).Should(Equal(want.Spec))
+	Expect(got.Annotations).ShouldNot(HaveKey(v1beta1.ConversionDataAnnotation))
+
+	err = k8sClient.Delete(ctx2, &got)
+	Expect(err).NotTo(HaveOccurred())
+}
+
 func testMutateCollection(rIn, rWant io.Reader) {
 	ctx2 := context.Background()
 
@@ -266,6 +434,183 @@ func testValidateCollection(rIn io.Reader, shouldBeValid bool) {
 	}
 }
 
+var _ = Describe("Restore webhook", func() {
+	dir := "testdata/restore"
+	Context("validating", func() {
+		It("should create valid restores", func() {
+			want := true
+			testValidateRestore(mustOpen(dir, "validate_repository.yaml"), want)
+			testValidateRestore(mustOpen(dir, "validate_src.yaml"), want)
+			testValidateRestore(mustOpen(dir, "validate_snapshot.yaml"), want)
+			testValidateRestore(mustOpen(dir, "validate_as_of.yaml"), want)
+			_ = want
+		})
+		It("should not create invalid restores", func() {
+			want := false
+			testValidateRestore(mustOpen(dir, "validate_wrong_both.yaml"), want)
+			testValidateRestore(mustOpen(dir, "validate_wrong_none.yaml"), want)
+			testValidateRestore(mustOpen(dir, "validate_wrong_url_eq.yaml"), want)
+			testValidateRestore(mustOpen(dir, "validate_wrong_snapshot_id.yaml"), want)
+			testValidateRestore(mustOpen(dir, "validate_wrong_snapshot_as_of.yaml"), want)
+			_ = want
+		})
+		It("should not update restores", func() {
+			ctx2 := context.Background()
+
+			var in v1beta1.Restore
+			err := yaml.NewYAMLOrJSONDecoder(mustOpen(dir, "validate_src.yaml"), 32).Decode(&in)
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Create(ctx2, &in)
+			Expect(err).NotTo(HaveOccurred())
+
+			in.Spec.Target = "https://example.com/another"
+			err = k8sClient.Update(ctx2, &in)
+			Expect(err).To(HaveOccurred())
+
+			err = k8sClient.Delete(ctx2, &in)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
+
+func testValidateRestore(rIn io.Reader, shouldBeValid bool) {
+	ctx2 := context.Background()
+
+	var in v1beta1.Restore
+
+	err := yaml.NewYAMLOrJSONDecoder(rIn, 32).Decode(&in)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = k8sClient.Create(ctx2, &in)
+	if shouldBeValid {
+		Expect(err).NotTo(HaveOccurred(), "Data: %+v", &in)
+	} else {
+		Expect(err).To(HaveOccurred(), "Data: %#v", &in)
+	}
+
+	if shouldBeValid {
+		err = k8sClient.Delete(ctx2, &in)
+		Expect(err).NotTo(HaveOccurred())
+	}
+}
+
+var _ = Describe("ClusterCollection webhook", func() {
+	dir := "testdata/clustercollection"
+	Context("validating", func() {
+		It("should create valid clustercollections", func() {
+			want := true
+			testValidateClusterCollection(mustOpen(dir, "validate_namespaces.yaml"), want)
+			testValidateClusterCollection(mustOpen(dir, "validate_selector.yaml"), want)
+			_ = want
+		})
+		It("should not create invalid clustercollections", func() {
+			want := false
+			testValidateClusterCollection(mustOpen(dir, "validate_wrong_no_namespaces.yaml"), want)
+			testValidateClusterCollection(mustOpen(dir, "validate_wrong_namespace.yaml"), want)
+			testValidateClusterCollection(mustOpen(dir, "validate_wrong_url_eq.yaml"), want)
+			testValidateClusterCollection(mustOpen(dir, "validate_wrong_reponame_dup.yaml"), want)
+			_ = want
+		})
+	})
+})
+
+func testValidateClusterCollection(rIn io.Reader, shouldBeValid bool) {
+	ctx2 := context.Background()
+
+	var in v1beta1.ClusterCollection
+
+	err := yaml.NewYAMLOrJSONDecoder(rIn, 32).Decode(&in)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = k8sClient.Create(ctx2, &in)
+	if shouldBeValid {
+		Expect(err).NotTo(HaveOccurred(), "Data: %+v", &in)
+	} else {
+		Expect(err).To(HaveOccurred(), "Data: %#v", &in)
+	}
+
+	if shouldBeValid {
+		err = k8sClient.Delete(ctx2, &in)
+		Expect(err).NotTo(HaveOccurred())
+	}
+}
+
+var _ = Describe("BackupPolicy webhook", func() {
+	dir := "testdata/backuppolicy"
+	Context("validating", func() {
+		It("should not create invalid backuppolicies", func() {
+			var in v1beta1.BackupPolicy
+			err := yaml.NewYAMLOrJSONDecoder(mustOpen(dir, "validate_wrong_pattern.yaml"), 32).Decode(&in)
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Create(context.Background(), &in)
+			Expect(err).To(HaveOccurred())
+		})
+		It("should enforce backuppolicies", func() {
+			ctx2 := context.Background()
+
+			var policy v1beta1.BackupPolicy
+			err := yaml.NewYAMLOrJSONDecoder(mustOpen(dir, "testpolicy.yaml"), 32).Decode(&policy)
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Create(ctx2, &policy)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(k8sClient.Delete(ctx2, &policy)).To(Succeed()) }()
+
+			// wait for the webhook to see the policy
+			Eventually(func() error {
+				var in v1beta1.Repository
+				err := yaml.NewYAMLOrJSONDecoder(mustOpen("testdata/repository", "validate_wrong_policy.yaml"), 32).Decode(&in)
+				Expect(err).NotTo(HaveOccurred())
+				err = k8sClient.Create(ctx2, &in)
+				if err == nil {
+					Expect(k8sClient.Delete(ctx2, &in)).To(Succeed())
+				}
+				return err
+			}).Should(HaveOccurred())
+
+			testValidateRepository(mustOpen("testdata/repository", "validate_policy.yaml"), true)
+			testValidateRepository(mustOpen("testdata/repository", "validate_wrong_policy.yaml"), false)
+			testValidateCollection(mustOpen("testdata/collection", "validate_wrong_policy.yaml"), false)
+			testValidateRestore(mustOpen("testdata/restore", "validate_policy.yaml"), true)
+			testValidateRestore(mustOpen("testdata/restore", "validate_wrong_policy.yaml"), false)
+		})
+	})
+})
+
+var _ = Describe("Notifier webhook", func() {
+	dir := "testdata/notifier"
+	Context("validating", func() {
+		It("should create valid notifiers", func() {
+			for _, f := range []string{"validate_webhook.yaml", "validate_smtp.yaml"} {
+				var in v1beta1.Notifier
+				err := yaml.NewYAMLOrJSONDecoder(mustOpen(dir, f), 32).Decode(&in)
+				Expect(err).NotTo(HaveOccurred())
+				err = k8sClient.Create(context.Background(), &in)
+				Expect(err).NotTo(HaveOccurred(), f)
+				Expect(k8sClient.Delete(context.Background(), &in)).To(Succeed())
+			}
+		})
+		It("should not create invalid notifiers", func() {
+			for _, f := range []string{"validate_no_sink.yaml", "validate_no_url.yaml", "validate_wrong_template.yaml",
+				"validate_loopback.yaml", "validate_metadata_service.yaml", "validate_smtp_localhost.yaml"} {
+				var in v1beta1.Notifier
+				err := yaml.NewYAMLOrJSONDecoder(mustOpen(dir, f), 32).Decode(&in)
+				Expect(err).NotTo(HaveOccurred())
+				err = k8sClient.Create(context.Background(), &in)
+				Expect(err).To(HaveOccurred(), f)
+			}
+		})
+	})
+})
+
+func mustCreateBackupClass(rIn io.Reader) *v1beta1.BackupClass {
+	var cls v1beta1.BackupClass
+	err := yaml.NewYAMLOrJSONDecoder(rIn, 32).Decode(&cls)
+	Expect(err).NotTo(HaveOccurred())
+	err = k8sClient.Create(context.Background(), &cls)
+	Expect(err).NotTo(HaveOccurred())
+	return &cls
+}
+
 func mustOpen(filePath ...string) io.Reader {
 	f, err := os.Open(filepath.Join(filePath...))
 	if err != nil {
@@ -0,0 +1,60 @@
+// metadata-exporter exports forge metadata of a repository as JSON files.
+// It runs as an init container of backup Jobs and the git container commits the files to the destination.
+// With --action=archive or --action=delete, it archives or deletes the project instead in cleanup Jobs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ebiiim/gitbackup/internal/forge"
+)
+
+// TokenEnv is the name of the environment variable that contains the API token.
+const TokenEnv = "GITBACKUP_FORGE_TOKEN"
+
+func main() {
+	var action, kind, apiURL, project, output string
+	flag.StringVar(&action, "action", "export", "The action to do. (export, archive or delete)")
+	flag.StringVar(&kind, "forge", "", "The type of the forge. (GitHub, GitLab or Gitea)")
+	flag.StringVar(&apiURL, "api-url", "", "The base URL of the forge API.")
+	flag.StringVar(&project, "project", "", "The path of the project e.g. owner/name.")
+	flag.StringVar(&output, "output", "/metadata", "The directory to write metadata to.")
+	flag.Parse()
+
+	if kind == "" || apiURL == "" || project == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	e := &forge.Exporter{
+		Kind:    forge.Kind(kind),
+		APIURL:  apiURL,
+		Project: project,
+		Token:   os.Getenv(TokenEnv),
+	}
+	fmt.Printf("metadata-exporter: %s %s project %s on %s\n", action, kind, project, apiURL)
+	var err error
+	switch action {
+	case "export":
+		err = e.Export(ctx, output)
+	case "archive":
+		err = e.Archive(ctx)
+	case "delete":
+		err = e.Delete(ctx)
+	default:
+		err = fmt.Errorf("unknown action %s", action)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "metadata-exporter: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("metadata-exporter: completed")
+}
@@ -0,0 +1,334 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchv1apply "k8s.io/client-go/applyconfigurations/batch/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+
+// reconcileFinalizer adds CleanupFinalizer to repo if its DeletionPolicy is not Retain and removes it otherwise.
+func (r *RepositoryReconciler) reconcileFinalizer(ctx context.Context, repo *v1.Repository) error {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileFinalizer")
+
+	want := repo.GetDeletionPolicy() != v1.DeletionRetain
+	if want == controllerutil.ContainsFinalizer(repo, v1.CleanupFinalizer) {
+		return nil
+	}
+	patch := client.MergeFrom(repo.DeepCopy())
+	if want {
+		controllerutil.AddFinalizer(repo, v1.CleanupFinalizer)
+	} else {
+		controllerutil.RemoveFinalizer(repo, v1.CleanupFinalizer)
+	}
+	if err := r.Patch(ctx, repo, patch); err != nil {
+		lg.Error(err, "unable to update finalizers")
+		return err
+	}
+	lg.Info("finalizers updated", "deletionPolicy", repo.GetDeletionPolicy())
+	return nil
+}
+
+// reconcileDeletion cleans up the destination of repo according to its DeletionPolicy
+// and removes CleanupFinalizer when the cleanup Job succeeds.
+// The cleanup Job is created after the CronJob and the running backup Jobs are deleted.
+// A failed cleanup blocks the deletion until the Job is deleted to retry or DeletionPolicy is changed to Retain.
+func (r *RepositoryReconciler) reconcileDeletion(ctx context.Context, repo v1.Repository) error {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileDeletion")
+
+	if !controllerutil.ContainsFinalizer(&repo, v1.CleanupFinalizer) {
+		lg.Info("Repository is being deleted")
+		return nil
+	}
+	if repo.GetDeletionPolicy() == v1.DeletionRetain {
+		return r.removeFinalizer(ctx, repo)
+	}
+
+	// stop backups so that they do not push to the destination during the cleanup
+	stopped, err := r.stopBackups(ctx, repo)
+	if err != nil {
+		return err
+	}
+	if !stopped {
+		status := repo.Status.DeepCopy()
+		meta.SetStatusCondition(&repo.Status.Conditions, metav1.Condition{
+			Type:               v1.ConditionCleanedUp,
+			Status:             metav1.ConditionFalse,
+			Reason:             "WaitingForBackups",
+			Message:            "waiting for the backup CronJob and Jobs to be deleted before the cleanup",
+			ObservedGeneration: repo.Generation,
+		})
+		// the deletion of the CronJob and the Jobs triggers the next reconciliation
+		return r.updateStatus(ctx, repo, *status)
+	}
+
+	job, err := r.reconcileCleanupJob(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	status := repo.Status.DeepCopy()
+	done := r.reconcileCleanupCondition(ctx, &repo, job)
+	if err := r.updateStatus(ctx, repo, *status); err != nil {
+		return err
+	}
+	if !done {
+		return nil
+	}
+	return r.removeFinalizer(ctx, repo)
+}
+
+// stopBackups deletes the CronJob and the running backup Jobs of repo,
+// and returns true if they are gone and no backup can push to the destination anymore.
+// The running Jobs are deleted in the foreground so that they remain until their Pods are gone.
+func (r *RepositoryReconciler) stopBackups(ctx context.Context, repo v1.Repository) (bool, error) {
+	lg := log.FromContext(ctx)
+
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs, client.InNamespace(repo.Namespace), client.MatchingLabels(jobLabels(repo))); err != nil {
+		lg.Error(err, "unable to list Jobs")
+		return false, err
+	}
+	stopped := true
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Name == repo.GetOwnedCleanupJobName() {
+			continue
+		}
+		if t, _ := finishedAt(*job); t != nil {
+			continue
+		}
+		stopped = false
+		if !job.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationForeground)); err != nil && !errors.IsNotFound(err) {
+			lg.Error(err, "unable to delete backup Job", "job", job.Name)
+			return false, err
+		}
+		lg.Info("backup Job deleted", "job", job.Name)
+	}
+
+	cronJob := &batchv1.CronJob{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: repo.Namespace, Name: repo.GetOwnedCronJobName()}, cronJob)
+	if errors.IsNotFound(err) {
+		return stopped, nil
+	}
+	if err != nil {
+		lg.Error(err, "unable to get CronJob")
+		return false, err
+	}
+	if err := r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		lg.Error(err, "unable to delete CronJob")
+		return false, err
+	}
+	return false, nil
+}
+
+func (r *RepositoryReconciler) removeFinalizer(ctx context.Context, repo v1.Repository) error {
+	lg := log.FromContext(ctx)
+
+	patch := client.MergeFrom(repo.DeepCopy())
+	controllerutil.RemoveFinalizer(&repo, v1.CleanupFinalizer)
+	if err := r.Patch(ctx, &repo, patch); err != nil {
+		lg.Error(err, "unable to remove finalizer")
+		return err
+	}
+	lg.Info("finalizer removed", "deletionPolicy", repo.GetDeletionPolicy())
+	return nil
+}
+
+// reconcileCleanupCondition sets the CleanedUp condition to repo.Status from job and returns true if job succeeded.
+func (r *RepositoryReconciler) reconcileCleanupCondition(ctx context.Context, repo *v1.Repository, job *batchv1.Job) bool {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileCleanupCondition")
+
+	policy := repo.GetDeletionPolicy()
+	cond := metav1.Condition{
+		Type:               v1.ConditionCleanedUp,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Running",
+		Message:            fmt.Sprintf("cleanup Job %s is running (deletionPolicy: %s)", job.Name, policy),
+		ObservedGeneration: repo.Generation,
+	}
+	t, succeeded := finishedAt(*job)
+	switch {
+	case t == nil:
+	case succeeded:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "Succeeded"
+		cond.Message = fmt.Sprintf("cleanup Job %s succeeded (deletionPolicy: %s)", job.Name, policy)
+		// the default branch is kept as forges refuse to delete it
+		var report jobReport
+		if msg := terminationMessage(ctx, r.APIReader, job); json.Unmarshal([]byte(msg), &report) == nil && report.Message != "" {
+			cond.Message += ": " + report.Message
+			r.Recorder.Eventf(repo, corev1.EventTypeWarning, "CleanupIncomplete", "%s", report.Message)
+		}
+	default:
+		msg := terminationMessage(ctx, r.APIReader, job)
+		st := runStatus(*job, msg)
+		// the forge container does not write a report and its logs are used as the termination message
+		if msg != "" && !json.Valid([]byte(msg)) {
+			st.Message = msg
+		}
+		cond.Reason = "Failed"
+		cond.Message = fmt.Sprintf("cleanup Job %s failed with %s: %s; delete the Job to retry or set deletionPolicy to Retain",
+			job.Name, st.Reason, st.Message)
+	}
+	meta.SetStatusCondition(&repo.Status.Conditions, cond)
+	return succeeded
+}
+
+// reconcileCleanupJob returns the cleanup Job of repo and creates it if it does not exist.
+// The Job deletes or archives the destination via the forge API if DestinationForge is specified,
+// or deletes all refs but the default branch in the destination with git otherwise.
+func (r *RepositoryReconciler) reconcileCleanupJob(ctx context.Context, repo v1.Repository) (*batchv1.Job, error) {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileCleanupJob")
+
+	var cur batchv1.Job
+	err := r.Get(ctx, client.ObjectKey{Namespace: repo.Namespace, Name: repo.GetOwnedCleanupJobName()}, &cur)
+	if err == nil {
+		return &cur, nil
+	}
+	if !errors.IsNotFound(err) {
+		lg.Error(err, "unable to get cleanup Job")
+		return nil, err
+	}
+
+	podSpec := corev1apply.PodSpec().WithRestartPolicy(corev1.RestartPolicyNever)
+	if f := repo.Spec.DestinationForge; f != nil {
+		project, err := repo.GetDestinationForgeProject()
+		if err != nil {
+			lg.Error(err, "unable to get destination forge project")
+			return nil, err
+		}
+		apiURL, err := repo.GetDestinationForgeAPIURL()
+		if err != nil {
+			lg.Error(err, "unable to get destination forge API URL")
+			return nil, err
+		}
+		action := "delete"
+		if repo.GetDeletionPolicy() == v1.DeletionArchive {
+			action = "archive"
+		}
+		image, err := repo.GetDestinationForgeImage()
+		if err != nil {
+			lg.Error(err, "unable to get destination forge image")
+			return nil, err
+		}
+		podSpec.WithContainers(corev1apply.Container().
+			WithName("forge").
+			WithImage(image).
+			WithCommand(
+				"/metadata-exporter",
+				"--action="+action,
+				"--forge="+string(f.Forge),
+				"--api-url="+apiURL,
+				"--project="+project,
+			).
+			WithEnv(corev1apply.EnvVar().
+				WithName("GITBACKUP_FORGE_TOKEN").
+				WithValueFrom(corev1apply.EnvVarSource().
+					WithSecretKeyRef(corev1apply.SecretKeySelector().
+						WithName(f.Token.Name).
+						WithKey(f.Token.Key)))).
+			WithTerminationMessagePolicy(corev1.TerminationMessageFallbackToLogsOnError))
+	} else {
+		var retry *v1.RetryPolicy
+		if repo.Spec.JobPolicy != nil {
+			retry = repo.Spec.JobPolicy.Retry
+		}
+		script := cleanupScript(repo.Spec.Destination.URL, retry)
+		volumes, volumeMounts := gitVolumes(repo.GetGitConfigName(), repo.GetCredentials(), nil)
+		homeVols, homeMounts := homeVolumes()
+		volumes = append(volumes, homeVols...)
+		volumeMounts = append(volumeMounts, homeMounts...)
+		restricted, err := urlsRestricted(ctx, r.Client, repo.Namespace)
+		if err != nil {
+			lg.Error(err, "unable to check BackupPolicies")
+			return nil, err
+		}
+		podSpec.WithContainers(gitContainer(repo.GetGitImage(), script, volumeMounts, restricted)).
+			WithVolumes(volumes...)
+	}
+	if err := applyPodOptions(podSpec, repo.Spec.PodOptions); err != nil {
+		lg.Error(err, "unable to apply pod options")
+		return nil, err
+	}
+	if repo.Spec.ImagePullSecret != nil {
+		podSpec.WithImagePullSecrets(corev1apply.LocalObjectReference().
+			WithName(repo.Spec.ImagePullSecret.Name))
+	}
+
+	jobSpec := batchv1apply.JobSpec().
+		WithParallelism(1).
+		WithCompletions(1).
+		// A failed cleanup should be investigated rather than retried many times.
+		WithBackoffLimit(1).
+		WithTemplate(corev1apply.PodTemplateSpec().WithSpec(podSpec))
+	if p := repo.Spec.JobPolicy; p != nil && p.ActiveDeadlineSeconds != nil {
+		jobSpec.WithActiveDeadlineSeconds(*p.ActiveDeadlineSeconds)
+	}
+
+	gvk, err := apiutil.GVKForObject(&repo, r.Scheme)
+	if err != nil {
+		lg.Error(err, "unable to get GVK for Repository")
+		return nil, err
+	}
+	ownerReference := metav1apply.OwnerReference().
+		WithAPIVersion(gvk.GroupVersion().Identifier()).
+		WithKind(gvk.Kind).
+		WithName(repo.Name).
+		WithUID(repo.GetUID()).
+		WithBlockOwnerDeletion(true).
+		WithController(true)
+
+	labels := jobLabels(repo)
+	labels["app.kubernetes.io/component"] = "cleanup"
+	job := batchv1apply.Job(repo.GetOwnedCleanupJobName(), repo.Namespace).
+		WithLabels(labels).
+		WithOwnerReferences(ownerReference).
+		WithSpec(jobSpec)
+
+	lg.Info("do server-side apply")
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(job)
+	if err != nil {
+		return nil, err
+	}
+	patch := &unstructured.Unstructured{
+		Object: obj,
+	}
+	if err := r.Patch(ctx, patch, client.Apply, &client.PatchOptions{
+		FieldManager: ControllerName,
+		Force:        pointer.Bool(true),
+	}); err != nil {
+		lg.Error(err, "unable to create cleanup Job")
+		return nil, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(patch.Object, &cur); err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
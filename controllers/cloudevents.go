@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+	"github.com/ebiiim/gitbackup/internal/cloudevents"
+)
+
+// repositoryEventData is the data of CloudEvents.
+type repositoryEventData struct {
+	Name              string       `json:"name"`
+	Namespace         string       `json:"namespace"`
+	Collection        string       `json:"collection,omitempty"`
+	ClusterCollection string       `json:"clusterCollection,omitempty"`
+	Source            string       `json:"source"`
+	Destination       string       `json:"destination"`
+	JobName           string       `json:"jobName,omitempty"`
+	Result            v1.RunResult `json:"result,omitempty"`
+	Reason            string       `json:"reason,omitempty"`
+	Message           string       `json:"message,omitempty"`
+	Attempts          int32        `json:"attempts,omitempty"`
+	Duration          string       `json:"duration,omitempty"`
+	Stats             *v1.RunStats `json:"stats,omitempty"`
+}
+
+func newRepositoryEventData(repo v1.Repository) repositoryEventData {
+	d := repositoryEventData{
+		Name:              repo.Name,
+		Namespace:         repo.Namespace,
+		ClusterCollection: repo.Labels[v1beta1.ClusterCollectionLabel],
+		Source:            repo.Spec.Source.URL,
+		Destination:       repo.Spec.Destination.URL,
+	}
+	if owner := metav1.GetControllerOf(&repo); owner != nil && owner.Kind == "Collection" {
+		d.Collection = owner.Name
+	}
+	return d
+}
+
+// repositoryEventSource returns the source of the CloudEvents of repo.
+func repositoryEventSource(repo v1.Repository) string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/repositories/%s", v1.GroupVersion.String(), repo.Namespace, repo.Name)
+}
+
+// repositoryEvent returns a CloudEvent of repo. Its ID is "{key}/{typ}" where key is the UID of repo or the name of the Job
+// so that the events published again e.g. after a restart of the controller can be deduplicated.
+func repositoryEvent(repo v1.Repository, typ string, key, subject string, t time.Time, data repositoryEventData) cloudevents.Event {
+	return cloudevents.Event{
+		ID:      key + "/" + typ,
+		Source:  repositoryEventSource(repo),
+		Type:    typ,
+		Subject: subject,
+		Time:    t,
+		Data:    data,
+	}
+}
+
+// statusEvents returns the CloudEvents of the changes of the status of repo from old:
+// repository.created when the status is written for the first time,
+// and backup.succeeded or backup.failed when LastRun has changed.
+func statusEvents(repo v1.Repository, old v1.RepositoryStatus) []cloudevents.Event {
+	var events []cloudevents.Event
+	if len(old.Conditions) == 0 && len(repo.Status.Conditions) != 0 {
+		events = append(events, repositoryEvent(repo, cloudevents.RepositoryCreated, string(repo.UID), "",
+			repo.CreationTimestamp.Time, newRepositoryEventData(repo)))
+	}
+	run := repo.Status.LastRun
+	if run != nil && (old.LastRun == nil || old.LastRun.JobName != run.JobName) {
+		typ := cloudevents.BackupSucceeded
+		if run.Result == v1.RunFailed {
+			typ = cloudevents.BackupFailed
+		}
+		d := newRepositoryEventData(repo)
+		d.JobName = run.JobName
+		d.Result = run.Result
+		d.Reason = string(run.Reason)
+		d.Message = run.Message
+		d.Attempts = run.Attempts
+		if run.Duration != nil {
+			d.Duration = run.Duration.Duration.String()
+		}
+		d.Stats = run.Stats
+		var t time.Time
+		if run.CompletionTime != nil {
+			t = run.CompletionTime.Time
+		}
+		events = append(events, repositoryEvent(repo, typ, run.JobName, run.JobName, t, d))
+	}
+	return events
+}
+
+// publishStatusEvents publishes the CloudEvents of the changes of the status of repo from old.
+func (r *RepositoryReconciler) publishStatusEvents(ctx context.Context, repo v1.Repository, old v1.RepositoryStatus) {
+	if r.CloudEvents == nil {
+		return
+	}
+	lg := log.FromContext(ctx)
+	for _, e := range statusEvents(repo, old) {
+		lg.Info("publish CloudEvent", "type", e.Type, "id", e.ID)
+		r.CloudEvents.Publish(e)
+	}
+}
+
+// publishStartedEvents publishes backup.started of the running backup Jobs of repo
+// and sets StartedEventAnnotation to them so that the event is published once for each Job.
+func (r *RepositoryReconciler) publishStartedEvents(ctx context.Context, repo v1.Repository) error {
+	if r.CloudEvents == nil {
+		return nil
+	}
+	lg := log.FromContext(ctx)
+
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs, client.InNamespace(repo.Namespace), client.MatchingLabels(jobLabels(repo))); err != nil {
+		lg.Error(err, "unable to list Jobs")
+		return err
+	}
+	for _, job := range jobs.Items {
+		if job.Labels[v1.DryRunLabel] == "true" || job.Annotations[v1.StartedEventAnnotation] == "true" {
+			continue
+		}
+		if t, _ := finishedAt(job); t != nil || job.Status.StartTime == nil {
+			continue
+		}
+		d := newRepositoryEventData(repo)
+		d.JobName = job.Name
+		e := repositoryEvent(repo, cloudevents.BackupStarted, job.Name, job.Name, job.Status.StartTime.Time, d)
+		lg.Info("publish CloudEvent", "type", e.Type, "id", e.ID)
+		r.CloudEvents.Publish(e)
+
+		patch := client.MergeFrom(job.DeepCopy())
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		job.Annotations[v1.StartedEventAnnotation] = "true"
+		if err := r.Patch(ctx, &job, patch); err != nil {
+			lg.Error(err, "unable to set started-event annotation", "job", job.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// publishDeletedEvent publishes repository.deleted of repo.
+// It is called by the watch as deleted Repositories without finalizers are not reconciled.
+func (r *RepositoryReconciler) publishDeletedEvent(repo v1.Repository) {
+	t := time.Now()
+	if repo.DeletionTimestamp != nil {
+		t = repo.DeletionTimestamp.Time
+	}
+	r.CloudEvents.Publish(repositoryEvent(repo, cloudevents.RepositoryDeleted, string(repo.UID), "", t, newRepositoryEventData(repo)))
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+	"github.com/ebiiim/gitbackup/internal/cloudevents"
+)
+
+func Test_statusEvents(t *testing.T) {
+	repo := v1.Repository{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "repo1",
+			UID:       "uid1",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: v1.GroupVersion.String(), Kind: "Collection", Name: "coll1", Controller: pointer.Bool(true)},
+			},
+		},
+	}
+	ready := []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue}}
+	job0 := &v1.RunStatus{JobName: "job0", Result: v1.RunSucceeded}
+	job1 := &v1.RunStatus{JobName: "job1", Result: v1.RunFailed, Reason: v1.FailureAuth}
+	tests := []struct {
+		name    string
+		old     v1.RepositoryStatus
+		cur     v1.RepositoryStatus
+		wantIDs []string
+	}{
+		{"created", v1.RepositoryStatus{}, v1.RepositoryStatus{Conditions: ready}, []string{"uid1/" + cloudevents.RepositoryCreated}},
+		{"no changes", v1.RepositoryStatus{Conditions: ready, LastRun: job0}, v1.RepositoryStatus{Conditions: ready, LastRun: job0}, nil},
+		{"first backup", v1.RepositoryStatus{Conditions: ready}, v1.RepositoryStatus{Conditions: ready, LastRun: job0}, []string{"job0/" + cloudevents.BackupSucceeded}},
+		{"failed", v1.RepositoryStatus{Conditions: ready, LastRun: job0}, v1.RepositoryStatus{Conditions: ready, LastRun: job1}, []string{"job1/" + cloudevents.BackupFailed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repo
+			repo.Status = tt.cur
+			var ids []string
+			for _, e := range statusEvents(repo, tt.old) {
+				ids = append(ids, e.ID)
+				if e.Source != "/apis/gitbackup.ebiiim.com/v1/namespaces/default/repositories/repo1" {
+					t.Errorf("Source = %s", e.Source)
+				}
+				if d := e.Data.(repositoryEventData); d.Collection != "coll1" || d.Name != "repo1" {
+					t.Errorf("Data = %+v", d)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("statusEvents() IDs = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
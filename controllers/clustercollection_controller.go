@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+)
+
+// ClusterCollectionReconciler reconciles a ClusterCollection object
+type ClusterCollectionReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=clustercollections,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=clustercollections/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=clustercollections/finalizers,verbs=update
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=repositories,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// Reconcile moves the current state of the cluster closer to the desired state.
+func (r *ClusterCollectionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+	lg.Info("Reconcile")
+
+	var coll v1beta1.ClusterCollection
+	err := r.Get(ctx, req.NamespacedName, &coll)
+	if errors.IsNotFound(err) {
+		lg.Info("ClusterCollection is already deleted")
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		lg.Error(err, "unable to get ClusterCollection")
+		return ctrl.Result{}, err
+	}
+	if !coll.DeletionTimestamp.IsZero() {
+		lg.Info("ClusterCollection is being deleted")
+		return ctrl.Result{}, r.finalize(ctx, coll)
+	}
+
+	if !controllerutil.ContainsFinalizer(&coll, v1beta1.ClusterCollectionFinalizer) {
+		controllerutil.AddFinalizer(&coll, v1beta1.ClusterCollectionFinalizer)
+		if err := r.Update(ctx, &coll); err != nil {
+			lg.Error(err, "unable to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
+	failures, err := r.reconcileRepos(ctx, coll)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileStatus(ctx, coll, failures); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// finalize deletes all Repositories created by coll and removes the finalizer.
+func (r *ClusterCollectionReconciler) finalize(ctx context.Context, coll v1beta1.ClusterCollection) error {
+	lg := log.FromContext(ctx)
+	lg.Info("finalize")
+
+	if !controllerutil.ContainsFinalizer(&coll, v1beta1.ClusterCollectionFinalizer) {
+		return nil
+	}
+	// DeleteAllOf does not work across namespaces so list the Repositories in all namespaces and delete them one by one
+	var repos v1.RepositoryList
+	if err := r.List(ctx, &repos, client.MatchingLabels{v1beta1.ClusterCollectionLabel: coll.Name}); err != nil {
+		lg.Error(err, "unable to list Repositories")
+		return err
+	}
+	for _, repo := range repos.Items {
+		if err := r.Delete(ctx, &repo); client.IgnoreNotFound(err) != nil {
+			lg.Error(err, "unable to delete Repository", "obj", client.ObjectKeyFromObject(&repo))
+			return err
+		}
+	}
+	controllerutil.RemoveFinalizer(&coll, v1beta1.ClusterCollectionFinalizer)
+	if err := r.Update(ctx, &coll); err != nil {
+		lg.Error(err, "unable to remove finalizer")
+		return err
+	}
+	return nil
+}
+
+// targetNamespaces returns sorted namespaces that exist and are listed in or selected by cr.
+func targetNamespaces(nss []corev1.Namespace, cr v1beta1.ClusterCollectionRepo) ([]string, error) {
+	listed := make(map[string]struct{}, len(cr.Namespaces))
+	for _, ns := range cr.Namespaces {
+		listed[ns] = struct{}{}
+	}
+	var targets []string
+	for _, ns := range nss {
+		if !ns.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if _, ok := listed[ns.Name]; ok {
+			targets = append(targets, ns.Name)
+			continue
+		}
+		if cr.NamespaceSelector == nil {
+			continue
+		}
+		sel, err := metav1.LabelSelectorAsSelector(cr.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		if sel.Matches(labels.Set(ns.Labels)) {
+			targets = append(targets, ns.Name)
+		}
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+// reconcileRepos creates, updates and deletes the Repositories of coll in all namespaces.
+// It returns the Repositories that could not be reconciled with the errors.
+func (r *ClusterCollectionReconciler) reconcileRepos(ctx context.Context, coll v1beta1.ClusterCollection) ([]string, error) {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileRepos")
+
+	var nss corev1.NamespaceList
+	if err := r.List(ctx, &nss); err != nil {
+		lg.Error(err, "unable to list Namespaces")
+		return nil, err
+	}
+
+	var failures []string
+
+	type desiredRepo struct {
+		url   v1beta1.CollectionRepoURL
+		sched string
+	}
+	desiredRepoNames := coll.GetOwnedRepositoryNames()
+	desired := make(map[types.NamespacedName]desiredRepo)
+	var keys []types.NamespacedName
+	sched := coll.Spec.Schedule
+	for i, cr := range coll.Spec.Repos {
+		targets, err := targetNamespaces(nss.Items, cr)
+		if err != nil {
+			// the selector is validated by Validating Webhook so this should not happen
+			lg.Error(err, "unable to select namespaces", "index", i)
+			continue
+		}
+		for _, ns := range targets {
+			key := types.NamespacedName{Namespace: ns, Name: desiredRepoNames[i]}
+			if _, ok := desired[key]; ok {
+				lg.Info("duplicated Repository", "key", key)
+				continue
+			}
+			desired[key] = desiredRepo{url: cr.ForNamespace(ns), sched: sched}
+			keys = append(keys, key)
+			// the cron expression is validated by Validating Webhook so no need to handle errors here
+			sched, _ = v1beta1.CycleCronByMinuteInSameHour(sched)
+		}
+	}
+
+	// ensure Repositories that are no longer needed are deleted
+	var curRepos v1.RepositoryList
+	if err := r.List(ctx, &curRepos, client.MatchingLabels{v1beta1.ClusterCollectionLabel: coll.Name}); err != nil {
+		lg.Error(err, "unable to list Repositories")
+		failures = append(failures, fmt.Sprintf("unable to list Repositories: %v", err))
+	}
+	for _, repo := range curRepos.Items {
+		if _, ok := desired[client.ObjectKeyFromObject(&repo)]; !ok {
+			if err := r.Delete(ctx, &repo); client.IgnoreNotFound(err) != nil {
+				lg.Error(err, "unable to delete repo", "obj", repo)
+				failures = append(failures, fmt.Sprintf("unable to delete Repository %s: %v", client.ObjectKeyFromObject(&repo), err))
+			}
+		}
+	}
+
+	// ensure Repositories created
+	for _, key := range keys {
+		lg.Info("ensure Repository created", "key", key)
+		d := desired[key]
+
+		repo := &v1.Repository{}
+		repo.SetNamespace(key.Namespace)
+		repo.SetName(key.Name)
+
+		op, err := ctrl.CreateOrUpdate(ctx, r.Client, repo, func() error {
+			// labels are used instead of owner references so check them not to overwrite other Repositories
+			if repo.ResourceVersion != "" && repo.Labels[v1beta1.ClusterCollectionLabel] != coll.Name {
+				return fmt.Errorf("Repository %s is not managed by ClusterCollection %s", key, coll.Name)
+			}
+			if repo.Labels == nil {
+				repo.Labels = map[string]string{}
+			}
+			repo.Labels[v1beta1.ClusterCollectionLabel] = coll.Name
+			// ClusterCollection is a v1beta1 API so build the v1beta1 spec and convert it
+			spec := v1beta1.Repository{ObjectMeta: metav1.ObjectMeta{Name: repo.Name}, Spec: v1beta1.RepositorySpec{
+				Src:             d.url.Src,
+				Dst:             d.url.Dst,
+				Schedule:        d.sched,
+				TimeZone:        coll.Spec.TimeZone,
+				GitImage:        coll.Spec.GitImage,
+				ImagePullSecret: coll.Spec.ImagePullSecret,
+				GitConfig:       coll.Spec.GitConfig,
+				GitCredentials:  coll.Spec.GitCredentials,
+				PodOptions:      coll.Spec.PodOptions,
+				JobPolicy:       coll.Spec.JobPolicy,
+			}}
+			var converted v1.Repository
+			if err := spec.ConvertTo(&converted); err != nil {
+				return err
+			}
+			repo.Spec = converted.Spec
+			return nil
+		})
+		if err != nil {
+			lg.Error(err, "unable to create or update Repository", "key", key)
+			failures = append(failures, fmt.Sprintf("unable to create or update Repository %s: %v", key, err))
+			continue
+		}
+
+		lg.Info("Repository reconciled", "key", key, "op", op)
+	}
+
+	return failures, nil
+}
+
+// reconcileStatus counts the Repositories of coll in all namespaces by the results of their last backups
+// and sets the ReposReconciled condition with failures returned by reconcileRepos.
+func (r *ClusterCollectionReconciler) reconcileStatus(ctx context.Context, coll v1beta1.ClusterCollection, failures []string) error {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileStatus")
+
+	var repos v1.RepositoryList
+	if err := r.List(ctx, &repos, client.MatchingLabels{v1beta1.ClusterCollectionLabel: coll.Name}); err != nil {
+		lg.Error(err, "unable to list Repositories")
+		return err
+	}
+	status := *coll.Status.DeepCopy()
+	status.Repos, status.Ready, status.Failing = 0, 0, 0
+	for _, repo := range repos.Items {
+		status.Repos++
+		if run := repo.Status.LastRun; run != nil {
+			switch run.Result {
+			case v1.RunSucceeded:
+				status.Ready++
+			case v1.RunFailed:
+				status.Failing++
+			}
+		}
+	}
+	cond := metav1.Condition{
+		Type:               v1beta1.ConditionReposReconciled,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Reconciled",
+		Message:            "all Repositories are reconciled",
+		ObservedGeneration: coll.Generation,
+	}
+	if len(failures) != 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "Failed"
+		cond.Message = strings.Join(failures, "; ")
+	}
+	meta.SetStatusCondition(&status.Conditions, cond)
+
+	if equality.Semantic.DeepEqual(status, coll.Status) {
+		return nil
+	}
+	coll.Status = status
+	if err := r.Status().Update(ctx, &coll); err != nil {
+		lg.Error(err, "unable to update status")
+		return err
+	}
+	lg.Info("status updated", "repos", status.Repos, "ready", status.Ready, "failing", status.Failing, "reconciled", cond.Status)
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterCollectionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1beta1.ClusterCollection{}).
+		Watches(&source.Kind{Type: &v1.Repository{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			name, ok := o.GetLabels()[v1beta1.ClusterCollectionLabel]
+			if !ok {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name}}}
+		})).
+		// namespaces may be created or relabeled
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			var colls v1beta1.ClusterCollectionList
+			if err := mgr.GetClient().List(context.Background(), &colls); err != nil {
+				return nil
+			}
+			reqs := make([]reconcile.Request, len(colls.Items))
+			for i, coll := range colls.Items {
+				reqs[i] = reconcile.Request{NamespacedName: types.NamespacedName{Name: coll.Name}}
+			}
+			return reqs
+		})).
+		Complete(r)
+}
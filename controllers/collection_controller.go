@@ -8,10 +8,12 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	v1 "github.com/ebiiim/gitbackup/api/v1"
 	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
 )
 
@@ -19,18 +21,21 @@ import (
 type CollectionReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// Recorder records the decisions to prune and adopt Repositories as events of Collections.
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=collections,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=collections/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=collections/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile moves the current state of the cluster closer to the desired state.
 func (r *CollectionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	lg := log.FromContext(ctx)
 	lg.Info("Reconcile")
 
-	var coll v1beta1.Collection
+	var coll v1.Collection
 	err := r.Get(ctx, req.NamespacedName, &coll)
 	if errors.IsNotFound(err) {
 		lg.Info("Collection is already deleted")
@@ -54,17 +59,20 @@ func (r *CollectionReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	if err := r.reconcileRepos(ctx, coll); err != nil {
 		return ctrl.Result{}, err
 	}
+	if err := r.reconcileStatus(ctx, coll); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	return ctrl.Result{}, nil
 }
 
-func (r *CollectionReconciler) reconcileGitConfig(ctx context.Context, coll v1beta1.Collection) error {
+func (r *CollectionReconciler) reconcileGitConfig(ctx context.Context, coll v1.Collection) error {
 	lg := log.FromContext(ctx)
 	lg.Info("reconcileGitConfig")
 
 	cmName := coll.GetOwnedConfigMapName()
 
-	if coll.Spec.GitConfig.Name != cmName {
+	if coll.GetGitConfigName() != cmName {
 		lg.Info("GitConfig specified")
 		return nil
 	}
@@ -92,11 +100,11 @@ func (r *CollectionReconciler) reconcileGitConfig(ctx context.Context, coll v1be
 	return nil
 }
 
-func (r *CollectionReconciler) reconcileGitCredentials(ctx context.Context, coll v1beta1.Collection) error {
+func (r *CollectionReconciler) reconcileGitCredentials(ctx context.Context, coll v1.Collection) error {
 	lg := log.FromContext(ctx)
 	lg.Info("reconcileGitCredentials")
 
-	if coll.Spec.GitCredentials != nil {
+	if coll.Spec.SourceCredentials != nil || coll.Spec.DestinationCredentials != nil {
 		lg.Info("GitCredentials specified")
 		return nil
 	}
@@ -114,7 +122,7 @@ func sameOwner(a, b metav1.OwnerReference) bool {
 	return (aa.Group == bb.Group) && (a.Kind == b.Kind) && (a.Name == b.Name)
 }
 
-func (r *CollectionReconciler) reconcileRepos(ctx context.Context, coll v1beta1.Collection) error {
+func (r *CollectionReconciler) reconcileRepos(ctx context.Context, coll v1.Collection) error {
 	lg := log.FromContext(ctx)
 	lg.Info("reconcileRepos")
 
@@ -126,8 +134,8 @@ func (r *CollectionReconciler) reconcileRepos(ctx context.Context, coll v1beta1.
 		desiredRepoNamesMap[name] = struct{}{}
 	}
 
-	// ensure Repositories that are no longer needed are deleted
-	var curRepos v1beta1.RepositoryList
+	// ensure Repositories that are no longer needed are pruned
+	var curRepos v1.RepositoryList
 	if err := r.List(ctx, &curRepos, &client.ListOptions{Namespace: coll.Namespace}); err != nil {
 		lg.Error(err, "unable to list Repositories")
 	}
@@ -136,40 +144,72 @@ func (r *CollectionReconciler) reconcileRepos(ctx context.Context, coll v1beta1.
 			continue
 		}
 		if _, ok := desiredRepoNamesMap[repo.Name]; !ok {
-			if err := r.Delete(ctx, &repo); err != nil {
-				lg.Error(err, "unable to delete repo", "obj", repo)
-			}
+			r.pruneRepo(ctx, coll, repo)
 		}
 	}
 
 	// ensure Repositories created
 	sched := coll.Spec.Schedule
+	created := make(map[string]struct{}, len(desiredRepoNames))
 	for i, cr := range coll.Spec.Repos {
+		// duplicates are rejected by Validating Webhook but the first one wins for Collections created before
+		if _, ok := created[desiredRepoNames[i]]; ok {
+			lg.Info("duplicated Repository", "name", desiredRepoNames[i], "index", i)
+			continue
+		}
+		created[desiredRepoNames[i]] = struct{}{}
 		lg.Info("ensure Repository created", "name", desiredRepoNames[i])
 
-		repo := &v1beta1.Repository{}
+		repo := &v1.Repository{}
 		repo.SetNamespace(coll.Namespace)
 		repo.SetName(desiredRepoNames[i])
 
-		op, err := ctrl.CreateOrUpdate(ctx, r.Client, repo, func() error {
-			repo.Spec = v1beta1.RepositorySpec{
-				Src:             cr.Src,
-				Dst:             cr.Dst,
-				Schedule:        sched,
-				TimeZone:        coll.Spec.TimeZone,
-				GitImage:        coll.Spec.GitImage,
-				ImagePullSecret: coll.Spec.ImagePullSecret,
-				GitConfig:       coll.Spec.GitConfig,
-				GitCredentials:  coll.Spec.GitCredentials,
+		// adopt an existing Repository unless another controller or a ClusterCollection manages it
+		adopt := false
+		if err := r.Get(ctx, client.ObjectKeyFromObject(repo), repo); err == nil && !metav1.IsControlledBy(repo, &coll) {
+			if owner := metav1.GetControllerOf(repo); owner != nil {
+				lg.Info("Repository is controlled by another object", "name", repo.Name, "owner", owner.Kind+"/"+owner.Name)
+				r.Recorder.Eventf(&coll, corev1.EventTypeWarning, "AdoptionFailed",
+					"Repository %s is not adopted as it is controlled by %s %s", repo.Name, owner.Kind, owner.Name)
+				sched, _ = v1.CycleCronByMinuteInSameHour(sched)
+				continue
+			}
+			// Repositories of ClusterCollections have no owner references as their owners are cluster-scoped
+			if name, ok := repo.Labels[v1beta1.ClusterCollectionLabel]; ok {
+				lg.Info("Repository is managed by a ClusterCollection", "name", repo.Name, "clusterCollection", name)
+				r.Recorder.Eventf(&coll, corev1.EventTypeWarning, "AdoptionFailed",
+					"Repository %s is not adopted as it is managed by ClusterCollection %s", repo.Name, name)
+				sched, _ = v1.CycleCronByMinuteInSameHour(sched)
+				continue
 			}
+			adopt = true
+		}
+
+		op, err := ctrl.CreateOrUpdate(ctx, r.Client, repo, func() error {
+			// set only the fields managed by the Collection so that adopted Repositories keep
+			// the other fields e.g. encryption, refs, snapshots and deletionPolicy
+			repo.Spec.Source = coll.GetSource(cr)
+			repo.Spec.Destination = coll.GetDestination(cr)
+			repo.Spec.Schedule = sched
+			repo.Spec.BackupClassName = coll.Spec.BackupClassName
+			repo.Spec.TimeZone = coll.Spec.TimeZone
+			repo.Spec.GitImage = coll.Spec.GitImage
+			repo.Spec.ImagePullSecret = coll.Spec.ImagePullSecret
+			repo.Spec.GitConfig = &corev1.LocalObjectReference{Name: coll.GetGitConfigName()}
+			repo.Spec.PodOptions = coll.Spec.PodOptions
+			repo.Spec.JobPolicy = coll.Spec.JobPolicy
+			repo.Spec.Notifications = coll.Spec.Notifications
+			repo.Spec.MaxAge = coll.Spec.MaxAge
 			return ctrl.SetControllerReference(&coll, repo, r.Scheme)
 		})
 		if err != nil {
 			// NOTE: A Repository with the same name as desiredRepoNames[i] may exist
 			lg.Error(err, "unable to create or update Repository", "name", desiredRepoNames[i])
+		} else if adopt {
+			r.Recorder.Eventf(&coll, corev1.EventTypeNormal, "Adopted", "Repository %s is adopted", repo.Name)
 		}
 		// the cron expression is validated by Validating Webhook so no need to handle errors here
-		sched, _ = v1beta1.CycleCronByMinuteInSameHour(sched)
+		sched, _ = v1.CycleCronByMinuteInSameHour(sched)
 
 		lg.Info("Repository reconciled", "name", desiredRepoNames[i], "op", op)
 	}
@@ -177,10 +217,83 @@ func (r *CollectionReconciler) reconcileRepos(ctx context.Context, coll v1beta1.
 	return nil
 }
 
+// reconcileStatus counts the Repositories controlled by coll by the results of their last backups.
+func (r *CollectionReconciler) reconcileStatus(ctx context.Context, coll v1.Collection) error {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileStatus")
+
+	var repos v1.RepositoryList
+	if err := r.List(ctx, &repos, client.InNamespace(coll.Namespace)); err != nil {
+		lg.Error(err, "unable to list Repositories")
+		return err
+	}
+	var status v1.CollectionStatus
+	for _, repo := range repos.Items {
+		if !metav1.IsControlledBy(&repo, &coll) {
+			continue
+		}
+		status.Repos++
+		if run := repo.Status.LastRun; run != nil {
+			switch run.Result {
+			case v1.RunSucceeded:
+				status.Ready++
+			case v1.RunFailed:
+				status.Failing++
+			}
+		}
+	}
+	if status == coll.Status {
+		return nil
+	}
+	coll.Status = status
+	if err := r.Status().Update(ctx, &coll); err != nil {
+		lg.Error(err, "unable to update status")
+		return err
+	}
+	lg.Info("status updated", "repos", status.Repos, "ready", status.Ready, "failing", status.Failing)
+	return nil
+}
+
+// pruneRepo deletes or orphans repo that is no longer in coll according to coll.Spec.PruneRemoved.
+// An orphaned Repository uses its own GitConfig instead of the one of coll that will be deleted with coll.
+func (r *CollectionReconciler) pruneRepo(ctx context.Context, coll v1.Collection, repo v1.Repository) {
+	lg := log.FromContext(ctx)
+
+	if p := coll.Spec.PruneRemoved; p != nil && *p == v1.PruneOrphan {
+		patch := client.MergeFrom(repo.DeepCopy())
+		var refs []metav1.OwnerReference
+		for _, ref := range repo.OwnerReferences {
+			if ref.UID != coll.UID {
+				refs = append(refs, ref)
+			}
+		}
+		repo.SetOwnerReferences(refs)
+		if repo.Spec.GitConfig != nil && repo.Spec.GitConfig.Name == coll.GetOwnedConfigMapName() {
+			repo.Spec.GitConfig = nil
+		}
+		if err := r.Patch(ctx, &repo, patch); err != nil {
+			lg.Error(err, "unable to orphan repo", "name", repo.Name)
+			r.Recorder.Eventf(&coll, corev1.EventTypeWarning, "PruneFailed", "unable to orphan Repository %s: %v", repo.Name, err)
+			return
+		}
+		lg.Info("Repository orphaned", "name", repo.Name)
+		r.Recorder.Eventf(&coll, corev1.EventTypeNormal, "Orphaned", "Repository %s is removed from the Collection and orphaned", repo.Name)
+		return
+	}
+
+	if err := r.Delete(ctx, &repo); err != nil {
+		lg.Error(err, "unable to delete repo", "obj", repo)
+		r.Recorder.Eventf(&coll, corev1.EventTypeWarning, "PruneFailed", "unable to delete Repository %s: %v", repo.Name, err)
+		return
+	}
+	lg.Info("Repository deleted", "name", repo.Name)
+	r.Recorder.Eventf(&coll, corev1.EventTypeNormal, "Pruned", "Repository %s is removed from the Collection and deleted", repo.Name)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CollectionReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1beta1.Collection{}).
-		Owns(&v1beta1.Repository{}).
+		For(&v1.Collection{}).
+		Owns(&v1.Repository{}).
 		Complete(r)
 }
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchv1apply "k8s.io/client-go/applyconfigurations/batch/v1"
+	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+// reconcileDryRunJob creates a dry-run Job if DryRunAnnotation is set to repo and removes the annotation.
+// The Job is named after the value of the annotation so that it is created only once for each request.
+// referencesHash is set to the pod template in the same way as the CronJob.
+func (r *RepositoryReconciler) reconcileDryRunJob(ctx context.Context, repo *v1.Repository, referencesHash string) error {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileDryRunJob")
+
+	req, ok := repo.Annotations[v1.DryRunAnnotation]
+	if !ok {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(req))
+	name := repo.GetOwnedDryRunJobName(hex.EncodeToString(sum[:])[:8])
+
+	err := r.Get(ctx, client.ObjectKey{Namespace: repo.Namespace, Name: name}, &batchv1.Job{})
+	if errors.IsNotFound(err) {
+		if err := r.createDryRunJob(ctx, *repo, name, referencesHash); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(repo, corev1.EventTypeNormal, "DryRunStarted", "dry-run Job %s is created", name)
+	} else if err != nil {
+		lg.Error(err, "unable to get dry-run Job")
+		return err
+	}
+
+	patch := client.MergeFrom(repo.DeepCopy())
+	delete(repo.Annotations, v1.DryRunAnnotation)
+	if err := r.Patch(ctx, repo, patch); err != nil {
+		lg.Error(err, "unable to remove dry-run annotation")
+		return err
+	}
+	lg.Info("dry-run requested", "job", name)
+	return nil
+}
+
+func (r *RepositoryReconciler) createDryRunJob(ctx context.Context, repo v1.Repository, name, referencesHash string) error {
+	lg := log.FromContext(ctx)
+
+	jobSpec, err := r.backupJobSpec(ctx, repo, referencesHash, true)
+	if err != nil {
+		return err
+	}
+
+	gvk, err := apiutil.GVKForObject(&repo, r.Scheme)
+	if err != nil {
+		lg.Error(err, "unable to get GVK for Repository")
+		return err
+	}
+	ownerReference := metav1apply.OwnerReference().
+		WithAPIVersion(gvk.GroupVersion().Identifier()).
+		WithKind(gvk.Kind).
+		WithName(repo.Name).
+		WithUID(repo.GetUID()).
+		WithBlockOwnerDeletion(true).
+		WithController(true)
+
+	job := batchv1apply.Job(name, repo.Namespace).
+		WithLabels(backupJobLabels(repo, true)).
+		WithOwnerReferences(ownerReference).
+		WithSpec(jobSpec)
+
+	lg.Info("do server-side apply")
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(job)
+	if err != nil {
+		return err
+	}
+	patch := &unstructured.Unstructured{
+		Object: obj,
+	}
+	if err := r.Patch(ctx, patch, client.Apply, &client.PatchOptions{
+		FieldManager: ControllerName,
+		Force:        pointer.Bool(true),
+	}); err != nil {
+		lg.Error(err, "unable to create dry-run Job")
+		return err
+	}
+	return nil
+}
+
+// recordDryRun records an event with the result of a dry-run Job.
+func (r *RepositoryReconciler) recordDryRun(repo *v1.Repository, status v1.RunStatus) {
+	if status.Result != v1.RunSucceeded || status.DryRun == nil {
+		r.Recorder.Eventf(repo, corev1.EventTypeWarning, "DryRunFailed", "dry-run Job %s failed with %s: %s",
+			status.JobName, status.Reason, status.Message)
+		return
+	}
+	d := status.DryRun
+	msg := fmt.Sprintf("dry-run Job %s: %d created, %d updated, %d deleted", status.JobName, d.Created, d.Updated, d.Deleted)
+	if len(d.Changes) != 0 {
+		ss := make([]string, len(d.Changes))
+		for i, c := range d.Changes {
+			ss[i] = fmt.Sprintf("%s %s", c.Type, c.Ref)
+		}
+		msg += " (" + strings.Join(ss, ", ") + ")"
+	}
+	r.Recorder.Event(repo, corev1.EventTypeNormal, "DryRun", msg)
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list
+
+// terminationMessage returns the termination message of the last terminated container of the Pods of job.
+// c should be an uncached reader such as the manager's APIReader;
+// listing Pods with the cached client would start an informer caching every Pod in the cluster.
+func terminationMessage(ctx context.Context, c client.Reader, job *batchv1.Job) string {
+	lg := log.FromContext(ctx)
+
+	var pods corev1.PodList
+	if err := c.List(ctx, &pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		lg.Error(err, "unable to list Pods")
+		return ""
+	}
+	var last *corev1.ContainerStateTerminated
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			t := cs.State.Terminated
+			if t != nil && (last == nil || last.FinishedAt.Before(&t.FinishedAt)) {
+				last = t
+			}
+		}
+	}
+	if last == nil {
+		return ""
+	}
+	return strings.TrimSpace(last.Message)
+}
+
+// jobReport is written to the termination log by the backup script.
+type jobReport struct {
+	Reason   v1.FailureReason `json:"reason"`
+	Attempts int32            `json:"attempts"`
+	Message  string           `json:"message"`
+	// RefsDigest is written by backup Jobs if drift detection is enabled.
+	RefsDigest string `json:"refsDigest,omitempty"`
+	// Stats is written by backup Jobs that succeeded.
+	Stats *jobStats `json:"stats,omitempty"`
+	// DryRun is written by dry-run Jobs.
+	DryRun *v1.DryRunResult `json:"dryRun,omitempty"`
+}
+
+// jobStats is the statistics of the backup in jobReport.
+type jobStats struct {
+	Refs          int32  `json:"refs"`
+	DefaultBranch string `json:"defaultBranch"`
+	HeadCommit    string `json:"headCommit"`
+	SizeKiB       int64  `json:"sizeKiB"`
+}
+
+// finishedAt returns the time when job finished (nil if not finished) and whether it succeeded.
+func finishedAt(job batchv1.Job) (*metav1.Time, bool) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			if job.Status.CompletionTime != nil {
+				return job.Status.CompletionTime, true
+			}
+			return &c.LastTransitionTime, true
+		case batchv1.JobFailed:
+			return &c.LastTransitionTime, false
+		}
+	}
+	return nil, false
+}
+
+// finishedSince returns the Jobs in jobs that finished after the Job of last in the order they finished.
+// All finished Jobs are returned if last is nil,
+// and the ones that finished after last.CompletionTime are returned if the Job of last has been deleted.
+func finishedSince(jobs []batchv1.Job, last *v1.RunStatus) []batchv1.Job {
+	var finished []batchv1.Job
+	for _, job := range jobs {
+		if t, _ := finishedAt(job); t != nil {
+			finished = append(finished, job)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		ti, _ := finishedAt(finished[i])
+		tj, _ := finishedAt(finished[j])
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return finished[i].Name < finished[j].Name
+	})
+	if last == nil {
+		return finished
+	}
+	for i, job := range finished {
+		if job.Name == last.JobName {
+			return finished[i+1:]
+		}
+	}
+	var since []batchv1.Job
+	for _, job := range finished {
+		if t, _ := finishedAt(job); last.CompletionTime == nil || last.CompletionTime.Before(t) {
+			since = append(since, job)
+		}
+	}
+	return since
+}
+
+// consecutiveFailures returns the number of Jobs that have failed in a row after jobs finished in order,
+// where n is the number before them.
+func consecutiveFailures(n int32, jobs []batchv1.Job) int32 {
+	for _, job := range jobs {
+		if _, succeeded := finishedAt(job); succeeded {
+			n = 0
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// runStatus returns the RunStatus of the finished job from its condition and msg, the termination message of the backup script.
+func runStatus(job batchv1.Job, msg string) v1.RunStatus {
+	t, succeeded := finishedAt(job)
+	status := v1.RunStatus{
+		JobName:        job.Name,
+		Result:         v1.RunSucceeded,
+		CompletionTime: t,
+	}
+	if start := job.Status.StartTime; start != nil && t != nil {
+		status.Duration = &metav1.Duration{Duration: t.Sub(start.Time)}
+	}
+	var report jobReport
+	// the script did not write a report if it exited before running git commands
+	hasReport := msg != "" && json.Unmarshal([]byte(msg), &report) == nil
+	if hasReport {
+		status.Attempts = report.Attempts
+		status.RefsDigest = report.RefsDigest
+		if st := report.Stats; st != nil {
+			status.Stats = &v1.RunStats{
+				Refs:          st.Refs,
+				DefaultBranch: st.DefaultBranch,
+				HeadCommit:    st.HeadCommit,
+				Size:          resource.NewQuantity(st.SizeKiB*1024, resource.BinarySI),
+			}
+		}
+		status.DryRun = report.DryRun
+	}
+	if succeeded {
+		return status
+	}
+
+	status.Result = v1.RunFailed
+	status.Reason = v1.FailureUnknown
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == corev1.ConditionTrue {
+			status.Message = c.Message
+		}
+	}
+	if hasReport && report.Reason != "" {
+		status.Reason = report.Reason
+		status.Message = report.Message
+	}
+	return status
+}
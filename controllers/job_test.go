@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+func Test_runStatus(t *testing.T) {
+	now := metav1.NewTime(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	job := func(condType batchv1.JobConditionType, msg string) batchv1.Job {
+		j := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job1"}}
+		j.Status.Conditions = []batchv1.JobCondition{{Type: condType, Status: corev1.ConditionTrue, LastTransitionTime: now, Message: msg}}
+		if condType == batchv1.JobComplete {
+			j.Status.CompletionTime = &now
+		}
+		return j
+	}
+
+	tests := []struct {
+		name string
+		job  batchv1.Job
+		msg  string
+		want v1.RunStatus
+	}{
+		{"succeeded", job(batchv1.JobComplete, ""), `{"reason":"","attempts":2,"message":""}`,
+			v1.RunStatus{JobName: "job1", Result: v1.RunSucceeded, CompletionTime: &now, Attempts: 2}},
+		{"dry run", job(batchv1.JobComplete, ""), `{"reason":"","attempts":1,"message":"","dryRun":{"created":1,"updated":0,"deleted":2,"changes":[{"type":"Created","ref":"refs/heads/a"}]}}`,
+			v1.RunStatus{JobName: "job1", Result: v1.RunSucceeded, CompletionTime: &now, Attempts: 1, DryRun: &v1.DryRunResult{
+				Created: 1, Deleted: 2, Changes: []v1.RefChange{{Type: v1.RefCreated, Ref: "refs/heads/a"}}}}},
+		{"refs digest", job(batchv1.JobComplete, ""), `{"reason":"","attempts":1,"message":"","refsDigest":"abc"}`,
+			v1.RunStatus{JobName: "job1", Result: v1.RunSucceeded, CompletionTime: &now, Attempts: 1, RefsDigest: "abc"}},
+		{"drift", job(batchv1.JobFailed, "Job has reached the specified backoff limit"), `{"reason":"Drift","attempts":1,"message":"refs in the destination have been changed since the last backup","refsDigest":""}`,
+			v1.RunStatus{JobName: "job1", Result: v1.RunFailed, CompletionTime: &now, Attempts: 1, Reason: v1.FailureDrift, Message: "refs in the destination have been changed since the last backup"}},
+		{"stats", job(batchv1.JobComplete, ""), `{"reason":"","attempts":1,"message":"","refsDigest":"","stats":{"refs":12,"defaultBranch":"main","headCommit":"94ad362f","sizeKiB":2048}}`,
+			v1.RunStatus{JobName: "job1", Result: v1.RunSucceeded, CompletionTime: &now, Attempts: 1, Stats: &v1.RunStats{
+				Refs: 12, DefaultBranch: "main", HeadCommit: "94ad362f", Size: resource.NewQuantity(2*1024*1024, resource.BinarySI)}}},
+		{"succeeded without report", job(batchv1.JobComplete, ""), "",
+			v1.RunStatus{JobName: "job1", Result: v1.RunSucceeded, CompletionTime: &now}},
+		{"auth", job(batchv1.JobFailed, "Job has reached the specified backoff limit"), `{"reason":"Auth","attempts":1,"message":"fatal: Authentication failed"}`,
+			v1.RunStatus{JobName: "job1", Result: v1.RunFailed, CompletionTime: &now, Attempts: 1, Reason: v1.FailureAuth, Message: "fatal: Authentication failed"}},
+		{"transient", job(batchv1.JobFailed, "Job has reached the specified backoff limit"), `{"reason":"Transient","attempts":3,"message":"fatal: Could not resolve host"}`,
+			v1.RunStatus{JobName: "job1", Result: v1.RunFailed, CompletionTime: &now, Attempts: 3, Reason: v1.FailureTransient, Message: "fatal: Could not resolve host"}},
+		{"deadline", job(batchv1.JobFailed, "Job was active longer than specified deadline"), "",
+			v1.RunStatus{JobName: "job1", Result: v1.RunFailed, CompletionTime: &now, Reason: v1.FailureUnknown, Message: "Job was active longer than specified deadline"}},
+		{"broken report", job(batchv1.JobFailed, "Job has reached the specified backoff limit"), "snapshot not found",
+			v1.RunStatus{JobName: "job1", Result: v1.RunFailed, CompletionTime: &now, Reason: v1.FailureUnknown, Message: "Job has reached the specified backoff limit"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runStatus(tt.job, tt.msg); !equality.Semantic.DeepEqual(got, tt.want) {
+				t.Errorf("runStatus() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_runStatus_duration(t *testing.T) {
+	start := metav1.NewTime(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	end := metav1.NewTime(start.Add(90 * time.Second))
+	job := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job1"}}
+	job.Status.StartTime = &start
+	job.Status.CompletionTime = &end
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue, LastTransitionTime: end}}
+
+	got := runStatus(job, "")
+	if got.Duration == nil || got.Duration.Duration != 90*time.Second {
+		t.Errorf("runStatus() Duration = %v, want 1m30s", got.Duration)
+	}
+}
+
+func Test_finishedSince(t *testing.T) {
+	base := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	job := func(name string, min int, condType batchv1.JobConditionType) batchv1.Job {
+		j := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if condType != "" {
+			j.Status.Conditions = []batchv1.JobCondition{{Type: condType, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(base.Add(time.Duration(min) * time.Minute))}}
+		}
+		return j
+	}
+	at := func(min int) *metav1.Time {
+		t := metav1.NewTime(base.Add(time.Duration(min) * time.Minute))
+		return &t
+	}
+	// failed2 is listed before failed1 but finished after it, and running has not finished yet.
+	jobs := []batchv1.Job{
+		job("failed2", 2, batchv1.JobFailed),
+		job("succeeded", 0, batchv1.JobComplete),
+		job("running", 0, ""),
+		job("failed1", 1, batchv1.JobFailed),
+	}
+
+	tests := []struct {
+		name         string
+		last         *v1.RunStatus
+		prevFailures int32
+		want         []string
+		wantFailures int32
+	}{
+		{"first reconcile", nil, 0, []string{"succeeded", "failed1", "failed2"}, 2},
+		{"two failures since success", &v1.RunStatus{JobName: "succeeded", CompletionTime: at(0)}, 0, []string{"failed1", "failed2"}, 2},
+		{"one failure since failure", &v1.RunStatus{JobName: "failed1", CompletionTime: at(1)}, 1, []string{"failed2"}, 2},
+		{"nothing since", &v1.RunStatus{JobName: "failed2", CompletionTime: at(2)}, 2, nil, 2},
+		{"last Job deleted", &v1.RunStatus{JobName: "deleted", CompletionTime: at(0)}, 3, []string{"failed1", "failed2"}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := finishedSince(jobs, tt.last)
+			var names []string
+			for _, j := range got {
+				names = append(names, j.Name)
+			}
+			if !equality.Semantic.DeepEqual(names, tt.want) {
+				t.Errorf("finishedSince() = %v, want %v", names, tt.want)
+			}
+			if n := consecutiveFailures(tt.prevFailures, got); n != tt.wantFailures {
+				t.Errorf("consecutiveFailures() = %d, want %d", n, tt.wantFailures)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+	"github.com/ebiiim/gitbackup/internal/notify"
+)
+
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=notifiers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+// notifyTimeout limits the time to send a notification to each Notifier.
+const notifyTimeout = 30 * time.Second
+
+// notificationEvents returns the events to notify when the last run of a Repository changes from prev to cur.
+// prevFailures and failures are the numbers of consecutive failures before and after the change,
+// which may differ by more than one if Jobs finished between reconciliations, and threshold is NotificationsSpec.ConsecutiveFailures.
+func notificationEvents(prev *v1.RunStatus, cur v1.RunStatus, prevFailures, failures int32, threshold *int32) []notify.Event {
+	prevFailed := prev != nil && prev.Result == v1.RunFailed
+	var events []notify.Event
+	switch cur.Result {
+	case v1.RunFailed:
+		if !prevFailed {
+			events = append(events, notify.Failed)
+		}
+		if threshold != nil && prevFailures < *threshold && failures >= *threshold {
+			events = append(events, notify.ConsecutiveFailures)
+		}
+	case v1.RunSucceeded:
+		if prevFailed {
+			events = append(events, notify.Recovered)
+		}
+	}
+	return events
+}
+
+// notify sends notifications to the Notifiers of repo if repo.Status.LastRun has changed from prev.LastRun.
+// Errors are recorded as events instead of being returned
+// because retrying would send duplicate notifications to the other Notifiers.
+func (r *RepositoryReconciler) notify(ctx context.Context, repo v1.Repository, prevStatus v1.RepositoryStatus) {
+	lg := log.FromContext(ctx)
+
+	spec := repo.Spec.Notifications
+	prev, cur := prevStatus.LastRun, repo.Status.LastRun
+	if spec == nil || cur == nil || (prev != nil && prev.JobName == cur.JobName) {
+		return
+	}
+	events := notificationEvents(prev, *cur, prevStatus.ConsecutiveFailures, repo.Status.ConsecutiveFailures, spec.ConsecutiveFailures)
+	if len(events) == 0 {
+		return
+	}
+	lg.Info("notify", "events", events)
+
+	for _, ref := range spec.Notifiers {
+		if err := r.sendNotifications(ctx, repo, ref.Name, events); err != nil {
+			lg.Error(err, "unable to notify", "notifier", ref.Name)
+			r.Recorder.Eventf(&repo, corev1.EventTypeWarning, "NotificationFailed", "unable to notify via Notifier %s: %v", ref.Name, err)
+			continue
+		}
+		r.Recorder.Eventf(&repo, corev1.EventTypeNormal, "Notified", "%v is notified via Notifier %s", events, ref.Name)
+	}
+}
+
+func (r *RepositoryReconciler) sendNotifications(ctx context.Context, repo v1.Repository, name string, events []notify.Event) error {
+	var notifier v1beta1.Notifier
+	if err := r.Get(ctx, client.ObjectKey{Namespace: repo.Namespace, Name: name}, &notifier); err != nil {
+		return err
+	}
+	senders, err := r.notifySenders(ctx, notifier)
+	if err != nil {
+		return err
+	}
+
+	run := repo.Status.LastRun
+	for _, ev := range events {
+		n := notify.Notification{
+			Event:               ev,
+			Namespace:           repo.Namespace,
+			Name:                repo.Name,
+			Source:              repo.Spec.Source.URL,
+			Destination:         repo.Spec.Destination.URL,
+			JobName:             run.JobName,
+			Result:              string(run.Result),
+			Reason:              string(run.Reason),
+			Message:             run.Message,
+			Attempts:            run.Attempts,
+			ConsecutiveFailures: repo.Status.ConsecutiveFailures,
+		}
+		if run.CompletionTime != nil {
+			n.CompletionTime = &run.CompletionTime.Time
+		}
+		if err := n.Render(pointer.StringDeref(notifier.Spec.Template, ""), pointer.StringDeref(notifier.Spec.Subject, "")); err != nil {
+			return err
+		}
+		for _, s := range senders {
+			ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+			err := s.Send(ctx, n)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("unable to send %s: %w", ev, err)
+			}
+		}
+	}
+	return nil
+}
+
+// notifySenders returns the Senders of the sinks of n with the URLs and the passwords read from Secrets.
+func (r *RepositoryReconciler) notifySenders(ctx context.Context, n v1beta1.Notifier) ([]notify.Sender, error) {
+	httpClient := &http.Client{Timeout: notifyTimeout}
+	var dialer *net.Dialer
+	if !r.AllowInternalNotificationSinks {
+		// Notifiers are created by users, so do not let them reach the controller, the node or the cloud metadata service
+		dialer = notify.RestrictedDialer(notifyTimeout)
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = dialer.DialContext
+		httpClient.Transport = transport
+	}
+	var senders []notify.Sender
+	if w := n.Spec.Webhook; w != nil {
+		u, err := r.webhookURL(ctx, n.Namespace, *w)
+		if err != nil {
+			return nil, err
+		}
+		senders = append(senders, &notify.Webhook{URL: u, HTTPClient: httpClient})
+	}
+	if w := n.Spec.Slack; w != nil {
+		u, err := r.webhookURL(ctx, n.Namespace, *w)
+		if err != nil {
+			return nil, err
+		}
+		senders = append(senders, &notify.Slack{URL: u, HTTPClient: httpClient})
+	}
+	if m := n.Spec.SMTP; m != nil {
+		s := &notify.SMTP{Host: m.Host, Port: m.GetPort(), From: m.From, To: m.To, Username: pointer.StringDeref(m.Username, ""), Dialer: dialer}
+		if m.Password != nil {
+			p, err := r.secretValue(ctx, n.Namespace, *m.Password)
+			if err != nil {
+				return nil, err
+			}
+			s.Password = p
+		}
+		senders = append(senders, s)
+	}
+	return senders, nil
+}
+
+func (r *RepositoryReconciler) webhookURL(ctx context.Context, namespace string, w v1beta1.WebhookSink) (string, error) {
+	if w.URLSecret != nil {
+		return r.secretValue(ctx, namespace, *w.URLSecret)
+	}
+	if w.URL == nil {
+		return "", fmt.Errorf("URL is not specified")
+	}
+	return *w.URL, nil
+}
+
+// secretValue reads the value of the key of a Secret.
+func (r *RepositoryReconciler) secretValue(ctx context.Context, namespace string, sel corev1.SecretKeySelector) (string, error) {
+	var secret corev1.Secret
+	if err := r.APIReader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: sel.Name}, &secret); err != nil {
+		return "", err
+	}
+	v, ok := secret.Data[sel.Key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in Secret %s", sel.Key, sel.Name)
+	}
+	return string(v), nil
+}
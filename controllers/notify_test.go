@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/utils/pointer"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+	"github.com/ebiiim/gitbackup/internal/notify"
+)
+
+func Test_notificationEvents(t *testing.T) {
+	succeeded := &v1.RunStatus{JobName: "job0", Result: v1.RunSucceeded}
+	failed := &v1.RunStatus{JobName: "job0", Result: v1.RunFailed}
+	tests := []struct {
+		name      string
+		prev      *v1.RunStatus
+		cur       v1.RunResult
+		prevFail  int32
+		failures  int32
+		threshold *int32
+		want      []notify.Event
+	}{
+		{"first success", nil, v1.RunSucceeded, 0, 0, nil, nil},
+		{"first failure", nil, v1.RunFailed, 0, 1, nil, []notify.Event{notify.Failed}},
+		{"success to success", succeeded, v1.RunSucceeded, 0, 0, nil, nil},
+		{"success to failure", succeeded, v1.RunFailed, 0, 1, nil, []notify.Event{notify.Failed}},
+		{"failure to failure", failed, v1.RunFailed, 1, 2, nil, nil},
+		{"failure to success", failed, v1.RunSucceeded, 1, 0, nil, []notify.Event{notify.Recovered}},
+		{"consecutive failures", failed, v1.RunFailed, 2, 3, pointer.Int32(3), []notify.Event{notify.ConsecutiveFailures}},
+		{"consecutive failures not reached", failed, v1.RunFailed, 1, 2, pointer.Int32(3), nil},
+		{"consecutive failures exceeded", failed, v1.RunFailed, 3, 4, pointer.Int32(3), nil},
+		{"consecutive failures on first failure", succeeded, v1.RunFailed, 0, 1, pointer.Int32(1), []notify.Event{notify.Failed, notify.ConsecutiveFailures}},
+		{"consecutive failures passed between reconciliations", failed, v1.RunFailed, 2, 4, pointer.Int32(3), []notify.Event{notify.ConsecutiveFailures}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := v1.RunStatus{JobName: "job1", Result: tt.cur}
+			if got := notificationEvents(tt.prev, cur, tt.prevFail, tt.failures, tt.threshold); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("notificationEvents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+)
+
+const (
+	// homeDir is the writable HOME and working directory of the git container.
+	homeDir = "/home/" + v1.OperatorName
+
+	// defaultUserID is the user and group to run the pods as if PodSecurityContext is not specified.
+	defaultUserID = 65532
+)
+
+// defaultPodSecurityContext returns the pod security context that passes the "restricted" Pod Security Standard.
+// fsGroup makes the files in Secret and ConfigMap volumes readable by the user.
+func defaultPodSecurityContext() *corev1.PodSecurityContext {
+	return &corev1.PodSecurityContext{
+		RunAsNonRoot: pointer.Bool(true),
+		RunAsUser:    pointer.Int64(defaultUserID),
+		RunAsGroup:   pointer.Int64(defaultUserID),
+		FSGroup:      pointer.Int64(defaultUserID),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// defaultSecurityContext returns the container security context that passes the "restricted" Pod Security Standard.
+func defaultSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: pointer.Bool(false),
+		ReadOnlyRootFilesystem:   pointer.Bool(true),
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+	}
+}
+
+// homeVolumes returns emptyDir volumes for HOME and /tmp as the root filesystem is read-only.
+func homeVolumes() ([]*corev1apply.VolumeApplyConfiguration, []*corev1apply.VolumeMountApplyConfiguration) {
+	volumes := []*corev1apply.VolumeApplyConfiguration{
+		corev1apply.Volume().WithName("home").WithEmptyDir(corev1apply.EmptyDirVolumeSource()),
+		corev1apply.Volume().WithName("tmp").WithEmptyDir(corev1apply.EmptyDirVolumeSource()),
+	}
+	volumeMounts := []*corev1apply.VolumeMountApplyConfiguration{
+		corev1apply.VolumeMount().WithName("home").WithMountPath(homeDir),
+		corev1apply.VolumeMount().WithName("tmp").WithMountPath("/tmp"),
+	}
+	return volumes, volumeMounts
+}
+
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=backuppolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// urlsRestricted tests if BackupPolicies restrict the URLs in namespace,
+// in which case git containers must not rewrite the URLs that the webhooks allowed.
+func urlsRestricted(ctx context.Context, c client.Reader, namespace string) (bool, error) {
+	var policies v1beta1.BackupPolicyList
+	if err := c.List(ctx, &policies); err != nil {
+		return false, err
+	}
+	if len(policies.Items) == 0 {
+		return false, nil
+	}
+	var ns corev1.Namespace
+	if err := c.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		return false, err
+	}
+	return v1beta1.RestrictsURLs(policies.Items, ns.Labels)
+}
+
+// gitContainer returns the git container that runs script in homeDir.
+// If noURLRewrites is true, the script fails if the git config rewrites URLs (see noURLRewritesCommands).
+func gitContainer(image, script string, volumeMounts []*corev1apply.VolumeMountApplyConfiguration, noURLRewrites bool) *corev1apply.ContainerApplyConfiguration {
+	c := corev1apply.Container().
+		WithName("git").
+		WithImage(image).
+		WithCommand(
+			"/bin/sh",
+			"-c",
+			script,
+		).
+		WithEnv(corev1apply.EnvVar().WithName("HOME").WithValue(homeDir)).
+		WithWorkingDir(homeDir).
+		WithVolumeMounts(volumeMounts...)
+	if noURLRewrites {
+		c.WithEnv(corev1apply.EnvVar().WithName(noURLRewritesEnv).WithValue("true"))
+	}
+	return c
+}
+
+// applyPodOptions sets opts to podSpec and its containers.
+// The default security contexts are used if opts does not specify them.
+func applyPodOptions(podSpec *corev1apply.PodSpecApplyConfiguration, opts v1.PodOptions) error {
+	podSecurityContext := opts.PodSecurityContext
+	if podSecurityContext == nil {
+		podSecurityContext = defaultPodSecurityContext()
+	}
+	securityContext := opts.SecurityContext
+	if securityContext == nil {
+		securityContext = defaultSecurityContext()
+	}
+
+	var psc corev1apply.PodSecurityContextApplyConfiguration
+	if err := toApplyConfiguration(podSecurityContext, &psc); err != nil {
+		return err
+	}
+	podSpec.WithSecurityContext(&psc)
+
+	for _, cs := range [][]corev1apply.ContainerApplyConfiguration{podSpec.InitContainers, podSpec.Containers} {
+		for i := range cs {
+			var sc corev1apply.SecurityContextApplyConfiguration
+			if err := toApplyConfiguration(securityContext, &sc); err != nil {
+				return err
+			}
+			cs[i].WithSecurityContext(&sc)
+			if opts.Resources != nil {
+				var res corev1apply.ResourceRequirementsApplyConfiguration
+				if err := toApplyConfiguration(opts.Resources, &res); err != nil {
+					return err
+				}
+				cs[i].WithResources(&res)
+			}
+		}
+	}
+
+	if len(opts.NodeSelector) != 0 {
+		podSpec.WithNodeSelector(opts.NodeSelector)
+	}
+	for _, t := range opts.Tolerations {
+		var tol corev1apply.TolerationApplyConfiguration
+		if err := toApplyConfiguration(t, &tol); err != nil {
+			return err
+		}
+		podSpec.WithTolerations(&tol)
+	}
+	if opts.Affinity != nil {
+		var aff corev1apply.AffinityApplyConfiguration
+		if err := toApplyConfiguration(opts.Affinity, &aff); err != nil {
+			return err
+		}
+		podSpec.WithAffinity(&aff)
+	}
+	if opts.ServiceAccountName != nil {
+		podSpec.WithServiceAccountName(*opts.ServiceAccountName)
+	}
+	if opts.PriorityClassName != nil {
+		podSpec.WithPriorityClassName(*opts.PriorityClassName)
+	}
+	return nil
+}
+
+// toApplyConfiguration converts the typed object in to the apply configuration out.
+// Apply configurations have the same JSON representation as the typed objects.
+func toApplyConfiguration(in, out any) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/utils/pointer"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+func Test_applyPodOptions(t *testing.T) {
+	newPodSpec := func() *corev1apply.PodSpecApplyConfiguration {
+		return corev1apply.PodSpec().
+			WithInitContainers(corev1apply.Container().WithName("metadata")).
+			WithContainers(gitContainer("git", "true", nil, false))
+	}
+
+	t.Run("default", func(t *testing.T) {
+		podSpec := newPodSpec()
+		if err := applyPodOptions(podSpec, v1.PodOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		psc := podSpec.SecurityContext
+		if psc == nil || psc.RunAsNonRoot == nil || !*psc.RunAsNonRoot || psc.RunAsUser == nil || *psc.RunAsUser != defaultUserID {
+			t.Errorf("unexpected pod security context %+v", psc)
+		}
+		if psc.SeccompProfile == nil || *psc.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+			t.Errorf("unexpected seccomp profile %+v", psc.SeccompProfile)
+		}
+		for _, c := range append(podSpec.InitContainers, podSpec.Containers...) {
+			sc := c.SecurityContext
+			if sc == nil || !*sc.ReadOnlyRootFilesystem || *sc.AllowPrivilegeEscalation || len(sc.Capabilities.Drop) != 1 || sc.Capabilities.Drop[0] != "ALL" {
+				t.Errorf("unexpected security context of %s %+v", *c.Name, sc)
+			}
+			if c.Resources != nil {
+				t.Errorf("unexpected resources of %s %+v", *c.Name, c.Resources)
+			}
+		}
+		if podSpec.ServiceAccountName != nil || podSpec.PriorityClassName != nil || podSpec.NodeSelector != nil || podSpec.Affinity != nil || podSpec.Tolerations != nil {
+			t.Errorf("unexpected scheduling options %+v", podSpec)
+		}
+	})
+
+	t.Run("specified", func(t *testing.T) {
+		podSpec := newPodSpec()
+		opts := v1.PodOptions{
+			Resources: &corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+			},
+			NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+			Tolerations: []corev1.Toleration{
+				{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "backup", Effect: corev1.TaintEffectNoSchedule},
+			},
+			Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}},
+				}}},
+			}},
+			ServiceAccountName: pointer.String("backup"),
+			PriorityClassName:  pointer.String("low"),
+			PodSecurityContext: &corev1.PodSecurityContext{RunAsUser: pointer.Int64(1000)},
+			SecurityContext:    &corev1.SecurityContext{Privileged: pointer.Bool(false)},
+		}
+		if err := applyPodOptions(podSpec, opts); err != nil {
+			t.Fatal(err)
+		}
+		if psc := podSpec.SecurityContext; psc == nil || *psc.RunAsUser != 1000 || psc.RunAsNonRoot != nil {
+			t.Errorf("unexpected pod security context %+v", psc)
+		}
+		for _, c := range append(podSpec.InitContainers, podSpec.Containers...) {
+			if sc := c.SecurityContext; sc == nil || *sc.Privileged || sc.ReadOnlyRootFilesystem != nil {
+				t.Errorf("unexpected security context of %s %+v", *c.Name, sc)
+			}
+			if c.Resources == nil || c.Resources.Limits.Memory().String() != "256Mi" {
+				t.Errorf("unexpected resources of %s %+v", *c.Name, c.Resources)
+			}
+		}
+		if podSpec.NodeSelector["kubernetes.io/os"] != "linux" {
+			t.Errorf("unexpected node selector %v", podSpec.NodeSelector)
+		}
+		if len(podSpec.Tolerations) != 1 || *podSpec.Tolerations[0].Value != "backup" {
+			t.Errorf("unexpected tolerations %+v", podSpec.Tolerations)
+		}
+		if a := podSpec.Affinity; a == nil || a.NodeAffinity == nil || a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values[0] != "a" {
+			t.Errorf("unexpected affinity %+v", a)
+		}
+		if *podSpec.ServiceAccountName != "backup" || *podSpec.PriorityClassName != "low" {
+			t.Errorf("unexpected serviceAccountName %v or priorityClassName %v", *podSpec.ServiceAccountName, *podSpec.PriorityClassName)
+		}
+	})
+}
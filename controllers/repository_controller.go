@@ -2,52 +2,85 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	batchv1apply "k8s.io/client-go/applyconfigurations/batch/v1"
 	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
 	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
+	v1 "github.com/ebiiim/gitbackup/api/v1"
 	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+	"github.com/ebiiim/gitbackup/internal/cloudevents"
 )
 
 const (
-	ControllerName = v1beta1.OperatorName + "-repository-controller"
+	ControllerName = v1.OperatorName + "-repository-controller"
 )
 
 // RepositoryReconciler reconciles a Repository object
 type RepositoryReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// APIReader reads referenced Secrets and ConfigMaps without caching their data,
+	// and the Pods of finished Jobs without caching all Pods in the cluster.
+	APIReader client.Reader
+	Recorder  record.EventRecorder
+	// CloudEvents publishes CloudEvents of backups and Repositories. CloudEvents are disabled if nil.
+	CloudEvents *cloudevents.Publisher
+	// AllowInternalNotificationSinks allows Notifiers to send notifications to loopback and link-local addresses.
+	AllowInternalNotificationSinks bool
 }
 
+const (
+	// secretRefsField and configMapRefsField index Repositories by the names of the Secrets and ConfigMaps they refer to.
+	secretRefsField    = ".spec.secretRefs"
+	configMapRefsField = ".spec.configMapRefs"
+)
+
 //+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=repositories,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=repositories/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=repositories/finalizers,verbs=update
 //+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile moves the current state of the cluster closer to the desired state.
 func (r *RepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	lg := log.FromContext(ctx)
 	lg.Info("Reconcile")
 
-	var repo v1beta1.Repository
+	var repo v1.Repository
 	err := r.Get(ctx, req.NamespacedName, &repo)
 	if errors.IsNotFound(err) {
 		lg.Info("Repository is already deleted")
+		staleGauge.DeleteLabelValues(req.Namespace, req.Name)
 		return ctrl.Result{}, nil
 	}
 	if err != nil {
@@ -55,30 +88,227 @@ func (r *RepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 	if !repo.DeletionTimestamp.IsZero() {
-		lg.Info("Repository is being deleted")
+		if err := r.reconcileDeletion(ctx, repo); err != nil {
+			return ctrl.Result{}, err
+		}
 		return ctrl.Result{}, nil
 	}
 
+	if err := r.reconcileFinalizer(ctx, &repo); err != nil {
+		return ctrl.Result{}, err
+	}
 	if err := r.reconcileGitConfig(ctx, repo); err != nil {
 		return ctrl.Result{}, err
 	}
 	if err := r.reconcileGitCredentials(ctx, repo); err != nil {
 		return ctrl.Result{}, err
 	}
-	if err := r.reconcileCronJob(ctx, repo); err != nil {
+	hash, missing, err := r.hashReferences(ctx, repo)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileCronJob(ctx, repo, hash); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileDryRunJob(ctx, &repo, hash); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.publishStartedEvents(ctx, repo); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	status := repo.Status.DeepCopy()
+	r.reconcileReferences(ctx, &repo, missing)
+	if err := r.reconcileLastRun(ctx, &repo); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileState(ctx, repo); err != nil {
+		return ctrl.Result{}, err
+	}
+	requeueAfter := r.reconcileStale(ctx, &repo, time.Now())
+	if err := r.updateStatus(ctx, repo, *status); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.notify(ctx, repo, *status)
+	r.publishStatusEvents(ctx, repo, *status)
+	r.recordStale(repo, *status)
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
-func (r *RepositoryReconciler) reconcileGitConfig(ctx context.Context, repo v1beta1.Repository) error {
+// updateStatus updates the status of repo if it differs from old.
+func (r *RepositoryReconciler) updateStatus(ctx context.Context, repo v1.Repository, old v1.RepositoryStatus) error {
+	lg := log.FromContext(ctx)
+
+	if equality.Semantic.DeepEqual(repo.Status, old) {
+		return nil
+	}
+	if err := r.Status().Update(ctx, &repo); err != nil {
+		lg.Error(err, "unable to update status")
+		return err
+	}
+	lg.Info("status updated")
+	return nil
+}
+
+// reconcileLastRun sets the result of the latest finished backup Job to repo.Status.LastRun,
+// the time the latest succeeded backup Job finished to repo.Status.LastSuccessTime,
+// the number of backup Jobs that have failed in a row to repo.Status.ConsecutiveFailures
+// and the result of the latest finished dry-run Job to repo.Status.LastDryRun.
+func (r *RepositoryReconciler) reconcileLastRun(ctx context.Context, repo *v1.Repository) error {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileLastRun")
+
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs, client.InNamespace(repo.Namespace), client.MatchingLabels(jobLabels(*repo))); err != nil {
+		lg.Error(err, "unable to list Jobs")
+		return err
+	}
+	var runs, dryRuns []batchv1.Job
+	for _, job := range jobs.Items {
+		if job.Labels[v1.DryRunLabel] == "true" {
+			dryRuns = append(dryRuns, job)
+		} else {
+			runs = append(runs, job)
+		}
+	}
+
+	// more than one Job may have finished since the last reconciliation e.g. while the controller was down
+	if finished := finishedSince(runs, repo.Status.LastRun); len(finished) != 0 {
+		last := &finished[len(finished)-1]
+		status := runStatus(*last, terminationMessage(ctx, r.APIReader, last))
+		repo.Status.LastRun = &status
+		repo.Status.ConsecutiveFailures = consecutiveFailures(repo.Status.ConsecutiveFailures, finished)
+		lg.Info("last run", "job", status.JobName, "result", status.Result, "reason", status.Reason, "attempts", status.Attempts, "finished", len(finished))
+	}
+	for _, job := range runs {
+		if t, succeeded := finishedAt(job); succeeded && (repo.Status.LastSuccessTime == nil || repo.Status.LastSuccessTime.Before(t)) {
+			repo.Status.LastSuccessTime = t
+		}
+	}
+	if last := latestFinished(dryRuns); last != nil && (repo.Status.LastDryRun == nil || repo.Status.LastDryRun.JobName != last.Name) {
+		status := runStatus(*last, terminationMessage(ctx, r.APIReader, last))
+		repo.Status.LastDryRun = &status
+		lg.Info("last dry run", "job", status.JobName, "result", status.Result, "reason", status.Reason, "attempts", status.Attempts)
+		r.recordDryRun(repo, status)
+	}
+	return nil
+}
+
+// latestFinished returns the Job that finished last or nil if no Jobs have finished.
+func latestFinished(jobs []batchv1.Job) *batchv1.Job {
+	var last *batchv1.Job
+	var lastTime *metav1.Time
+	for i, job := range jobs {
+		t, _ := finishedAt(job)
+		if t != nil && (lastTime == nil || lastTime.Before(t)) {
+			last, lastTime = &jobs[i], t
+		}
+	}
+	return last
+}
+
+// jobLabels returns the labels of the CronJob and the Jobs of repo.
+func jobLabels(repo v1.Repository) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":       v1.OperatorName,
+		"app.kubernetes.io/instance":   repo.Name,
+		"app.kubernetes.io/created-by": ControllerName,
+	}
+}
+
+// backupJobLabels returns the labels of the backup Jobs of repo with DryRunLabel if dryRun.
+func backupJobLabels(repo v1.Repository, dryRun bool) map[string]string {
+	labels := jobLabels(repo)
+	if dryRun {
+		labels[v1.DryRunLabel] = "true"
+	}
+	return labels
+}
+
+// hashReferences reads the Secrets and ConfigMaps that repo refers to
+// and returns a hash of their contents and the references that do not exist.
+func (r *RepositoryReconciler) hashReferences(ctx context.Context, repo v1.Repository) (string, []v1.LocalReference, error) {
+	lg := log.FromContext(ctx)
+	lg.Info("hashReferences")
+
+	var missing []v1.LocalReference
+	h := sha256.New()
+	for _, ref := range repo.GetReferences() {
+		key := client.ObjectKey{Namespace: repo.Namespace, Name: ref.Name}
+		var data map[string][]byte
+		var err error
+		switch ref.Kind {
+		case "Secret":
+			var secret corev1.Secret
+			err = r.APIReader.Get(ctx, key, &secret)
+			data = secret.Data
+		case "ConfigMap":
+			var cm corev1.ConfigMap
+			err = r.APIReader.Get(ctx, key, &cm)
+			data = make(map[string][]byte, len(cm.Data)+len(cm.BinaryData))
+			for k, v := range cm.Data {
+				data[k] = []byte(v)
+			}
+			for k, v := range cm.BinaryData {
+				data[k] = v
+			}
+		}
+		if errors.IsNotFound(err) {
+			missing = append(missing, ref)
+			fmt.Fprintf(h, "%s/%s missing\n", ref.Kind, ref.Name)
+			continue
+		}
+		if err != nil {
+			lg.Error(err, "unable to get referenced object", "ref", ref.String())
+			return "", nil, err
+		}
+		fmt.Fprintf(h, "%s/%s %d\n", ref.Kind, ref.Name, len(data))
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(h, "%s %d\n", k, len(data[k]))
+			h.Write(data[k])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), missing, nil
+}
+
+// reconcileReferences sets the ReferencesResolved condition to repo.Status.
+func (r *RepositoryReconciler) reconcileReferences(ctx context.Context, repo *v1.Repository, missing []v1.LocalReference) {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileReferences")
+
+	cond := metav1.Condition{
+		Type:               v1.ConditionReferencesResolved,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Resolved",
+		Message:            "all referenced Secrets and ConfigMaps exist",
+		ObservedGeneration: repo.Generation,
+	}
+	if len(missing) != 0 {
+		ss := make([]string, len(missing))
+		for i, ref := range missing {
+			ss[i] = fmt.Sprintf("%s %s %q", ref.Field, ref.Kind, ref.Name)
+		}
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "NotFound"
+		cond.Message = "not found: " + strings.Join(ss, ", ")
+	}
+
+	meta.SetStatusCondition(&repo.Status.Conditions, cond)
+}
+
+func (r *RepositoryReconciler) reconcileGitConfig(ctx context.Context, repo v1.Repository) error {
 	lg := log.FromContext(ctx)
 	lg.Info("reconcileGitConfig")
 
 	cmName := repo.GetOwnedConfigMapName()
 
-	if repo.Spec.GitConfig.Name != cmName {
+	if repo.GetGitConfigName() != cmName {
 		lg.Info("GitConfig specified")
 		return nil
 	}
@@ -106,110 +336,110 @@ func (r *RepositoryReconciler) reconcileGitConfig(ctx context.Context, repo v1be
 	return nil
 }
 
-func (r *RepositoryReconciler) reconcileGitCredentials(ctx context.Context, repo v1beta1.Repository) error {
+// reconcileState records the refs digest of the last successful backup to the state ConfigMap
+// that the next backup Job uses to verify the refs recorded in the destination before detecting drift.
+// The ConfigMap is deleted if OnDestinationDrift is Overwrite so that an old digest is not used when it is changed.
+func (r *RepositoryReconciler) reconcileState(ctx context.Context, repo v1.Repository) error {
 	lg := log.FromContext(ctx)
-	lg.Info("reconcileGitCredentials")
+	lg.Info("reconcileState")
 
-	if repo.Spec.GitCredentials != nil {
-		lg.Info("GitCredentials specified")
+	cm := &corev1.ConfigMap{}
+	cm.SetNamespace(repo.Namespace)
+	cm.SetName(repo.GetOwnedStateConfigMapName())
+
+	if repo.GetOnDestinationDrift() == v1.DriftOverwrite {
+		err := r.Get(ctx, client.ObjectKeyFromObject(cm), cm)
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			lg.Error(err, "unable to get state cm")
+			return err
+		}
+		if err := r.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
+			lg.Error(err, "unable to delete state cm")
+			return err
+		}
+		lg.Info("state cm deleted")
 		return nil
 	}
 
-	lg.Info("GitCredentials is nil")
+	run := repo.Status.LastRun
+	if run == nil || run.Result != v1.RunSucceeded || run.RefsDigest == "" {
+		return nil
+	}
+	op, err := ctrl.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Data = map[string]string{
+			refsDigestFile: run.RefsDigest,
+		}
+		return ctrl.SetControllerReference(&repo, cm, r.Scheme)
+	})
+	if err != nil {
+		lg.Error(err, "unable to create or update state cm")
+		return err
+	}
+	lg.Info("state cm", "op", op)
 	return nil
 }
 
-func (r *RepositoryReconciler) reconcileCronJob(ctx context.Context, repo v1beta1.Repository) error {
+func (r *RepositoryReconciler) reconcileGitCredentials(ctx context.Context, repo v1.Repository) error {
 	lg := log.FromContext(ctx)
-	lg.Info("reconcileCronJob")
+	lg.Info("reconcileGitCredentials")
 
-	// generate shell commands
-	srcs := strings.Split(repo.Spec.Src, "/")
-	srcRepoName := srcs[len(srcs)-1]
-	echo := func(format string, a ...any) string {
-		logPrefix := "echo $(date -Iseconds) gitbackup: "
-		return fmt.Sprintf(logPrefix+format, a...)
-	}
-	script := strings.Join([]string{
-		echo("start"),
-		echo("set .gitconfig"),
-		"cp /gitconfig/.gitconfig /root/.gitconfig",
-		echo("set .git-credentials"),
-		"cp /gitcredentials/.git-credentials /root/.git-credentials",
-		"set -e",
-		echo("clone src repo '%s'", repo.Spec.Src),
-		fmt.Sprintf("git clone --mirror '%s'", repo.Spec.Src),
-		fmt.Sprintf("cd '%s.git'", srcRepoName),
-		echo("push to dst repo '%s'", repo.Spec.Dst),
-		fmt.Sprintf("git push --mirror '%s'", repo.Spec.Dst),
-		"set +e",
-		echo("completed"),
-	}, ";")
+	if creds := repo.GetCredentials(); len(creds) != 0 {
+		lg.Info("GitCredentials specified", "count", len(creds))
+		return nil
+	}
 
-	// create server-side apply config
+	lg.Info("GitCredentials is nil")
+	return nil
+}
 
-	var volumes []*corev1apply.VolumeApplyConfiguration
-	var volumeMounts []*corev1apply.VolumeMountApplyConfiguration
+// reconcileCronJob applies the CronJob of repo.
+// referencesHash is set to the pod template so that changes of the referenced objects are visible.
+func (r *RepositoryReconciler) reconcileCronJob(ctx context.Context, repo v1.Repository, referencesHash string) error {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileCronJob")
 
-	volumes = append(volumes, corev1apply.Volume().
-		WithName("gitconfig").
-		WithConfigMap(corev1apply.ConfigMapVolumeSource().
-			WithName(repo.Spec.GitConfig.Name).
-			WithDefaultMode(256)),
-	)
-	volumeMounts = append(volumeMounts, corev1apply.VolumeMount().
-		WithName("gitconfig").
-		WithMountPath("/gitconfig"),
-	)
-	if repo.Spec.GitCredentials != nil {
-		volumes = append(volumes, corev1apply.Volume().
-			WithName("gitcredentials").
-			WithSecret(corev1apply.SecretVolumeSource().
-				WithSecretName(repo.Spec.GitCredentials.Name).
-				WithDefaultMode(256)))
-		volumeMounts = append(volumeMounts, corev1apply.VolumeMount().
-			WithName("gitcredentials").
-			WithMountPath("/gitcredentials"))
+	jobSpec, err := r.backupJobSpec(ctx, repo, referencesHash, repo.IsDryRun())
+	if err != nil {
+		return err
 	}
 
-	var containers []*corev1apply.ContainerApplyConfiguration
-
-	containers = append(containers, corev1apply.Container().
-		WithName("git").
-		WithImage(*repo.Spec.GitImage).
-		WithCommand(
-			"/bin/sh",
-			"-c",
-			script,
-		).
-		WithVolumeMounts(volumeMounts...),
-	)
-
-	podTemplateSpec := corev1apply.PodTemplateSpec().WithSpec(corev1apply.PodSpec().
-		WithRestartPolicy(corev1.RestartPolicyNever).
-		WithContainers(containers...).
-		WithVolumes(volumes...))
-	if repo.Spec.ImagePullSecret != nil {
-		podTemplateSpec.Spec.WithImagePullSecrets(corev1apply.LocalObjectReference().
-			WithName(repo.Spec.ImagePullSecret.Name))
+	policy := v1.JobPolicy{}
+	if repo.Spec.JobPolicy != nil {
+		policy = *repo.Spec.JobPolicy
+	}
+	// Without this setting, CronJobs will stop working after 100 failures (including "suspend: true").
+	startingDeadlineSeconds := int64(4 * 3600)
+	if policy.StartingDeadlineSeconds != nil {
+		startingDeadlineSeconds = *policy.StartingDeadlineSeconds
+	}
+	// No need to backup concurrently and git commands can be cancelled.
+	concurrencyPolicy := batchv1.ReplaceConcurrent
+	if policy.ConcurrencyPolicy != nil {
+		concurrencyPolicy = *policy.ConcurrencyPolicy
 	}
 
 	cronJobSpec := batchv1apply.CronJobSpec().
 		WithSchedule(repo.Spec.Schedule).
-		// Without this setting, CronJobs will stop working after 100 failures (including "suspend: true").
-		WithStartingDeadlineSeconds(4 * 3600).
-		// No need to backup concurrently and git commands can be cancelled.
-		WithConcurrencyPolicy(batchv1.ReplaceConcurrent).
-		WithJobTemplate(batchv1apply.JobTemplateSpec().WithSpec(batchv1apply.JobSpec().
-			WithParallelism(1).
-			WithCompletions(1).
-			// Delete history after 100 hours.
-			// Since this is a backup task, basically it should be fine as long as the latest run was successful.
-			WithTTLSecondsAfterFinished(3600 * 100).
-			WithTemplate(podTemplateSpec)))
+		WithStartingDeadlineSeconds(startingDeadlineSeconds).
+		WithConcurrencyPolicy(concurrencyPolicy).
+		WithJobTemplate(batchv1apply.JobTemplateSpec().
+			WithLabels(backupJobLabels(repo, repo.IsDryRun())).
+			WithSpec(jobSpec))
 	if repo.Spec.TimeZone != nil {
 		cronJobSpec.WithTimeZone(*repo.Spec.TimeZone)
 	}
+	if repo.Spec.Suspend != nil {
+		cronJobSpec.WithSuspend(*repo.Spec.Suspend)
+	}
+	if policy.SuccessfulJobsHistoryLimit != nil {
+		cronJobSpec.WithSuccessfulJobsHistoryLimit(*policy.SuccessfulJobsHistoryLimit)
+	}
+	if policy.FailedJobsHistoryLimit != nil {
+		cronJobSpec.WithFailedJobsHistoryLimit(*policy.FailedJobsHistoryLimit)
+	}
 
 	gvk, err := apiutil.GVKForObject(&repo, r.Scheme)
 	if err != nil {
@@ -225,11 +455,7 @@ func (r *RepositoryReconciler) reconcileCronJob(ctx context.Context, repo v1beta
 		WithController(true)
 
 	cronJob := batchv1apply.CronJob(repo.GetOwnedCronJobName(), repo.Namespace).
-		WithLabels(map[string]string{
-			"app.kubernetes.io/name":       v1beta1.OperatorName,
-			"app.kubernetes.io/instance":   repo.Name,
-			"app.kubernetes.io/created-by": ControllerName,
-		}).
+		WithLabels(jobLabels(repo)).
 		WithOwnerReferences(ownerReference).
 		WithSpec(cronJobSpec)
 
@@ -269,10 +495,256 @@ func (r *RepositoryReconciler) reconcileCronJob(ctx context.Context, repo v1beta
 	return nil
 }
 
+// backupJobSpec returns the spec of the backup Jobs of repo, or the dry-run Jobs if dryRun.
+// referencesHash is set to the pod template so that changes of the referenced objects are visible.
+func (r *RepositoryReconciler) backupJobSpec(ctx context.Context, repo v1.Repository, referencesHash string, dryRun bool) (*batchv1apply.JobSpecApplyConfiguration, error) {
+	lg := log.FromContext(ctx)
+
+	script := backupScript(repo)
+	if dryRun {
+		script = dryRunScript(repo)
+	}
+
+	// create server-side apply config
+
+	volumes, volumeMounts := gitVolumes(repo.GetGitConfigName(), repo.GetCredentials(), repo.Spec.Encryption)
+	homeVols, homeMounts := homeVolumes()
+	volumes = append(volumes, homeVols...)
+	volumeMounts = append(volumeMounts, homeMounts...)
+	if repo.GetOnDestinationDrift() != v1.DriftOverwrite && !dryRun {
+		// the ConfigMap does not exist until the first backup succeeds
+		volumes = append(volumes, corev1apply.Volume().
+			WithName("state").
+			WithConfigMap(corev1apply.ConfigMapVolumeSource().
+				WithName(repo.GetOwnedStateConfigMapName()).
+				WithOptional(true)))
+		volumeMounts = append(volumeMounts, corev1apply.VolumeMount().
+			WithName("state").
+			WithMountPath(stateDir))
+	}
+
+	var initContainers []*corev1apply.ContainerApplyConfiguration
+	// dry-run Jobs do not push the metadata
+	if md := repo.Spec.Metadata; md != nil && !dryRun {
+		project, err := repo.GetMetadataProject()
+		if err != nil {
+			lg.Error(err, "unable to get metadata project")
+			return nil, err
+		}
+		apiURL, err := repo.GetMetadataAPIURL()
+		if err != nil {
+			lg.Error(err, "unable to get metadata API URL")
+			return nil, err
+		}
+		image, err := repo.GetMetadataImage()
+		if err != nil {
+			lg.Error(err, "unable to get metadata image")
+			return nil, err
+		}
+		volumes = append(volumes, corev1apply.Volume().
+			WithName("metadata").
+			WithEmptyDir(corev1apply.EmptyDirVolumeSource()))
+		volumeMounts = append(volumeMounts, corev1apply.VolumeMount().
+			WithName("metadata").
+			WithMountPath(metadataDir))
+		exporter := corev1apply.Container().
+			WithName("metadata").
+			WithImage(image).
+			WithCommand(
+				"/metadata-exporter",
+				"--forge="+string(md.Forge),
+				"--api-url="+apiURL,
+				"--project="+project,
+				"--output="+metadataDir,
+			).
+			WithVolumeMounts(corev1apply.VolumeMount().
+				WithName("metadata").
+				WithMountPath(metadataDir))
+		if md.Token != nil {
+			exporter.WithEnv(corev1apply.EnvVar().
+				WithName("GITBACKUP_FORGE_TOKEN").
+				WithValueFrom(corev1apply.EnvVarSource().
+					WithSecretKeyRef(corev1apply.SecretKeySelector().
+						WithName(md.Token.Name).
+						WithKey(md.Token.Key))))
+		}
+		initContainers = append(initContainers, exporter)
+	}
+
+	var containers []*corev1apply.ContainerApplyConfiguration
+
+	restricted, err := urlsRestricted(ctx, r.Client, repo.Namespace)
+	if err != nil {
+		lg.Error(err, "unable to check BackupPolicies")
+		return nil, err
+	}
+	containers = append(containers, gitContainer(repo.GetGitImage(), script, volumeMounts, restricted))
+
+	podTemplateSpec := corev1apply.PodTemplateSpec().
+		WithAnnotations(map[string]string{v1.ReferencesHashAnnotation: referencesHash}).
+		WithSpec(corev1apply.PodSpec().
+			WithRestartPolicy(corev1.RestartPolicyNever).
+			WithInitContainers(initContainers...).
+			WithContainers(containers...).
+			WithVolumes(volumes...))
+	if err := applyPodOptions(podTemplateSpec.Spec, repo.Spec.PodOptions); err != nil {
+		lg.Error(err, "unable to apply pod options")
+		return nil, err
+	}
+	if repo.Spec.ImagePullSecret != nil {
+		podTemplateSpec.Spec.WithImagePullSecrets(corev1apply.LocalObjectReference().
+			WithName(repo.Spec.ImagePullSecret.Name))
+	}
+
+	policy := v1.JobPolicy{}
+	if repo.Spec.JobPolicy != nil {
+		policy = *repo.Spec.JobPolicy
+	}
+	// Delete history after 100 hours.
+	// Since this is a backup task, basically it should be fine as long as the latest run was successful.
+	ttlSecondsAfterFinished := int32(3600 * 100)
+	if policy.TTLSecondsAfterFinished != nil {
+		ttlSecondsAfterFinished = *policy.TTLSecondsAfterFinished
+	}
+
+	jobSpec := batchv1apply.JobSpec().
+		WithParallelism(1).
+		WithCompletions(1).
+		WithTTLSecondsAfterFinished(ttlSecondsAfterFinished).
+		WithTemplate(podTemplateSpec)
+	if policy.BackoffLimit != nil {
+		jobSpec.WithBackoffLimit(*policy.BackoffLimit)
+	}
+	if policy.ActiveDeadlineSeconds != nil {
+		jobSpec.WithActiveDeadlineSeconds(*policy.ActiveDeadlineSeconds)
+	}
+
+	return jobSpec, nil
+}
+
+// gitVolumes returns volumes and volume mounts for the git container.
+// Each of credentials is mounted in its own directory under /gitcredentials. enc is optional.
+func gitVolumes(gitConfig string, credentials []corev1.LocalObjectReference, enc *v1.EncryptionSpec) ([]*corev1apply.VolumeApplyConfiguration, []*corev1apply.VolumeMountApplyConfiguration) {
+	var volumes []*corev1apply.VolumeApplyConfiguration
+	var volumeMounts []*corev1apply.VolumeMountApplyConfiguration
+
+	volumes = append(volumes, corev1apply.Volume().
+		WithName("gitconfig").
+		WithConfigMap(corev1apply.ConfigMapVolumeSource().
+			WithName(gitConfig).
+			WithDefaultMode(256)),
+	)
+	volumeMounts = append(volumeMounts, corev1apply.VolumeMount().
+		WithName("gitconfig").
+		WithMountPath("/gitconfig"),
+	)
+	for i, cred := range credentials {
+		name := fmt.Sprintf("gitcredentials-%d", i)
+		volumes = append(volumes, corev1apply.Volume().
+			WithName(name).
+			WithSecret(corev1apply.SecretVolumeSource().
+				WithSecretName(cred.Name).
+				WithDefaultMode(256)))
+		volumeMounts = append(volumeMounts, corev1apply.VolumeMount().
+			WithName(name).
+			WithMountPath(fmt.Sprintf("/gitcredentials/%d", i)))
+	}
+	if enc != nil {
+		volumes = append(volumes, corev1apply.Volume().
+			WithName("encryption").
+			WithProjected(corev1apply.ProjectedVolumeSource().
+				WithDefaultMode(256).
+				WithSources(
+					corev1apply.VolumeProjection().WithSecret(corev1apply.SecretProjection().
+						WithName(enc.PublicKey.Name).
+						WithItems(corev1apply.KeyToPath().WithKey(enc.PublicKey.Key).WithPath(publicKeyFile))),
+					corev1apply.VolumeProjection().WithSecret(corev1apply.SecretProjection().
+						WithName(enc.PrivateKey.Name).
+						WithItems(corev1apply.KeyToPath().WithKey(enc.PrivateKey.Key).WithPath(privateKeyFile))),
+				)))
+		volumeMounts = append(volumeMounts, corev1apply.VolumeMount().
+			WithName("encryption").
+			WithMountPath(encryptionDir))
+	}
+	return volumes, volumeMounts
+}
+
+// referenceNames returns an indexer that extracts the names of the objects of kind that a Repository refers to.
+func referenceNames(kind string) client.IndexerFunc {
+	return func(o client.Object) []string {
+		repo, ok := o.(*v1.Repository)
+		if !ok {
+			return nil
+		}
+		var names []string
+		for _, ref := range repo.GetReferences() {
+			if ref.Kind == kind {
+				names = append(names, ref.Name)
+			}
+		}
+		return names
+	}
+}
+
+// listRepositoryRequests returns the requests to reconcile the Repositories listed with opts.
+func listRepositoryRequests(ctx context.Context, c client.Reader, opts ...client.ListOption) []reconcile.Request {
+	var repos v1.RepositoryList
+	if err := c.List(ctx, &repos, opts...); err != nil {
+		return nil
+	}
+	reqs := make([]reconcile.Request, len(repos.Items))
+	for i, repo := range repos.Items {
+		reqs[i] = reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&repo)}
+	}
+	return reqs
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *RepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1beta1.Repository{}).
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &v1.Repository{}, secretRefsField, referenceNames("Secret")); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &v1.Repository{}, configMapRefsField, referenceNames("ConfigMap")); err != nil {
+		return err
+	}
+	// enqueue Repositories that refer to the object
+	mapFunc := func(field string) handler.MapFunc {
+		return func(o client.Object) []reconcile.Request {
+			return listRepositoryRequests(ctx, mgr.GetClient(), client.InNamespace(o.GetNamespace()), client.MatchingFields{field: o.GetName()})
+		}
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&v1.Repository{}).
 		Owns(&batchv1.CronJob{}).
-		Complete(r)
+		// Jobs are owned by the CronJob
+		Watches(&source.Kind{Type: &batchv1.Job{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			labels := o.GetLabels()
+			if labels["app.kubernetes.io/created-by"] != ControllerName {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: o.GetNamespace(), Name: labels["app.kubernetes.io/instance"]}}}
+		})).
+		// watch only the metadata so that the data of Secrets are not cached
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(mapFunc(secretRefsField)), builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(mapFunc(configMapRefsField)), builder.OnlyMetadata).
+		// BackupPolicies and the labels of namespaces decide whether Jobs may rewrite URLs
+		Watches(&source.Kind{Type: &v1beta1.BackupPolicy{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			return listRepositoryRequests(ctx, mgr.GetClient())
+		})).
+		Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []reconcile.Request {
+			return listRepositoryRequests(ctx, mgr.GetClient(), client.InNamespace(o.GetName()))
+		}), builder.WithPredicates(predicate.LabelChangedPredicate{}))
+	if r.CloudEvents != nil {
+		// Repositories without finalizers are not reconciled on deletion
+		b = b.Watches(&source.Kind{Type: &v1.Repository{}}, handler.Funcs{
+			DeleteFunc: func(e event.DeleteEvent, _ workqueue.RateLimitingInterface) {
+				if repo, ok := e.Object.(*v1.Repository); ok {
+					r.publishDeletedEvent(*repo)
+				}
+			},
+		})
+	}
+	return b.Complete(r)
 }
@@ -0,0 +1,340 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	batchv1apply "k8s.io/client-go/applyconfigurations/batch/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	metav1apply "k8s.io/client-go/applyconfigurations/meta/v1"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
+)
+
+const (
+	RestoreControllerName = v1beta1.OperatorName + "-restore-controller"
+)
+
+// RestoreReconciler reconciles a Restore object
+type RestoreReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// APIReader reads the Pods of finished Jobs without caching all Pods in the cluster.
+	APIReader client.Reader
+}
+
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=restores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=restores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=restores/finalizers,verbs=update
+//+kubebuilder:rbac:groups=gitbackup.ebiiim.com,resources=repositories,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;delete
+
+// Reconcile moves the current state of the cluster closer to the desired state.
+func (r *RestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lg := log.FromContext(ctx)
+	lg.Info("Reconcile")
+
+	var rst v1beta1.Restore
+	err := r.Get(ctx, req.NamespacedName, &rst)
+	if errors.IsNotFound(err) {
+		lg.Info("Restore is already deleted")
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		lg.Error(err, "unable to get Restore")
+		return ctrl.Result{}, err
+	}
+	if !rst.DeletionTimestamp.IsZero() {
+		lg.Info("Restore is being deleted")
+		return ctrl.Result{}, nil
+	}
+	if rst.Status.Phase == v1beta1.RestoreSucceeded || rst.Status.Phase == v1beta1.RestoreFailed {
+		lg.Info("Restore is already finished", "phase", rst.Status.Phase)
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.reconcileJob(ctx, rst); err != nil {
+		if err2 := r.updateStatus(ctx, rst, nil, err.Error()); err2 != nil {
+			return ctrl.Result{}, err2
+		}
+		return ctrl.Result{}, err
+	}
+
+	var job batchv1.Job
+	if err := r.Get(ctx, client.ObjectKey{Namespace: rst.Namespace, Name: rst.GetOwnedJobName()}, &job); err != nil {
+		lg.Error(err, "unable to get Job")
+		return ctrl.Result{}, err
+	}
+	if err := r.updateStatus(ctx, rst, &job, ""); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// restoreSource is the backup to restore and how to access it.
+type restoreSource struct {
+	// URL is the URL of the backup.
+	URL string
+	// Refspecs are the refspecs used for the backup or nil if all refs are backed up.
+	Refspecs []string
+	// Credentials are the git credentials to mount.
+	Credentials []corev1.LocalObjectReference
+	// PodOptions and Retry are the ones of the Repository.
+	PodOptions v1.PodOptions
+	Retry      *v1.RetryPolicy
+}
+
+// resolveSpec returns rst.Spec with unspecified fields filled from the Repository and the backup to restore.
+// The credentials of both the source and the destination of the Repository are used if rst does not specify them.
+func (r *RestoreReconciler) resolveSpec(ctx context.Context, rst v1beta1.Restore) (v1beta1.RestoreSpec, restoreSource, error) {
+	spec := *rst.Spec.DeepCopy()
+	var src restoreSource
+	if spec.GitCredentials != nil {
+		src.Credentials = append(src.Credentials, *spec.GitCredentials)
+	}
+	if spec.Repository == nil {
+		if spec.GitImage == nil {
+			spec.GitImage = pointer.String(v1.DefaultGitImage)
+		}
+		src.URL = *spec.Src
+		return spec, src, nil
+	}
+
+	var repo v1.Repository
+	if err := r.Get(ctx, client.ObjectKey{Namespace: rst.Namespace, Name: spec.Repository.Name}, &repo); err != nil {
+		return spec, src, fmt.Errorf("unable to get Repository %s: %w", spec.Repository.Name, err)
+	}
+	if spec.GitImage == nil {
+		spec.GitImage = pointer.String(repo.GetGitImage())
+	}
+	if spec.ImagePullSecret == nil {
+		spec.ImagePullSecret = repo.Spec.ImagePullSecret
+	}
+	if spec.GitConfig == nil {
+		spec.GitConfig = &corev1.LocalObjectReference{Name: repo.GetGitConfigName()}
+	}
+	if src.Credentials == nil {
+		src.Credentials = repo.GetCredentials()
+	}
+	if enc := repo.Spec.Encryption; spec.Encryption == nil && enc != nil {
+		spec.Encryption = &v1beta1.EncryptionSpec{Type: v1beta1.EncryptionType(enc.Type), PublicKey: enc.PublicKey, PrivateKey: enc.PrivateKey}
+	}
+	src.URL = repo.Spec.Destination.URL
+	src.Refspecs = repo.GetRefspecs()
+	src.PodOptions = repo.Spec.PodOptions
+	if repo.Spec.JobPolicy != nil {
+		src.Retry = repo.Spec.JobPolicy.Retry
+	}
+	return spec, src, nil
+}
+
+func (r *RestoreReconciler) reconcileJob(ctx context.Context, rst v1beta1.Restore) error {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileJob")
+
+	// the Job runs only once so never update it
+	var cur batchv1.Job
+	err := r.Get(ctx, client.ObjectKey{Namespace: rst.Namespace, Name: rst.GetOwnedJobName()}, &cur)
+	if err == nil {
+		lg.Info("Job already created")
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		lg.Error(err, "unable to get current Job")
+		return err
+	}
+
+	spec, src, err := r.resolveSpec(ctx, rst)
+	if err != nil {
+		lg.Error(err, "unable to resolve spec")
+		return err
+	}
+	if spec.GitConfig == nil {
+		if err := r.reconcileGitConfig(ctx, rst); err != nil {
+			return err
+		}
+		spec.GitConfig = &corev1.LocalObjectReference{Name: rst.GetOwnedConfigMapName()}
+	}
+
+	var snapshot, asOf string
+	if spec.Snapshot != nil {
+		snapshot = *spec.Snapshot
+	}
+	if spec.AsOf != nil {
+		asOf = spec.AsOf.UTC().Format(v1beta1.SnapshotIDFormat)
+	}
+	script := restoreScript(src.URL, spec.Target, spec.Encryption != nil, src.Refspecs, snapshot, asOf, src.Retry)
+
+	var enc *v1.EncryptionSpec
+	if e := spec.Encryption; e != nil {
+		enc = &v1.EncryptionSpec{Type: v1.EncryptionType(e.Type), PublicKey: e.PublicKey, PrivateKey: e.PrivateKey}
+	}
+	volumes, volumeMounts := gitVolumes(spec.GitConfig.Name, src.Credentials, enc)
+	homeVols, homeMounts := homeVolumes()
+	volumes = append(volumes, homeVols...)
+	volumeMounts = append(volumeMounts, homeMounts...)
+	restricted, err := urlsRestricted(ctx, r.Client, rst.Namespace)
+	if err != nil {
+		lg.Error(err, "unable to check BackupPolicies")
+		return err
+	}
+	podTemplateSpec := corev1apply.PodTemplateSpec().WithSpec(corev1apply.PodSpec().
+		WithRestartPolicy(corev1.RestartPolicyNever).
+		WithContainers(gitContainer(*spec.GitImage, script, volumeMounts, restricted)).
+		WithVolumes(volumes...))
+	if err := applyPodOptions(podTemplateSpec.Spec, src.PodOptions); err != nil {
+		lg.Error(err, "unable to apply pod options")
+		return err
+	}
+	if spec.ImagePullSecret != nil {
+		podTemplateSpec.Spec.WithImagePullSecrets(corev1apply.LocalObjectReference().
+			WithName(spec.ImagePullSecret.Name))
+	}
+
+	gvk, err := apiutil.GVKForObject(&rst, r.Scheme)
+	if err != nil {
+		lg.Error(err, "unable to get GVK for Restore")
+		return err
+	}
+	ownerReference := metav1apply.OwnerReference().
+		WithAPIVersion(gvk.GroupVersion().Identifier()).
+		WithKind(gvk.Kind).
+		WithName(rst.Name).
+		WithUID(rst.GetUID()).
+		WithBlockOwnerDeletion(true).
+		WithController(true)
+
+	job := batchv1apply.Job(rst.GetOwnedJobName(), rst.Namespace).
+		WithLabels(map[string]string{
+			"app.kubernetes.io/name":       v1beta1.OperatorName,
+			"app.kubernetes.io/instance":   rst.Name,
+			"app.kubernetes.io/created-by": RestoreControllerName,
+		}).
+		WithOwnerReferences(ownerReference).
+		WithSpec(batchv1apply.JobSpec().
+			WithParallelism(1).
+			WithCompletions(1).
+			// A failed restore should be investigated rather than retried many times.
+			WithBackoffLimit(1).
+			WithTemplate(podTemplateSpec))
+
+	lg.Info("do server-side apply")
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(job)
+	if err != nil {
+		return err
+	}
+	patch := &unstructured.Unstructured{
+		Object: obj,
+	}
+	if err := r.Patch(ctx, patch, client.Apply, &client.PatchOptions{
+		FieldManager: RestoreControllerName,
+		Force:        pointer.Bool(true),
+	}); err != nil {
+		lg.Error(err, "unable to create Job")
+		return err
+	}
+
+	return nil
+}
+
+func (r *RestoreReconciler) reconcileGitConfig(ctx context.Context, rst v1beta1.Restore) error {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileGitConfig")
+
+	cm := &corev1.ConfigMap{}
+	cm.SetNamespace(rst.Namespace)
+	cm.SetName(rst.GetOwnedConfigMapName())
+
+	op, err := ctrl.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Data = map[string]string{
+			".gitconfig": "[credential]\n\thelper = store",
+		}
+		return ctrl.SetControllerReference(&rst, cm, r.Scheme)
+	})
+	if err != nil {
+		lg.Error(err, "unable to create or update default GitConfig cm")
+		return err
+	}
+
+	lg.Info("default GitConfig cm", "op", op)
+
+	return nil
+}
+
+// updateStatus updates rst.Status from job. job is nil if the Job could not be created because of msg.
+func (r *RestoreReconciler) updateStatus(ctx context.Context, rst v1beta1.Restore, job *batchv1.Job, msg string) error {
+	lg := log.FromContext(ctx)
+	lg.Info("updateStatus")
+
+	status := v1beta1.RestoreStatus{
+		Phase:   v1beta1.RestorePending,
+		Message: msg,
+	}
+	if job != nil {
+		status.JobName = job.Name
+		status.StartTime = job.Status.StartTime
+		if job.Status.StartTime != nil {
+			status.Phase = v1beta1.RestoreRunning
+		}
+		for _, c := range job.Status.Conditions {
+			if c.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch c.Type {
+			case batchv1.JobComplete:
+				status.Phase = v1beta1.RestoreSucceeded
+				status.CompletionTime = job.Status.CompletionTime
+				status.Message = "restored"
+				if rst.Spec.Snapshot != nil || rst.Spec.AsOf != nil {
+					// the script writes the ID of the restored snapshot
+					status.Snapshot = terminationMessage(ctx, r.APIReader, job)
+				}
+			case batchv1.JobFailed:
+				status.Phase = v1beta1.RestoreFailed
+				status.CompletionTime = &c.LastTransitionTime
+				status.Message = c.Message
+				// the script writes a jobReport if git commands failed and a plain message otherwise
+				var report jobReport
+				if m := terminationMessage(ctx, r.APIReader, job); json.Unmarshal([]byte(m), &report) == nil && report.Reason != "" {
+					status.Message = fmt.Sprintf("%s: %s", report.Reason, report.Message)
+				} else if m != "" {
+					status.Message = m
+				}
+			}
+		}
+	}
+
+	if equality.Semantic.DeepEqual(rst.Status, status) {
+		return nil
+	}
+	rst.Status = status
+	if err := r.Status().Update(ctx, &rst); err != nil {
+		lg.Error(err, "unable to update status")
+		return err
+	}
+	lg.Info("status updated", "phase", status.Phase)
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *RestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1beta1.Restore{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
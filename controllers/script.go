@@ -0,0 +1,568 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+const (
+	// metadataDir is where the metadata-exporter init container writes JSON files.
+	metadataDir = "/metadata"
+
+	// stateDir is where the state ConfigMap of the Repository is mounted.
+	stateDir = "/state"
+
+	// encryptionDir is where the encryption keys are mounted.
+	encryptionDir  = "/encryption"
+	publicKeyFile  = "public.asc"
+	privateKeyFile = "private.asc"
+
+	// terminationLog is the default terminationMessagePath.
+	terminationLog = "/dev/termination-log"
+
+	// gitErrFile keeps the stderr of the last git command to classify failures.
+	gitErrFile = "/tmp/gitbackup-stderr"
+
+	// noURLRewritesEnv is set to "true" in the git container if BackupPolicies restrict the URLs of the namespace.
+	noURLRewritesEnv = "GITBACKUP_NO_URL_REWRITES"
+
+	defaultRetryAttempts            = 3
+	defaultRetryInitialDelaySeconds = 10
+	defaultRetryMaxDelaySeconds     = 300
+)
+
+func echo(format string, a ...any) string {
+	logPrefix := "echo $(date -Iseconds) gitbackup: "
+	return fmt.Sprintf(logPrefix+format, a...)
+}
+
+// backupScript generates shell commands to backup repo.
+func backupScript(repo v1.Repository) string {
+	srcs := strings.Split(repo.Spec.Source.URL, "/")
+	srcRepoName := srcs[len(srcs)-1]
+
+	cmds := setupCommands()
+	var retry *v1.RetryPolicy
+	if repo.Spec.JobPolicy != nil {
+		retry = repo.Spec.JobPolicy.Retry
+	}
+	cmds = append(cmds, retryCommands(retry)...)
+	cmds = append(cmds, noURLRewritesCommands()...)
+
+	dst := repo.Spec.Destination.URL
+	if repo.Spec.Encryption != nil {
+		cmds = append(cmds, encryptionCommands()...)
+		dst = "gcrypt::" + dst
+	}
+
+	refspecs := repo.GetRefspecs()
+	if refspecs == nil {
+		cmds = append(cmds,
+			echo("clone src repo '%s'", repo.Spec.Source.URL),
+			fmt.Sprintf("retry git clone --mirror '%s'", repo.Spec.Source.URL),
+			fmt.Sprintf("cd '%s.git'", srcRepoName),
+		)
+	} else {
+		// fetch and push explicit refspecs instead of --mirror
+		cmds = append(cmds,
+			echo("fetch src repo '%s'", repo.Spec.Source.URL),
+			fmt.Sprintf("git init --bare '%s.git'", srcRepoName),
+			fmt.Sprintf("cd '%s.git'", srcRepoName),
+			fmt.Sprintf("retry git fetch --prune '%s' %s", repo.Spec.Source.URL, quoteAll(refspecs)),
+			// point HEAD to the default branch of the source as "git clone --mirror" does
+			fmt.Sprintf("retry git ls-remote --symref '%s' HEAD > /tmp/gitbackup-head", repo.Spec.Source.URL),
+			`head=$(awk '$1 == "ref:" { print $2 }' /tmp/gitbackup-head)`,
+			`if [ -n "$head" ]; then git symbolic-ref HEAD "$head"; fi`,
+		)
+	}
+
+	if repo.Spec.Metadata != nil {
+		ref := *repo.Spec.Metadata.Ref
+		cmds = append(cmds, metadataCommands(dst, ref)...)
+		if refspecs != nil {
+			refspecs = append(refspecs, "+"+ref+":"+ref)
+		}
+	}
+
+	if repo.Spec.Snapshots != nil {
+		cmds = append(cmds, snapshotCommands(dst, repo.Spec.Snapshots.Keep)...)
+		if refspecs != nil {
+			refspecs = append(refspecs, "+"+v1.SnapshotsRef+"/*:"+v1.SnapshotsRef+"/*")
+		}
+	}
+
+	policy := repo.GetOnDestinationDrift()
+	if policy != v1.DriftOverwrite {
+		cmds = append(cmds, driftCommands(dst, keepRefsFunc(repo), policy)...)
+		// the refs to push are recorded to be compared with the destination on the next backup
+		cmds = append(cmds, stateCommands(keepRefsFunc(repo))...)
+		if refspecs != nil {
+			if policy == v1.DriftPreserveUnderRef {
+				refspecs = append(refspecs, "+"+v1.DriftRef+"/*:"+v1.DriftRef+"/*")
+			}
+			refspecs = append(refspecs, "+"+v1.StateRef+":"+v1.StateRef)
+		}
+	}
+
+	cmds = append(cmds, echo("push to dst repo '%s'", dst))
+	if refspecs == nil {
+		cmds = append(cmds, fmt.Sprintf("retry git push --mirror '%s'", dst))
+	} else {
+		cmds = append(cmds, fmt.Sprintf("retry git push --force --prune '%s' %s", dst, quoteAll(refspecs)))
+	}
+
+	if policy != v1.DriftOverwrite {
+		// the controller records the digest to the state ConfigMap
+		cmds = append(cmds, "refs_digest=$(sha256sum < /tmp/gitbackup-pushed-refs | cut -d ' ' -f 1)")
+	}
+
+	cmds = append(cmds, statsCommands()...)
+	cmds = append(cmds,
+		"report '' ''",
+		"set +e",
+		echo("completed"),
+	)
+	return strings.Join(cmds, ";")
+}
+
+// statsCommands sets $stats to the JSON of the statistics of the local repository:
+// the number of refs except the ones used by gitbackup itself, the default branch, its commit and the size of objects in KiB.
+func statsCommands() []string {
+	return []string{
+		`refs=$(git for-each-ref --format='%(refname)' | grep -vc '^refs/gitbackup/' || true)`,
+		`branch=$(git symbolic-ref -q --short HEAD || true)`,
+		`commit=$(git rev-parse -q --verify 'HEAD^{commit}' || true)`,
+		`size=$(git count-objects -v | awk '/^size(-pack)?:/ { s += $2 } END { print s }')`,
+		`stats=$(printf '{"refs":%d,"defaultBranch":"%s","headCommit":"%s","sizeKiB":%d}' "$refs" "$branch" "$commit" "$size")`,
+		echo(`$refs refs, default branch $branch at $commit, $size KiB`),
+	}
+}
+
+// refsDigestFile is the key of the state ConfigMap that has the SHA-256 digest of the list of refs in v1.StateRef.
+const refsDigestFile = "refs-digest"
+
+// stateCommands commits the list of the local refs that keep(r) accepts with their object names to v1.StateRef,
+// so that the following push records the refs in the destination.
+// keep is the awk function generated by keepRefsFunc.
+func stateCommands(keep string) []string {
+	git := "git -c user.name=" + v1.OperatorName + " -c user.email=" + v1.OperatorName + "@localhost"
+	return []string{
+		fmt.Sprintf(`git for-each-ref --format='%%(objectname) %%(refname)' | awk '%s keep($2)' | sort -k 2 > /tmp/gitbackup-pushed-refs`, keep),
+		`tree=$(printf '100644 blob %s\trefs\n' "$(git hash-object -w /tmp/gitbackup-pushed-refs)" | git mktree)`,
+		fmt.Sprintf(`git update-ref '%s' "$(%s commit-tree "$tree" -m "%s: state")"`, v1.StateRef, git, v1.OperatorName),
+	}
+}
+
+// driftCommands compares the refs in dst with the ones recorded in v1.StateRef by the last backup
+// and handles the refs that have been changed according to policy.
+// The recorded refs are used only if their digest matches the one in stateDir, and nothing is checked if no digest is recorded.
+// A ref is drifted if it has been created or its commit is not a descendant of the recorded one (e.g. force-pushed),
+// while fast-forwarded and deleted refs are not. Drifted refs are fetched under "{v1.DriftRef}/{ID}/".
+//   - DriftFail reports FailureDrift and exits.
+//   - DriftPreserveUnderRef keeps the drifted refs so that the push also saves them.
+func driftCommands(dst, keep string, policy v1.DriftPolicy) []string {
+	state := stateDir + "/" + refsDigestFile
+	var onDrift []string
+	switch policy {
+	case v1.DriftFail:
+		msg := "refs in the destination have been changed since the last backup"
+		onDrift = []string{
+			fmt.Sprintf("report %s '%s'", v1.FailureDrift, msg),
+			"exit 1",
+		}
+	case v1.DriftPreserveUnderRef:
+		onDrift = []string{
+			echo(`$drifted refs preserved under $prefix`),
+		}
+	}
+	cmds := []string{}
+	if policy == v1.DriftPreserveUnderRef {
+		// keep the refs preserved by the previous backups
+		cmds = append(cmds, fmt.Sprintf("git fetch '%s' '+%s/*:%s/*' || true", dst, v1.DriftRef, v1.DriftRef))
+	}
+	// changed refs are listed as "<recorded object or -> <object in dst> <ref>"
+	changed := keep + ` ` +
+		`FILENAME == ARGV[1] { old[$2] = $1; next } ` +
+		`keep($2) { if (!($2 in old)) print "-", $1, $2; else if (old[$2] != $1) print old[$2], $1, $2 }`
+	cmds = append(cmds, fmt.Sprintf(`if [ -f %s ]; then `+
+		`%s; retry git ls-remote --refs '%s' > /tmp/gitbackup-dst-refs; `+
+		`: > /tmp/gitbackup-last-refs; `+
+		`if awk '$2 == "%s" { f = 1 } END { exit !f }' /tmp/gitbackup-dst-refs; then `+
+		`retry git fetch '%s' '+%s:%s'; git cat-file blob '%s:refs' > /tmp/gitbackup-last-refs || true; fi; `+
+		`if [ "$(sha256sum < /tmp/gitbackup-last-refs | cut -d ' ' -f 1)" != "$(cat %s)" ]; then `+
+		`%s; : > /tmp/gitbackup-last-refs; fi; `+
+		`awk '%s' /tmp/gitbackup-last-refs /tmp/gitbackup-dst-refs > /tmp/gitbackup-changed-refs; `+
+		`id=$(date -u +%s); prefix="%s/$id/"; `+
+		`if [ -s /tmp/gitbackup-changed-refs ]; then retry git fetch '%s' $(awk -v p="$prefix" '{ print "+" $3 ":" p substr($3, 6) }' /tmp/gitbackup-changed-refs); fi; `+
+		`while read old new r; do `+
+		`if [ "$old" != - ] && git merge-base --is-ancestor "$old" "$new" 2>/dev/null; then git update-ref -d "$prefix${r#refs/}"; fi; `+
+		`done < /tmp/gitbackup-changed-refs; `+
+		`drifted=$(git for-each-ref "$prefix" | wc -l); `+
+		`if [ "$drifted" -ne 0 ]; then %s; git for-each-ref --format='%%(refname)' "$prefix"; %s; else %s; fi; `+
+		`else %s; fi`,
+		state,
+		echo("check drift in dst repo '%s'", dst), dst,
+		v1.StateRef,
+		dst, v1.StateRef, v1.StateRef, v1.StateRef,
+		state,
+		echo("refs pushed by the last backup are not found in dst, treat all refs as changed"),
+		changed,
+		snapshotIDDateFormat, v1.DriftRef,
+		dst,
+		echo(`drift detected in $drifted refs`), strings.Join(onDrift, "; "), echo("no drift"),
+		echo("no refs digest recorded, skip drift check"),
+	))
+	return cmds
+}
+
+// maxDryRunChanges is the maximum number of changed refs in the report of a dry-run Job
+// so that the report fits in the termination message (4096 bytes).
+const maxDryRunChanges = 10
+
+// dryRunScript generates shell commands to compare the refs in the source and the destination of repo
+// and report the refs that a backup would create, update or delete in the destination without pushing.
+// Refs used by gitbackup itself (refs/gitbackup/*) are not compared.
+func dryRunScript(repo v1.Repository) string {
+	cmds := setupCommands()
+	var retry *v1.RetryPolicy
+	if repo.Spec.JobPolicy != nil {
+		retry = repo.Spec.JobPolicy.Retry
+	}
+	cmds = append(cmds, retryCommands(retry)...)
+	cmds = append(cmds, noURLRewritesCommands()...)
+
+	dst := repo.Spec.Destination.URL
+	if repo.Spec.Encryption != nil {
+		cmds = append(cmds, encryptionCommands()...)
+		dst = "gcrypt::" + dst
+	}
+
+	diff := keepRefsFunc(repo) + ` ` +
+		`FILENAME == ARGV[1] { if (keep($2)) dst[$2] = $1; next } ` +
+		`keep($2) { src[$2] = 1; if (!($2 in dst)) print "Created", $2; else if (dst[$2] != $1) print "Updated", $2 } ` +
+		`END { for (r in dst) if (!(r in src)) print "Deleted", r }`
+
+	cmds = append(cmds,
+		"git init --bare dryrun.git",
+		"cd dryrun.git",
+		echo("list refs in src repo '%s'", repo.Spec.Source.URL),
+		fmt.Sprintf("retry git ls-remote --refs '%s' > /tmp/gitbackup-src-refs", repo.Spec.Source.URL),
+		echo("list refs in dst repo '%s'", dst),
+		fmt.Sprintf("retry git ls-remote --refs '%s' > /tmp/gitbackup-dst-refs", dst),
+		fmt.Sprintf("awk '%s' /tmp/gitbackup-dst-refs /tmp/gitbackup-src-refs | sort -k 2 > /tmp/gitbackup-changes", diff),
+		`cat /tmp/gitbackup-changes`,
+		fmt.Sprintf(`created=$(grep -c '^%s ' /tmp/gitbackup-changes || true)`, v1.RefCreated),
+		fmt.Sprintf(`updated=$(grep -c '^%s ' /tmp/gitbackup-changes || true)`, v1.RefUpdated),
+		fmt.Sprintf(`deleted=$(grep -c '^%s ' /tmp/gitbackup-changes || true)`, v1.RefDeleted),
+		fmt.Sprintf(`changes=$(head -n %d /tmp/gitbackup-changes | sed -e 's/\\/\\\\/g' -e 's/"/\\"/g' | `+
+			`awk '{ printf "%%s{\"type\":\"%%s\",\"ref\":\"%%s\"}", (NR > 1 ? "," : ""), $1, $2 }')`, maxDryRunChanges),
+		fmt.Sprintf(`printf '{"reason":"","attempts":%%d,"message":"","dryRun":{"created":%%d,"updated":%%d,"deleted":%%d,"changes":[%%s]}}' `+
+			`"$attempts" "$created" "$updated" "$deleted" "$changes" > %s`, terminationLog),
+		echo(`dry run: $created created, $updated updated, $deleted deleted`),
+		"set +e",
+		echo("completed"),
+	)
+	return strings.Join(cmds, ";")
+}
+
+// keepRefsFunc returns an awk function "keep(r)" that tests if the ref r is backed up to the destination of repo
+// and compared with the source on dry runs and drift detection.
+// Refs used by gitbackup itself (refs/gitbackup/*) including preserved drift refs are excluded.
+func keepRefsFunc(repo v1.Repository) string {
+	include := []string{"refs/*"}
+	var exclude []string
+	if refs := repo.Spec.Refs; refs != nil {
+		if len(refs.Include) != 0 {
+			include = refs.Include
+		}
+		exclude = refs.Exclude
+	}
+	exclude = append(exclude, "refs/gitbackup/*")
+	var conds []string
+	for _, p := range include {
+		conds = append(conds, fmt.Sprintf(`r ~ "%s"`, refPatternRegexp(p)))
+	}
+	keep := "(" + strings.Join(conds, " || ") + ")"
+	for _, p := range exclude {
+		keep += fmt.Sprintf(` && r !~ "%s"`, refPatternRegexp(p))
+	}
+	return `function keep(r) { return ` + keep + ` }`
+}
+
+// refPatternRegexp converts a ref pattern e.g. "refs/heads/*" to an extended regular expression
+// that matches the same refs as the pattern in refspecs. It contains no backslashes so that
+// it can be used in awk strings.
+func refPatternRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '.', '+', '(', ')', '{', '}', '|', '$':
+			b.WriteString("[" + string(c) + "]")
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Patterns of git errors for grep -Ei to classify failures.
+// Auth and NotFound are tested first as ssh also prints "remote end hung up" for them.
+const (
+	authErrors      = `authentication failed|permission denied|could not read (username|password)|terminal prompts disabled|invalid username or password|access denied|host key verification failed|returned error: 40[13]`
+	notFoundErrors  = `repository not found|does not appear to be a git repository|could not be found|returned error: 404`
+	transientErrors = `could not resolve host|temporary failure in name resolution|name or service not known|connection refused|connection reset|timed out|failed to connect|network is unreachable|early eof|rpc failed|unexpected disconnect|remote end hung up|returned error: (429|5[0-9][0-9])|gnutls_handshake|ssl_(read|connect)`
+)
+
+// retryCommands defines shell functions:
+//   - "retry" runs a git command and retries it with exponential backoff if it fails with a transient error.
+//     If the command fails otherwise or runs out of attempts, it reports the classified reason and exits.
+//   - "report" writes a jobReport with the reason and the message to the termination log.
+//     $refs_digest and $stats (JSON) are also reported if they are set.
+func retryCommands(p *v1.RetryPolicy) []string {
+	attempts, delay, maxDelay := int32(defaultRetryAttempts), int32(defaultRetryInitialDelaySeconds), int32(defaultRetryMaxDelaySeconds)
+	if p != nil {
+		if p.Attempts != nil {
+			attempts = *p.Attempts
+		}
+		if p.InitialDelaySeconds != nil {
+			delay = *p.InitialDelaySeconds
+		}
+		if p.MaxDelaySeconds != nil {
+			maxDelay = *p.MaxDelaySeconds
+		}
+	}
+	// the last line of stderr without credentials in URLs, escaped for JSON
+	lastErr := fmt.Sprintf(`grep -v '^$' %s | tail -n 1 | sed -e 's#://[^/@]*@#://#g' -e 's/\\/\\\\/g' -e 's/"/\\"/g' | tr -d '\000-\037'`, gitErrFile)
+	return []string{
+		"attempts=1",
+		"refs_digest=",
+		"stats=null",
+		fmt.Sprintf(`report() { printf '{"reason":"%%s","attempts":%%d,"message":"%%s","refsDigest":"%%s","stats":%%s}' "$1" "$attempts" "$2" "$refs_digest" "$stats" > %s; }`, terminationLog),
+		fmt.Sprintf(`classify() { `+
+			`if grep -Eqi '%s' %s; then echo %s; `+
+			`elif grep -Eqi '%s' %s; then echo %s; `+
+			`elif grep -Eqi '%s' %s; then echo %s; `+
+			`else echo %s; fi; }`,
+			authErrors, gitErrFile, v1.FailureAuth,
+			notFoundErrors, gitErrFile, v1.FailureNotFound,
+			transientErrors, gitErrFile, v1.FailureTransient,
+			v1.FailureUnknown),
+		fmt.Sprintf(`retry() { n=1; delay=%d; while true; do `+
+			`"$@" 2>%s && rc=0 || rc=$?; cat %s >&2; `+
+			`if [ $n -gt $attempts ]; then attempts=$n; fi; `+
+			`if [ $rc -eq 0 ]; then return 0; fi; `+
+			`reason=$(classify); `+
+			`if [ "$reason" != %s ] || [ $n -ge %d ]; then %s; report "$reason" "$(%s)"; exit $rc; fi; `+
+			`%s; sleep $delay; n=$((n+1)); delay=$((delay*2)); if [ $delay -gt %d ]; then delay=%d; fi; `+
+			`done; }`,
+			delay, gitErrFile, gitErrFile,
+			v1.FailureTransient, attempts, echo(`$1 $2 failed with $reason after $n attempts`), lastErr,
+			echo(`$1 $2 failed with $reason, retry in $delay seconds`), maxDelay, maxDelay),
+	}
+}
+
+// encryptionCommands imports the keys in encryptionDir and configures git-remote-gcrypt
+// to encrypt for all public keys and to sign with the private key.
+// Only ASCII-armored OpenPGP keys are accepted; other keys such as age keys are reported as FailureUnknown before anything is pushed.
+func encryptionCommands() []string {
+	// prints fingerprints of primary keys
+	fprs := `gpg --batch --with-colons --show-keys '%s' | awk -F: '/^(pub|sec):/{p=1;next} /^fpr:/&&p{print $10;p=0}'`
+	pub := encryptionDir + "/" + publicKeyFile
+	priv := encryptionDir + "/" + privateKeyFile
+	var checks []string
+	for _, k := range []struct{ file, field, block string }{
+		{pub, "publicKey", "PUBLIC"},
+		{priv, "privateKey", "PRIVATE"},
+	} {
+		msg := fmt.Sprintf("encryption.%s is not an ASCII-armored OpenPGP %s key, only OpenPGP keys are supported and age keys cannot be used",
+			k.field, strings.ToLower(k.block))
+		checks = append(checks, fmt.Sprintf(`if ! grep -q -e '-----BEGIN PGP %s KEY BLOCK-----' '%s'; then %s; report %s '%s'; exit 1; fi`,
+			k.block, k.file, echo(msg), v1.FailureUnknown, msg))
+	}
+	return append(checks,
+		echo("import encryption keys"),
+		"export GNUPGHOME=/tmp/gnupg",
+		"mkdir -m 700 -p $GNUPGHOME",
+		fmt.Sprintf("gpg --batch --import '%s' '%s'", pub, priv),
+		fmt.Sprintf("participants=$(%s | tr '\\n' ' ')", fmt.Sprintf(fprs, pub)),
+		fmt.Sprintf("signingkey=$(%s | head -n 1)", fmt.Sprintf(fprs, priv)),
+		// the keys are provided by the user so trust them
+		`for fpr in $participants $signingkey; do echo "$fpr:6:" | gpg --batch --import-ownertrust; done`,
+		`git config --global gcrypt.participants "$participants"`,
+		`git config --global gcrypt.signingkey "$signingkey"`,
+	)
+}
+
+// quoteAll returns single-quoted ss joined with spaces.
+func quoteAll(ss []string) string {
+	qs := make([]string, len(ss))
+	for i, s := range ss {
+		qs[i] = "'" + s + "'"
+	}
+	return strings.Join(qs, " ")
+}
+
+// snapshotCommands records all refs except refs/gitbackup/* as a new snapshot on top of
+// the snapshots in dst, and deletes old snapshots to keep the latest keep snapshots if keep is not nil.
+func snapshotCommands(dst string, keep *int32) []string {
+	cmds := []string{
+		echo("take snapshot"),
+		fmt.Sprintf("git fetch '%s' '+%s/*:%s/*' || true", dst, v1.SnapshotsRef, v1.SnapshotsRef),
+		fmt.Sprintf("id=$(date -u +%s)", snapshotIDDateFormat),
+		fmt.Sprintf(`git for-each-ref --format='%%(objectname) %%(refname)' refs/ | `+
+			`awk -v p="%s/$id/" '$2 !~ /^refs\/gitbackup\// {sub(/^refs\//, "", $2); print "update " p $2 " " $1}' | `+
+			`git update-ref --stdin`, v1.SnapshotsRef),
+		echo(`snapshot "$id" taken`),
+	}
+	if keep != nil {
+		cmds = append(cmds,
+			fmt.Sprintf(`for old in $(%s | sort -r | tail -n +%d); do `+
+				`git for-each-ref --format='delete %%(refname)' "%s/$old/" | git update-ref --stdin; `+
+				`%s; done`, listSnapshotsCommand, *keep+1, v1.SnapshotsRef, echo(`snapshot "$old" deleted`)),
+		)
+	}
+	return cmds
+}
+
+// snapshotIDDateFormat is v1.SnapshotIDFormat for date(1).
+const snapshotIDDateFormat = "%Y%m%dT%H%M%SZ"
+
+// listSnapshotsCommand prints snapshot IDs in ascending order.
+var listSnapshotsCommand = fmt.Sprintf("git for-each-ref --format='%%(refname)' '%s/' | cut -d/ -f%d | sort -u",
+	v1.SnapshotsRef, strings.Count(v1.SnapshotsRef, "/")+2)
+
+// restoreScript generates shell commands to push the backup in src to target.
+// Refs used by gitbackup itself (refs/gitbackup/*) are not restored.
+// refspecs are the ones used for the backup or nil if all refs are backed up.
+// If snapshot is not empty, the refs in the snapshot are restored instead.
+// If asOf is not empty, the refs in the latest snapshot whose ID is not greater than asOf are restored instead.
+// The clone and the push are retried according to retry.
+// The ID of the restored snapshot or the reason of the failure is written to the termination log.
+func restoreScript(src, target string, encrypted bool, refspecs []string, snapshot, asOf string, retry *v1.RetryPolicy) string {
+	cmds := setupCommands()
+	cmds = append(cmds, retryCommands(retry)...)
+	cmds = append(cmds, noURLRewritesCommands()...)
+	if encrypted {
+		cmds = append(cmds, encryptionCommands()...)
+		src = "gcrypt::" + src
+	}
+	if refspecs == nil {
+		refspecs = []string{"+refs/*:refs/*"}
+	}
+	refspecs = append(refspecs, "^refs/gitbackup/*")
+	cmds = append(cmds,
+		echo("clone backup repo '%s'", src),
+		fmt.Sprintf("retry git clone --mirror '%s' backup.git", src),
+		"cd backup.git",
+	)
+
+	if snapshot != "" || asOf != "" {
+		var find, notFound string
+		if snapshot != "" {
+			find = fmt.Sprintf("grep -x '%s' || true", snapshot)
+			notFound = fmt.Sprintf("snapshot %s not found", snapshot)
+		} else {
+			find = fmt.Sprintf(`awk '$0 <= "%s"' | tail -n 1`, asOf)
+			notFound = fmt.Sprintf("no snapshot at or before %s", asOf)
+		}
+		cmds = append(cmds,
+			fmt.Sprintf("id=$(%s | %s)", listSnapshotsCommand, find),
+			fmt.Sprintf(`if [ -z "$id" ]; then %s; echo '%s' > %s; exit 1; fi`, echo(notFound), notFound, terminationLog),
+			echo(`restore snapshot "$id"`),
+		)
+		cmds = append(cmds,
+			echo("push to target repo '%s'", target),
+			fmt.Sprintf(`retry git push --force --prune '%s' "+%s/$id/*:refs/*" '^refs/gitbackup/*'`, target, v1.SnapshotsRef),
+			fmt.Sprintf(`echo "$id" > %s`, terminationLog),
+		)
+	} else {
+		cmds = append(cmds,
+			echo("push to target repo '%s'", target),
+			fmt.Sprintf("retry git push --force --prune '%s' %s", target, quoteAll(refspecs)),
+		)
+	}
+
+	cmds = append(cmds,
+		"set +e",
+		echo("completed"),
+	)
+	return strings.Join(cmds, ";")
+}
+
+// cleanupScript generates shell commands to delete all refs in dst except the default branch.
+// Forges refuse to delete the branch that HEAD points to, so it is kept and reported in the termination message.
+// Encrypted backups are deleted in the same way as git-remote-gcrypt stores its data in ordinary refs.
+func cleanupScript(dst string, retry *v1.RetryPolicy) string {
+	cmds := setupCommands()
+	cmds = append(cmds, retryCommands(retry)...)
+	cmds = append(cmds, noURLRewritesCommands()...)
+	cmds = append(cmds,
+		"git init --bare cleanup.git",
+		"cd cleanup.git",
+		echo("list refs in dst repo '%s'", dst),
+		fmt.Sprintf("retry git ls-remote --symref '%s' HEAD > /tmp/gitbackup-head", dst),
+		`head=$(awk '$1 == "ref:" && $3 == "HEAD" { print $2 }' /tmp/gitbackup-head)`,
+		fmt.Sprintf("retry git ls-remote --refs '%s' > /tmp/gitbackup-refs", dst),
+		`refs=$(cut -f2 /tmp/gitbackup-refs | grep -vxF "${head:-HEAD}" | sed 's/^/:/')`,
+		fmt.Sprintf(`if [ -n "$refs" ]; then %s; retry git push '%s' $refs; else %s; fi`,
+			echo(`delete $(echo "$refs" | wc -l) refs in dst repo`), dst, echo("no refs to delete")),
+		fmt.Sprintf(`if cut -f2 /tmp/gitbackup-refs | grep -qxF "${head:-HEAD}"; then %s; report '' "%s"; else report '' ''; fi`,
+			echo("keep the default branch $head"),
+			"the default branch $head is kept as forges refuse to delete it; use destinationForge to delete the repository"),
+		"set +e",
+		echo("completed"),
+	)
+	return strings.Join(cmds, ";")
+}
+
+// noURLRewritesCommands reports FailurePolicy and exits if noURLRewritesEnv is "true" and the git config
+// rewrites URLs with url.*.insteadOf or url.*.pushInsteadOf, so that the git config cannot send backups
+// to URLs other than the ones allowed by BackupPolicies.
+// Includes are rejected as well as conditional includes may apply only inside repositories.
+func noURLRewritesCommands() []string {
+	msg := "the git config must not rewrite URLs with insteadOf or pushInsteadOf or include files as BackupPolicies restrict URLs"
+	return []string{
+		fmt.Sprintf(`if [ "$%s" = true ] && git config --name-only --list | grep -Eiq '^(url\..*\.(push)?insteadof|include\.path|includeif\..*\.path)$'; then `+
+			`%s; report %s '%s'; exit 1; fi`,
+			noURLRewritesEnv, echo(msg), v1.FailurePolicy, msg),
+	}
+}
+
+// setupCommands copies git config files and enables "set -e".
+func setupCommands() []string {
+	return []string{
+		echo("start"),
+		echo("set .gitconfig"),
+		`cp /gitconfig/.gitconfig "$HOME/.gitconfig"`,
+		echo("set .git-credentials"),
+		// the credentials of the source and the destination are mounted separately
+		`cat /gitcredentials/*/.git-credentials > "$HOME/.git-credentials"`,
+		"set -e",
+	}
+}
+
+// metadataCommands commits files in metadataDir to ref on top of the ref in dst,
+// so that the following "git push --mirror" pushes the metadata together.
+// No commit is made if nothing has changed.
+func metadataCommands(dst, ref string) []string {
+	git := "git -c user.name=" + v1.OperatorName + " -c user.email=" + v1.OperatorName + "@localhost"
+	return []string{
+		echo("commit metadata to '%s'", ref),
+		fmt.Sprintf("git fetch '%s' '+%s:%s' || true", dst, ref, ref),
+		"export GIT_INDEX_FILE=/tmp/gitbackup-metadata-index",
+		fmt.Sprintf("git --work-tree=%s add --all", metadataDir),
+		"tree=$(git write-tree)",
+		"unset GIT_INDEX_FILE",
+		fmt.Sprintf("parent=$(git rev-parse -q --verify '%s^{commit}' || true)", ref),
+		fmt.Sprintf(`if [ -z "$parent" ] || [ "$(git rev-parse "$parent^{tree}")" != "$tree" ]; then `+
+			`commit=$(%s commit-tree "$tree" ${parent:+-p "$parent"} -m "%s: metadata"); `+
+			`git update-ref '%s' "$commit"; `+
+			`else %s; fi`, git, v1.OperatorName, ref, echo("metadata not changed")),
+	}
+}
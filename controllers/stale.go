@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	cron "github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+// staleGauge is 1 if the Repository is stale and 0 otherwise. Repositories without MaxAge are not reported.
+var staleGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gitbackup_repository_stale",
+	Help: "Whether no backup of the Repository has succeeded within its maxAge.",
+}, []string{"namespace", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(staleGauge)
+}
+
+// staleDeadline returns when repo becomes stale: MaxAge after the latest successful backup,
+// or MaxAge after the first scheduled time since repo was created if no backup has succeeded.
+func staleDeadline(repo v1.Repository) time.Time {
+	since := repo.CreationTimestamp.Time
+	if t := repo.Status.LastSuccessTime; t != nil {
+		since = t.Time
+	} else {
+		spec := repo.Spec.Schedule
+		if repo.Spec.TimeZone != nil {
+			spec = "CRON_TZ=" + *repo.Spec.TimeZone + " " + spec
+		}
+		if sched, err := cron.ParseStandard(spec); err == nil {
+			since = sched.Next(since)
+		}
+	}
+	return since.Add(repo.Spec.MaxAge.Duration)
+}
+
+// reconcileStale sets the Stale condition and the metric of repo if MaxAge is specified
+// and returns the duration until repo becomes stale so that it is evaluated again without Job events.
+// It returns 0 if repo is already stale or MaxAge is not specified.
+func (r *RepositoryReconciler) reconcileStale(ctx context.Context, repo *v1.Repository, now time.Time) time.Duration {
+	lg := log.FromContext(ctx)
+	lg.Info("reconcileStale")
+
+	if repo.Spec.MaxAge == nil {
+		meta.RemoveStatusCondition(&repo.Status.Conditions, v1.ConditionStale)
+		staleGauge.DeleteLabelValues(repo.Namespace, repo.Name)
+		return 0
+	}
+
+	deadline := staleDeadline(*repo)
+	cond := metav1.Condition{
+		Type:               v1.ConditionStale,
+		Status:             metav1.ConditionFalse,
+		Reason:             "WithinMaxAge",
+		Message:            fmt.Sprintf("a backup is expected to succeed by %s", deadline.UTC().Format(time.RFC3339)),
+		ObservedGeneration: repo.Generation,
+	}
+	var requeueAfter time.Duration
+	if now.Before(deadline) {
+		requeueAfter = deadline.Sub(now)
+		staleGauge.WithLabelValues(repo.Namespace, repo.Name).Set(0)
+	} else {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "MaxAgeExceeded"
+		cond.Message = fmt.Sprintf("no backup has succeeded within maxAge %s; a backup was expected to succeed by %s", repo.Spec.MaxAge.Duration, deadline.UTC().Format(time.RFC3339))
+		staleGauge.WithLabelValues(repo.Namespace, repo.Name).Set(1)
+	}
+	meta.SetStatusCondition(&repo.Status.Conditions, cond)
+	return requeueAfter
+}
+
+// recordStale records a Warning event if repo has become stale since old.
+func (r *RepositoryReconciler) recordStale(repo v1.Repository, old v1.RepositoryStatus) {
+	cond := meta.FindStatusCondition(repo.Status.Conditions, v1.ConditionStale)
+	if cond == nil || cond.Status != metav1.ConditionTrue || meta.IsStatusConditionTrue(old.Conditions, v1.ConditionStale) {
+		return
+	}
+	r.Recorder.Event(&repo, corev1.EventTypeWarning, "Stale", cond.Message)
+}
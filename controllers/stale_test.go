@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	v1 "github.com/ebiiim/gitbackup/api/v1"
+)
+
+func Test_reconcileStale(t *testing.T) {
+	created := time.Date(2023, 1, 1, 12, 30, 0, 0, time.UTC)
+	lastSuccess := metav1.NewTime(time.Date(2023, 1, 3, 6, 0, 0, 0, time.UTC))
+	maxAge := &metav1.Duration{Duration: 25 * time.Hour}
+	tests := []struct {
+		name             string
+		timeZone         *string
+		maxAge           *metav1.Duration
+		lastSuccess      *metav1.Time
+		now              time.Time
+		wantStale        metav1.ConditionStatus
+		wantRequeueAfter time.Duration
+	}{
+		{"no maxAge", nil, nil, nil, created.Add(100 * time.Hour), "", 0},
+		// the first backup is scheduled at 2023-01-02 06:00
+		{"before the first backup", nil, maxAge, nil, created, metav1.ConditionFalse, 42*time.Hour + 30*time.Minute},
+		{"no backup succeeded", nil, maxAge, nil, created.Add(43 * time.Hour), metav1.ConditionTrue, 0},
+		{"time zone", pointer.String("Asia/Tokyo"), maxAge, nil, created, metav1.ConditionFalse, 33*time.Hour + 30*time.Minute},
+		{"within maxAge", nil, maxAge, &lastSuccess, lastSuccess.Add(24 * time.Hour), metav1.ConditionFalse, time.Hour},
+		{"maxAge exceeded", nil, maxAge, &lastSuccess, lastSuccess.Add(25 * time.Hour), metav1.ConditionTrue, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := v1.Repository{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "repo1", CreationTimestamp: metav1.NewTime(created)},
+				Spec:       v1.RepositorySpec{Schedule: "0 6 * * *", TimeZone: tt.timeZone, MaxAge: tt.maxAge},
+				Status: v1.RepositoryStatus{
+					LastSuccessTime: tt.lastSuccess,
+					Conditions:      []metav1.Condition{{Type: v1.ConditionStale, Status: metav1.ConditionTrue}},
+				},
+			}
+			r := &RepositoryReconciler{}
+			got := r.reconcileStale(context.Background(), &repo, tt.now)
+			if got != tt.wantRequeueAfter {
+				t.Errorf("reconcileStale() = %v, want %v", got, tt.wantRequeueAfter)
+			}
+			var status metav1.ConditionStatus
+			if cond := meta.FindStatusCondition(repo.Status.Conditions, v1.ConditionStale); cond != nil {
+				status = cond.Status
+			}
+			if status != tt.wantStale {
+				t.Errorf("Stale = %q, want %q", status, tt.wantStale)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package controllers_test
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"testing"
 	"time"
@@ -11,6 +14,8 @@ import (
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
@@ -21,6 +26,7 @@ import (
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	v1 "github.com/ebiiim/gitbackup/api/v1"
 	v1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
 	"github.com/ebiiim/gitbackup/controllers"
 	//+kubebuilder:scaffold:imports
@@ -56,6 +62,8 @@ var _ = BeforeSuite(func() {
 
 	err = v1beta1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
+	err = v1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:scheme
 
@@ -74,43 +82,48 @@ var _ = AfterSuite(func() {
 var (
 	wait      = func() { time.Sleep(100 * time.Millisecond) }
 	testNS    = "default"
-	testRepo1 = v1beta1.Repository{
+	testRepo1 = v1.Repository{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-repo1",
 			Namespace: testNS,
 		},
-		Spec: v1beta1.RepositorySpec{
-			Src:             "https://example.com/src",
-			Dst:             "https://example.com/dst",
+		Spec: v1.RepositorySpec{
+			Source:          v1.GitRemote{URL: "https://example.com/src"},
+			Destination:     v1.GitRemote{URL: "https://example.com/dst"},
 			Schedule:        "0 6 * * *",
 			TimeZone:        nil,
-			GitImage:        pointer.String(v1beta1.DefaultGitImage),
+			GitImage:        pointer.String(v1.DefaultGitImage),
 			ImagePullSecret: nil,
-			GitConfig: &corev1.LocalObjectReference{
-				Name: "gitbackup-repository-test-repo1-gitconfig",
-			},
-			GitCredentials: nil,
+			GitConfig:       nil,
 		},
 	}
-	testRepo2 = v1beta1.Repository{
+	testRepo2 = v1.Repository{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-repo2",
 			Namespace: testNS,
 		},
-		Spec: v1beta1.RepositorySpec{
-			Src:      "https://example.com/src",
-			Dst:      "https://example.com/dst",
+		Spec: v1.RepositorySpec{
+			Source: v1.GitRemote{
+				URL:         "https://example.com/src",
+				Credentials: &corev1.LocalObjectReference{Name: "user-specified-git-secret"},
+			},
+			Destination: v1.GitRemote{
+				URL:         "https://example.com/dst",
+				Credentials: &corev1.LocalObjectReference{Name: "user-specified-dst-secret"},
+			},
 			Schedule: "0 6 * * *",
 			TimeZone: pointer.String("Asia/Tokyo"),
-			GitImage: pointer.String(v1beta1.DefaultGitImage),
+			Suspend:  pointer.Bool(true),
+			GitImage: pointer.String(v1.DefaultGitImage),
 			ImagePullSecret: &corev1.LocalObjectReference{
 				Name: "user-specified-image-pull-secret",
 			},
 			GitConfig: &corev1.LocalObjectReference{
 				Name: "user-created-cm",
 			},
-			GitCredentials: &corev1.LocalObjectReference{
-				Name: "user-specified-git-secret",
+			JobPolicy: &v1.JobPolicy{
+				BackoffLimit:            pointer.Int32(2),
+				StartingDeadlineSeconds: pointer.Int64(600),
 			},
 		},
 	}
@@ -124,14 +137,16 @@ var _ = Describe("Repository controller", func() {
 		cncl = cancel
 
 		var err error
-		err = k8sClient.DeleteAllOf(ctx, &v1beta1.Repository{}, client.InNamespace(testNS))
+		err = k8sClient.DeleteAllOf(ctx, &v1.Repository{}, client.InNamespace(testNS))
 		Expect(err).NotTo(HaveOccurred())
 		err = k8sClient.DeleteAllOf(ctx, &batchv1.CronJob{}, client.InNamespace(testNS))
 		Expect(err).NotTo(HaveOccurred())
 		err = k8sClient.DeleteAllOf(ctx, &corev1.ConfigMap{}, client.InNamespace(testNS))
 		Expect(err).NotTo(HaveOccurred())
+		err = k8sClient.DeleteAllOf(ctx, &corev1.Secret{}, client.InNamespace(testNS))
+		Expect(err).NotTo(HaveOccurred())
 		Eventually(func() int {
-			var objs v1beta1.RepositoryList
+			var objs v1.RepositoryList
 			err = k8sClient.List(ctx, &objs, client.InNamespace(testNS))
 			Expect(err).NotTo(HaveOccurred())
 			return len(objs.Items)
@@ -155,8 +170,12 @@ var _ = Describe("Repository controller", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		reconciler := controllers.RepositoryReconciler{
-			Client: k8sClient,
-			Scheme: scheme.Scheme,
+			Client:    k8sClient,
+			Scheme:    scheme.Scheme,
+			APIReader: k8sClient,
+			Recorder:  mgr.GetEventRecorderFor(controllers.ControllerName),
+			// the test Notifier listens on the loopback address
+			AllowInternalNotificationSinks: true,
 		}
 		err = reconciler.SetupWithManager(mgr)
 		Expect(err).NotTo(HaveOccurred())
@@ -184,15 +203,19 @@ var _ = Describe("Repository controller", func() {
 
 		cm := corev1.ConfigMap{}
 		Eventually(func() error {
-			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.Spec.GitConfig.Name}, &cm)
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedConfigMapName()}, &cm)
 		}).Should(Succeed())
 		Expect(cm.Data).Should(HaveKey(".gitconfig"))
 
 		cj := batchv1.CronJob{}
 		Eventually(func() error {
-			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: v1beta1.OperatorName + "-" + repo.Name}, &cj)
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: v1.OperatorName + "-" + repo.Name}, &cj)
 		}).Should(Succeed())
 		Expect(cj.Spec.Schedule).Should(Equal(repo.Spec.Schedule))
+		podSpec := cj.Spec.JobTemplate.Spec.Template.Spec
+		Expect(podSpec.SecurityContext.RunAsNonRoot).Should(Equal(pointer.Bool(true)))
+		Expect(podSpec.Containers[0].SecurityContext.ReadOnlyRootFilesystem).Should(Equal(pointer.Bool(true)))
+		Expect(podSpec.Containers[0].WorkingDir).Should(Equal("/home/gitbackup"))
 	})
 
 	It("should only create CronJob", func() {
@@ -209,98 +232,631 @@ var _ = Describe("Repository controller", func() {
 
 		cj := batchv1.CronJob{}
 		Eventually(func() error {
-			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: v1beta1.OperatorName + "-" + repo.Name}, &cj)
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: v1.OperatorName + "-" + repo.Name}, &cj)
 		}).Should(Succeed())
 		Expect(cj.Spec.Schedule).Should(Equal(repo.Spec.Schedule))
+		Expect(cj.Spec.StartingDeadlineSeconds).Should(Equal(pointer.Int64(600)))
+		Expect(cj.Spec.ConcurrencyPolicy).Should(Equal(batchv1.ReplaceConcurrent))
+		Expect(cj.Spec.Suspend).Should(Equal(pointer.Bool(true)))
+		Expect(cj.Spec.JobTemplate.Spec.BackoffLimit).Should(Equal(pointer.Int32(2)))
+		var secrets []string
+		for _, v := range cj.Spec.JobTemplate.Spec.Template.Spec.Volumes {
+			if v.Secret != nil {
+				secrets = append(secrets, v.Secret.SecretName)
+			}
+		}
+		Expect(secrets).Should(Equal([]string{"user-specified-git-secret", "user-specified-dst-secret"}))
+	})
+
+	It("should forbid URL rewrites if BackupPolicies restrict URLs", func() {
+		repo := testRepo1
+		ctx := context.Background()
+
+		err := k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		env := func() []corev1.EnvVar {
+			var cj batchv1.CronJob
+			if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedCronJobName()}, &cj); err != nil {
+				return nil
+			}
+			return cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env
+		}
+		noURLRewrites := corev1.EnvVar{Name: "GITBACKUP_NO_URL_REWRITES", Value: "true"}
+		Eventually(env).ShouldNot(BeEmpty())
+		Expect(env()).ShouldNot(ContainElement(noURLRewrites))
+
+		policy := v1beta1.BackupPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-policy"},
+			Spec:       v1beta1.BackupPolicySpec{Destinations: []v1beta1.URLRule{{Hosts: []string{"example.com"}}}},
+		}
+		err = k8sClient.Create(ctx, &policy)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &policy)).To(Succeed())
+		}()
+		// the BackupPolicy is watched
+		Eventually(env).Should(ContainElement(noURLRewrites))
+	})
+
+	It("should report missing references", func() {
+		ctx := context.Background()
+		getCondition := func(name string) func() metav1.ConditionStatus {
+			return func() metav1.ConditionStatus {
+				var repo v1.Repository
+				if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: name}, &repo); err != nil {
+					return ""
+				}
+				cond := meta.FindStatusCondition(repo.Status.Conditions, v1.ConditionReferencesResolved)
+				if cond == nil {
+					return ""
+				}
+				return cond.Status
+			}
+		}
+
+		repo1 := testRepo1
+		err := k8sClient.Create(ctx, &repo1)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(getCondition(repo1.Name)).Should(Equal(metav1.ConditionTrue))
+
+		repo2 := testRepo2
+		err = k8sClient.Create(ctx, &repo2)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(getCondition(repo2.Name)).Should(Equal(metav1.ConditionFalse))
+	})
+
+	It("should record the result of the last Job", func() {
+		ctx := context.Background()
+		repo := testRepo1
+		err := k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		job := batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testNS,
+				Name:      "test-repo1-job1",
+				Labels: map[string]string{
+					"app.kubernetes.io/name":       v1.OperatorName,
+					"app.kubernetes.io/instance":   repo.Name,
+					"app.kubernetes.io/created-by": controllers.ControllerName,
+				},
+			},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{{Name: "git", Image: v1.DefaultGitImage}},
+				}},
+			},
+		}
+		err = k8sClient.Create(ctx, &job)
+		Expect(err).NotTo(HaveOccurred())
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:               batchv1.JobFailed,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			Message:            "Job was active longer than specified deadline",
+		}}
+		err = k8sClient.Status().Update(ctx, &job)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() *v1.RunStatus {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return nil
+			}
+			return got.Status.LastRun
+		}).Should(And(
+			Not(BeNil()),
+			HaveField("JobName", job.Name),
+			HaveField("Result", v1.RunFailed),
+			HaveField("Reason", v1.FailureUnknown),
+		))
+
+		err = k8sClient.Delete(ctx, &job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should detect stale backups without Job events", func() {
+		ctx := context.Background()
+		repo := testRepo1
+		repo.Spec.MaxAge = &metav1.Duration{Duration: 5 * time.Second}
+		err := k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		getStale := func() metav1.ConditionStatus {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return ""
+			}
+			cond := meta.FindStatusCondition(got.Status.Conditions, v1.ConditionStale)
+			if cond == nil {
+				return ""
+			}
+			return cond.Status
+		}
+		Eventually(getStale).Should(Equal(metav1.ConditionFalse))
+
+		// the Repository becomes stale 5 seconds after the last success by RequeueAfter
+		Eventually(func() error {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return err
+			}
+			got.Status.LastSuccessTime = &metav1.Time{Time: time.Now()}
+			return k8sClient.Status().Update(ctx, &got)
+		}).Should(Succeed())
+		Consistently(getStale, 2*time.Second).Should(Equal(metav1.ConditionFalse))
+		Eventually(getStale, 6*time.Second).Should(Equal(metav1.ConditionTrue))
+	})
+
+	It("should notify failures and recoveries", func() {
+		ctx := context.Background()
+		events := make(chan string, 10)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				Event string `json:"event"`
+				Name  string `json:"name"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			events <- body.Event + " " + body.Name
+		}))
+		defer srv.Close()
+
+		notifier := v1beta1.Notifier{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNS, Name: "test-notifier1"},
+			Spec:       v1beta1.NotifierSpec{Webhook: &v1beta1.WebhookSink{URL: pointer.String(srv.URL)}},
+		}
+		err := k8sClient.Create(ctx, &notifier)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { Expect(k8sClient.Delete(ctx, &notifier)).To(Succeed()) }()
+
+		repo := testRepo1
+		repo.Spec.Notifications = &v1.NotificationsSpec{Notifiers: []corev1.LocalObjectReference{{Name: notifier.Name}}}
+		err = k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		finishJob := func(name string, condType batchv1.JobConditionType) {
+			job := batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: testNS,
+					Name:      name,
+					Labels: map[string]string{
+						"app.kubernetes.io/name":       v1.OperatorName,
+						"app.kubernetes.io/instance":   repo.Name,
+						"app.kubernetes.io/created-by": controllers.ControllerName,
+					},
+				},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						RestartPolicy: corev1.RestartPolicyNever,
+						Containers:    []corev1.Container{{Name: "git", Image: v1.DefaultGitImage}},
+					}},
+				},
+			}
+			err := k8sClient.Create(ctx, &job)
+			Expect(err).NotTo(HaveOccurred())
+			job.Status.Conditions = []batchv1.JobCondition{{Type: condType, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()}}
+			err = k8sClient.Status().Update(ctx, &job)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		finishJob("test-repo1-notify1", batchv1.JobFailed)
+		Eventually(events).Should(Receive(Equal("Failed " + repo.Name)))
+		Eventually(func() int32 {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return 0
+			}
+			return got.Status.ConsecutiveFailures
+		}).Should(Equal(int32(1)))
+
+		time.Sleep(time.Second) // finish the next Job later than the previous one
+		finishJob("test-repo1-notify2", batchv1.JobComplete)
+		Eventually(events).Should(Receive(Equal("Recovered " + repo.Name)))
+		Consistently(events).ShouldNot(Receive())
+
+		err = k8sClient.DeleteAllOf(ctx, &batchv1.Job{}, client.InNamespace(testNS), client.PropagationPolicy(metav1.DeletePropagationBackground))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should run dry-run Jobs", func() {
+		ctx := context.Background()
+		repo := testRepo1
+		repo.Spec.DryRun = pointer.Bool(true)
+		err := k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		cj := batchv1.CronJob{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedCronJobName()}, &cj)
+		}).Should(Succeed())
+		Expect(cj.Spec.JobTemplate.Labels).Should(HaveKeyWithValue(v1.DryRunLabel, "true"))
+		Expect(cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Command[2]).Should(ContainSubstring("git ls-remote --refs 'https://example.com/dst'"))
+		Expect(cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Command[2]).ShouldNot(ContainSubstring("git push"))
+
+		// request a one-off dry-run; retry on conflicts with the controller adding the finalizer
+		Eventually(func() error {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return err
+			}
+			got.Annotations = map[string]string{v1.DryRunAnnotation: "1"}
+			return k8sClient.Update(ctx, &got)
+		}).Should(Succeed())
+
+		var jobs batchv1.JobList
+		Eventually(func() int {
+			if err := k8sClient.List(ctx, &jobs, client.InNamespace(testNS), client.MatchingLabels{v1.DryRunLabel: "true"}); err != nil {
+				return 0
+			}
+			return len(jobs.Items)
+		}).Should(Equal(1))
+		job := jobs.Items[0]
+		Expect(job.OwnerReferences).Should(HaveLen(1))
+		Eventually(func() map[string]string {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return nil
+			}
+			return got.Annotations
+		}).ShouldNot(HaveKey(v1.DryRunAnnotation))
+
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:               batchv1.JobComplete,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+		}}
+		err = k8sClient.Status().Update(ctx, &job)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() *v1.RunStatus {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return nil
+			}
+			return got.Status.LastDryRun
+		}).Should(And(
+			Not(BeNil()),
+			HaveField("JobName", job.Name),
+			HaveField("Result", v1.RunSucceeded),
+		))
+		var got v1.Repository
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Status.LastRun).Should(BeNil())
+
+		err = k8sClient.Delete(ctx, &job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should record the refs digest for drift detection", func() {
+		ctx := context.Background()
+		repo := testRepo1
+		policy := v1.DriftFail
+		repo.Spec.OnDestinationDrift = &policy
+		err := k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		cj := batchv1.CronJob{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedCronJobName()}, &cj)
+		}).Should(Succeed())
+		Expect(cj.Spec.JobTemplate.Spec.Template.Spec.Volumes).Should(ContainElement(HaveField("Name", "state")))
+		Expect(cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Command[2]).Should(ContainSubstring("/state/refs-digest"))
+
+		// retry on conflicts with the controller updating the status
+		var got v1.Repository
+		Eventually(func() error {
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return err
+			}
+			got.Status.LastRun = &v1.RunStatus{JobName: "test-repo1-job1", Result: v1.RunSucceeded, RefsDigest: "abc"}
+			return k8sClient.Status().Update(ctx, &got)
+		}).Should(Succeed())
+
+		cm := corev1.ConfigMap{}
+		Eventually(func() map[string]string {
+			if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedStateConfigMapName()}, &cm); err != nil {
+				return nil
+			}
+			return cm.Data
+		}).Should(HaveKeyWithValue("refs-digest", "abc"))
+
+		// the digest is discarded when drift detection is disabled
+		Eventually(func() error {
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return err
+			}
+			got.Spec.OnDestinationDrift = nil
+			return k8sClient.Update(ctx, &got)
+		}).Should(Succeed())
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedStateConfigMapName()}, &corev1.ConfigMap{})
+			return apierrors.IsNotFound(err)
+		}).Should(BeTrue())
+	})
+
+	It("should clean up the destination on deletion", func() {
+		ctx := context.Background()
+		repo := testRepo1
+		policy := v1.DeletionDelete
+		repo.Spec.DeletionPolicy = &policy
+		err := k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() []string {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return nil
+			}
+			return got.Finalizers
+		}).Should(ContainElement(v1.CleanupFinalizer))
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedCronJobName()}, &batchv1.CronJob{})
+		}).Should(Succeed())
+
+		err = k8sClient.Delete(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		job := batchv1.Job{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedCleanupJobName()}, &job)
+		}).Should(Succeed())
+		Expect(job.Spec.Template.Spec.Containers[0].Command[2]).Should(ContainSubstring("git ls-remote --refs 'https://example.com/dst'"))
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedCronJobName()}, &batchv1.CronJob{})
+			return apierrors.IsNotFound(err)
+		}).Should(BeTrue())
+		Eventually(func() string {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return ""
+			}
+			cond := meta.FindStatusCondition(got.Status.Conditions, v1.ConditionCleanedUp)
+			if cond == nil {
+				return ""
+			}
+			return cond.Reason
+		}).Should(Equal("Running"))
+
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:               batchv1.JobComplete,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+		}}
+		err = k8sClient.Status().Update(ctx, &job)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &v1.Repository{})
+			return apierrors.IsNotFound(err)
+		}).Should(BeTrue())
+
+		err = k8sClient.Delete(ctx, &job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should wait for running backups before the cleanup", func() {
+		ctx := context.Background()
+		repo := testRepo1
+		policy := v1.DeletionDelete
+		repo.Spec.DeletionPolicy = &policy
+		err := k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() []string {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return nil
+			}
+			return got.Finalizers
+		}).Should(ContainElement(v1.CleanupFinalizer))
+
+		backup := batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testNS,
+				Name:      "test-repo1-running",
+				Labels: map[string]string{
+					"app.kubernetes.io/name":       v1.OperatorName,
+					"app.kubernetes.io/instance":   repo.Name,
+					"app.kubernetes.io/created-by": controllers.ControllerName,
+				},
+			},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers:    []corev1.Container{{Name: "git", Image: v1.DefaultGitImage}},
+				}},
+			},
+		}
+		err = k8sClient.Create(ctx, &backup)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = k8sClient.Delete(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+
+		// the running Job is deleted in the foreground and the cleanup waits for it
+		Eventually(func() []string {
+			var got batchv1.Job
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&backup), &got); err != nil {
+				return nil
+			}
+			return got.Finalizers
+		}).Should(ContainElement(metav1.FinalizerDeleteDependents))
+		Eventually(func() string {
+			var got v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &got); err != nil {
+				return ""
+			}
+			cond := meta.FindStatusCondition(got.Status.Conditions, v1.ConditionCleanedUp)
+			if cond == nil {
+				return ""
+			}
+			return cond.Reason
+		}).Should(Equal("WaitingForBackups"))
+		Consistently(func() bool {
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedCleanupJobName()}, &batchv1.Job{})
+			return apierrors.IsNotFound(err)
+		}).Should(BeTrue())
+
+		// envtest has no garbage collector, so remove the Job as it would
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(&backup), &backup)
+		Expect(err).NotTo(HaveOccurred())
+		backup.Finalizers = nil
+		err = k8sClient.Update(ctx, &backup)
+		Expect(err).NotTo(HaveOccurred())
+
+		job := batchv1.Job{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.GetOwnedCleanupJobName()}, &job)
+		}).Should(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:               batchv1.JobComplete,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+		}}
+		err = k8sClient.Status().Update(ctx, &job)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&repo), &v1.Repository{})
+			return apierrors.IsNotFound(err)
+		}).Should(BeTrue())
+
+		err = k8sClient.Delete(ctx, &job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should follow changes of referenced objects", func() {
+		ctx := context.Background()
+		getHash := func() string {
+			var cj batchv1.CronJob
+			if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: v1.OperatorName + "-" + testRepo2.Name}, &cj); err != nil {
+				return ""
+			}
+			return cj.Spec.JobTemplate.Spec.Template.Annotations[v1.ReferencesHashAnnotation]
+		}
+		getCondition := func() metav1.ConditionStatus {
+			var repo v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&testRepo2), &repo); err != nil {
+				return ""
+			}
+			cond := meta.FindStatusCondition(repo.Status.Conditions, v1.ConditionReferencesResolved)
+			if cond == nil {
+				return ""
+			}
+			return cond.Status
+		}
+
+		repo := testRepo2
+		err := k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(getHash).ShouldNot(BeEmpty())
+		Eventually(getCondition).Should(Equal(metav1.ConditionFalse))
+		hash1 := getHash()
+
+		for _, name := range []string{repo.Spec.ImagePullSecret.Name, repo.Spec.Source.Credentials.Name, repo.Spec.Destination.Credentials.Name} {
+			secret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: testNS, Name: name}, StringData: map[string]string{"key": "v1"}}
+			err = k8sClient.Create(ctx, &secret)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		cm := corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: testNS, Name: repo.Spec.GitConfig.Name}, Data: map[string]string{".gitconfig": ""}}
+		err = k8sClient.Create(ctx, &cm)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(getCondition).Should(Equal(metav1.ConditionTrue))
+		Eventually(getHash).ShouldNot(Equal(hash1))
+		hash2 := getHash()
+
+		var secret corev1.Secret
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: repo.Spec.Destination.Credentials.Name}, &secret)
+		Expect(err).NotTo(HaveOccurred())
+		secret.Data = map[string][]byte{"key": []byte("v2")}
+		err = k8sClient.Update(ctx, &secret)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(getHash).ShouldNot(Equal(hash2))
 	})
 })
 
 var (
-	testColl1 = v1beta1.Collection{
+	testColl1 = v1.Collection{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-coll1",
 			Namespace: testNS,
 		},
-		Spec: v1beta1.CollectionSpec{
+		Spec: v1.CollectionSpec{
 			Schedule:        "0 6 * * *",
 			TimeZone:        nil,
-			GitImage:        pointer.String(v1beta1.DefaultGitImage),
+			GitImage:        pointer.String(v1.DefaultGitImage),
 			ImagePullSecret: nil,
-			GitConfig: &corev1.LocalObjectReference{
-				Name: "gitbackup-collection-test-coll1-gitconfig",
-			},
-			GitCredentials: nil,
-			Repos: []v1beta1.CollectionRepoURL{
+			GitConfig:       nil,
+			Repos: []v1.CollectionRepo{
 				{
-					Name: pointer.String("foo"),
-					Src:  "http://example.com/src/foo",
-					Dst:  "http://example.com/dst/foo",
+					Name:        pointer.String("foo"),
+					Source:      v1.GitRemote{URL: "http://example.com/src/foo"},
+					Destination: v1.GitRemote{URL: "http://example.com/dst/foo"},
 				},
 				{
-					Name: pointer.String("bar"),
-					Src:  "http://example.com/src/barbarbar",
-					Dst:  "http://example.com/dst/barbarbar",
+					Name:        pointer.String("bar"),
+					Source:      v1.GitRemote{URL: "http://example.com/src/barbarbar"},
+					Destination: v1.GitRemote{URL: "http://example.com/dst/barbarbar"},
 				},
 				{
-					Name: nil,
-					Src:  "http://example.com/src/baz",
-					Dst:  "http://example.com/dst/bazbazbaz",
+					Name:        nil,
+					Source:      v1.GitRemote{URL: "http://example.com/src/baz"},
+					Destination: v1.GitRemote{URL: "http://example.com/dst/bazbazbaz"},
 				},
 			},
 		},
 	}
-	testColl2 = v1beta1.Collection{
+	testColl2 = v1.Collection{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-coll2",
 			Namespace: testNS,
 		},
-		Spec: v1beta1.CollectionSpec{
+		Spec: v1.CollectionSpec{
 			Schedule: "0 6 * * *",
 			TimeZone: pointer.String("Asia/Tokyo"),
-			GitImage: pointer.String(v1beta1.DefaultGitImage),
+			GitImage: pointer.String(v1.DefaultGitImage),
 			ImagePullSecret: &corev1.LocalObjectReference{
 				Name: "user-specified-image-pull-secret",
 			},
 			GitConfig: &corev1.LocalObjectReference{
 				Name: "user-created-cm",
 			},
-			GitCredentials: &corev1.LocalObjectReference{
+			SourceCredentials: &corev1.LocalObjectReference{
+				Name: "user-specified-git-secret",
+			},
+			DestinationCredentials: &corev1.LocalObjectReference{
 				Name: "user-specified-git-secret",
 			},
-			Repos: []v1beta1.CollectionRepoURL{
+			Repos: []v1.CollectionRepo{
 				{
-					Name: pointer.String("foo"),
-					Src:  "http://example.com/src/foo",
-					Dst:  "http://example.com/dst/foo",
+					Name:        pointer.String("foo"),
+					Source:      v1.GitRemote{URL: "http://example.com/src/foo"},
+					Destination: v1.GitRemote{URL: "http://example.com/dst/foo"},
 				},
 				{
-					Name: pointer.String("bar"),
-					Src:  "http://example.com/src/barbarbar",
-					Dst:  "http://example.com/dst/barbarbar",
+					Name:        pointer.String("bar"),
+					Source:      v1.GitRemote{URL: "http://example.com/src/barbarbar"},
+					Destination: v1.GitRemote{URL: "http://example.com/dst/barbarbar"},
 				},
 				{
-					Name: nil,
-					Src:  "http://example.com/src/baz",
-					Dst:  "http://example.com/dst/bazbazbaz",
+					Name:        nil,
+					Source:      v1.GitRemote{URL: "http://example.com/src/baz"},
+					Destination: v1.GitRemote{URL: "http://example.com/dst/bazbazbaz"},
 				},
 			},
 		},
 	}
-	testColl3 = v1beta1.Collection{
+	testColl3 = v1.Collection{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "test-coll3",
 			Namespace: testNS,
 		},
-		Spec: v1beta1.CollectionSpec{
+		Spec: v1.CollectionSpec{
 			Schedule:        "0 6 * * *",
 			TimeZone:        nil,
-			GitImage:        pointer.String(v1beta1.DefaultGitImage),
+			GitImage:        pointer.String(v1.DefaultGitImage),
 			ImagePullSecret: nil,
-			GitConfig: &corev1.LocalObjectReference{
-				Name: "gitbackup-collection-test-coll3-gitconfig",
-			},
-			GitCredentials: nil,
-			Repos:          []v1beta1.CollectionRepoURL{},
+			GitConfig:       nil,
+			Repos:           []v1.CollectionRepo{},
 		},
 	}
 )
@@ -313,22 +869,22 @@ var _ = Describe("Collection controller", func() {
 		cncl = cancel
 
 		var err error
-		err = k8sClient.DeleteAllOf(ctx, &v1beta1.Collection{}, client.InNamespace(testNS))
+		err = k8sClient.DeleteAllOf(ctx, &v1.Collection{}, client.InNamespace(testNS))
 		Expect(err).NotTo(HaveOccurred())
-		err = k8sClient.DeleteAllOf(ctx, &v1beta1.Repository{}, client.InNamespace(testNS))
+		err = k8sClient.DeleteAllOf(ctx, &v1.Repository{}, client.InNamespace(testNS))
 		Expect(err).NotTo(HaveOccurred())
 		err = k8sClient.DeleteAllOf(ctx, &batchv1.CronJob{}, client.InNamespace(testNS))
 		Expect(err).NotTo(HaveOccurred())
 		err = k8sClient.DeleteAllOf(ctx, &corev1.ConfigMap{}, client.InNamespace(testNS))
 		Expect(err).NotTo(HaveOccurred())
 		Eventually(func() int {
-			var objs v1beta1.CollectionList
+			var objs v1.CollectionList
 			err = k8sClient.List(ctx, &objs, client.InNamespace(testNS))
 			Expect(err).NotTo(HaveOccurred())
 			return len(objs.Items)
 		}).Should(Equal(0))
 		Eventually(func() int {
-			var objs v1beta1.RepositoryList
+			var objs v1.RepositoryList
 			err = k8sClient.List(ctx, &objs, client.InNamespace(testNS))
 			Expect(err).NotTo(HaveOccurred())
 			return len(objs.Items)
@@ -352,8 +908,9 @@ var _ = Describe("Collection controller", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		reconciler := controllers.CollectionReconciler{
-			Client: k8sClient,
-			Scheme: scheme.Scheme,
+			Client:   k8sClient,
+			Scheme:   scheme.Scheme,
+			Recorder: mgr.GetEventRecorderFor("collection-controller"),
 		}
 		err = reconciler.SetupWithManager(mgr)
 		Expect(err).NotTo(HaveOccurred())
@@ -381,12 +938,12 @@ var _ = Describe("Collection controller", func() {
 
 		cm := corev1.ConfigMap{}
 		Eventually(func() error {
-			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: coll.Spec.GitConfig.Name}, &cm)
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: coll.GetGitConfigName()}, &cm)
 		}).Should(Succeed())
 		Expect(cm.Data).Should(HaveKey(".gitconfig"))
 
 		for _, cr := range coll.GetOwnedRepositoryNames() {
-			var repo v1beta1.Repository
+			var repo v1.Repository
 			Eventually(func() error {
 				return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: cr}, &repo)
 			}).Should(Succeed())
@@ -403,15 +960,17 @@ var _ = Describe("Collection controller", func() {
 
 		cm := corev1.ConfigMap{}
 		Eventually(func() error {
-			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: coll.Spec.GitConfig.Name}, &cm)
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: coll.GetGitConfigName()}, &cm)
 		}).ShouldNot(Succeed())
 
 		for _, cr := range coll.GetOwnedRepositoryNames() {
-			var repo v1beta1.Repository
+			var repo v1.Repository
 			Eventually(func() error {
 				return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: cr}, &repo)
 			}).Should(Succeed())
 			Expect(len(repo.OwnerReferences)).To(Equal(1))
+			Expect(repo.Spec.Source.Credentials).To(Equal(coll.Spec.SourceCredentials))
+			Expect(repo.Spec.GitConfig).To(Equal(coll.Spec.GitConfig))
 		}
 	})
 
@@ -424,15 +983,441 @@ var _ = Describe("Collection controller", func() {
 
 		cm := corev1.ConfigMap{}
 		Eventually(func() error {
-			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: coll.Spec.GitConfig.Name}, &cm)
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: coll.GetGitConfigName()}, &cm)
 		}).Should(Succeed())
 		Expect(cm.Data).Should(HaveKey(".gitconfig"))
 
 		for _, cr := range coll.GetOwnedRepositoryNames() {
-			var repo v1beta1.Repository
+			var repo v1.Repository
 			Eventually(func() error {
 				return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: cr}, &repo)
 			}).ShouldNot(Succeed())
 		}
 	})
+	It("should orphan and adopt Repositories", func() {
+		ctx := context.Background()
+		orphan := v1.PruneOrphan
+		coll := testColl1
+		coll.Spec.PruneRemoved = &orphan
+		coll.Spec.Repos = []v1.CollectionRepo{
+			{Name: pointer.String("foo"), Source: v1.GitRemote{URL: "https://example.com/src/foo"}, Destination: v1.GitRemote{URL: "https://example.com/dst/foo"}},
+			{Name: pointer.String("bar"), Source: v1.GitRemote{URL: "https://example.com/src/bar"}, Destination: v1.GitRemote{URL: "https://example.com/dst/bar"}},
+		}
+		names := coll.GetOwnedRepositoryNames()
+
+		// an unowned Repository with the same name is adopted
+		unowned := testRepo1
+		unowned.Name = names[0]
+		err := k8sClient.Create(ctx, &unowned)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = k8sClient.Create(ctx, &coll)
+		Expect(err).NotTo(HaveOccurred())
+		isControlled := func(name string) func() bool {
+			return func() bool {
+				var repo v1.Repository
+				if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: name}, &repo); err != nil {
+					return false
+				}
+				return metav1.IsControlledBy(&repo, &coll)
+			}
+		}
+		for _, name := range names {
+			Eventually(isControlled(name)).Should(BeTrue())
+		}
+
+		// a removed Repository is orphaned; updates are retried on conflicts with the controller updating the status
+		removed := coll.Spec.Repos[1]
+		Eventually(func() error {
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&coll), &coll); err != nil {
+				return err
+			}
+			coll.Spec.Repos = coll.Spec.Repos[:1]
+			return k8sClient.Update(ctx, &coll)
+		}).Should(Succeed())
+		Eventually(isControlled(names[1])).Should(BeFalse())
+		var repo v1.Repository
+		err = k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: names[1]}, &repo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.OwnerReferences).Should(BeEmpty())
+		Expect(repo.Spec.GitConfig).Should(BeNil())
+
+		// and adopted again when it is added back
+		Eventually(func() error {
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&coll), &coll); err != nil {
+				return err
+			}
+			coll.Spec.Repos = append(coll.Spec.Repos, removed)
+			return k8sClient.Update(ctx, &coll)
+		}).Should(Succeed())
+		Eventually(isControlled(names[1])).Should(BeTrue())
+	})
+
+	It("should keep the fields of adopted Repositories that Collections do not manage", func() {
+		ctx := context.Background()
+		coll := testColl1
+		names := coll.GetOwnedRepositoryNames()
+
+		encryption := &v1.EncryptionSpec{
+			Type:       v1.EncryptionOpenPGP,
+			PublicKey:  corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "gpg"}, Key: "public.asc"},
+			PrivateKey: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "gpg"}, Key: "private.asc"},
+		}
+		unowned := testRepo1
+		unowned.Name = names[0]
+		unowned.Spec.Encryption = encryption
+		err := k8sClient.Create(ctx, &unowned)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = k8sClient.Create(ctx, &coll)
+		Expect(err).NotTo(HaveOccurred())
+
+		var repo v1.Repository
+		Eventually(func() bool {
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&unowned), &repo); err != nil {
+				return false
+			}
+			return metav1.IsControlledBy(&repo, &coll)
+		}).Should(BeTrue())
+		Expect(repo.Spec.Encryption).Should(Equal(encryption))
+		Expect(repo.Spec.Destination).Should(Equal(coll.GetDestination(coll.Spec.Repos[0])))
+	})
+
+	It("should not adopt Repositories of ClusterCollections", func() {
+		ctx := context.Background()
+		coll := testColl1
+		names := coll.GetOwnedRepositoryNames()
+
+		managed := testRepo1
+		managed.Name = names[0]
+		managed.Labels = map[string]string{v1beta1.ClusterCollectionLabel: "test-ccoll1"}
+		err := k8sClient.Create(ctx, &managed)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = k8sClient.Create(ctx, &coll)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() []string {
+			var events corev1.EventList
+			if err := k8sClient.List(ctx, &events, client.InNamespace(testNS)); err != nil {
+				return nil
+			}
+			var msgs []string
+			for _, e := range events.Items {
+				if e.InvolvedObject.Name == coll.Name && e.Reason == "AdoptionFailed" {
+					msgs = append(msgs, e.Message)
+				}
+			}
+			return msgs
+		}).Should(ContainElement("Repository " + names[0] + " is not adopted as it is managed by ClusterCollection test-ccoll1"))
+		Consistently(func() bool {
+			var repo v1.Repository
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&managed), &repo); err != nil {
+				return false
+			}
+			return len(repo.OwnerReferences) == 0 && repo.Spec.Source.URL == testRepo1.Spec.Source.URL
+		}).Should(BeTrue())
+	})
+
+	It("should count Repositories by the results of their last backups", func() {
+		ctx := context.Background()
+		coll := testColl1
+		err := k8sClient.Create(ctx, &coll)
+		Expect(err).NotTo(HaveOccurred())
+
+		getStatus := func() v1.CollectionStatus {
+			var got v1.Collection
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&coll), &got); err != nil {
+				return v1.CollectionStatus{}
+			}
+			return got.Status
+		}
+		Eventually(getStatus).Should(Equal(v1.CollectionStatus{Repos: 3}))
+
+		names := coll.GetOwnedRepositoryNames()
+		for i, result := range []v1.RunResult{v1.RunSucceeded, v1.RunFailed} {
+			var repo v1.Repository
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: names[i]}, &repo)
+			Expect(err).NotTo(HaveOccurred())
+			repo.Status.LastRun = &v1.RunStatus{JobName: "job1", Result: result}
+			err = k8sClient.Status().Update(ctx, &repo)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Eventually(getStatus).Should(Equal(v1.CollectionStatus{Repos: 3, Ready: 1, Failing: 1}))
+	})
+})
+
+var testRestore1 = v1beta1.Restore{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "test-restore1",
+		Namespace: testNS,
+	},
+	Spec: v1beta1.RestoreSpec{
+		Src:    pointer.String("http://example.com/dst/foo"),
+		Target: "http://example.com/target/foo",
+	},
+}
+
+var _ = Describe("Restore controller", func() {
+	var cncl context.CancelFunc
+
+	BeforeEach(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cncl = cancel
+
+		var err error
+		err = k8sClient.DeleteAllOf(ctx, &v1beta1.Restore{}, client.InNamespace(testNS))
+		Expect(err).NotTo(HaveOccurred())
+		err = k8sClient.DeleteAllOf(ctx, &batchv1.Job{}, client.InNamespace(testNS), client.PropagationPolicy(metav1.DeletePropagationBackground))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int {
+			var objs v1beta1.RestoreList
+			err = k8sClient.List(ctx, &objs, client.InNamespace(testNS))
+			Expect(err).NotTo(HaveOccurred())
+			return len(objs.Items)
+		}).Should(Equal(0))
+		Eventually(func() int {
+			var objs batchv1.JobList
+			err = k8sClient.List(ctx, &objs, client.InNamespace(testNS))
+			Expect(err).NotTo(HaveOccurred())
+			return len(objs.Items)
+		}).Should(Equal(0))
+
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme: scheme.Scheme,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciler := controllers.RestoreReconciler{
+			Client:    k8sClient,
+			Scheme:    scheme.Scheme,
+			APIReader: k8sClient,
+		}
+		err = reconciler.SetupWithManager(mgr)
+		Expect(err).NotTo(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		wait()
+	})
+
+	AfterEach(func() {
+		cncl() // stop the mgr
+		wait()
+	})
+
+	It("should create a Job and follow its status", func() {
+		rst := testRestore1
+		ctx := context.Background()
+
+		err := k8sClient.Create(ctx, &rst)
+		Expect(err).NotTo(HaveOccurred())
+
+		job := batchv1.Job{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: rst.GetOwnedJobName()}, &job)
+		}).Should(Succeed())
+		Eventually(func() v1beta1.RestorePhase {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&rst), &rst)
+			Expect(err).NotTo(HaveOccurred())
+			return rst.Status.Phase
+		}).Should(Equal(v1beta1.RestorePending))
+
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+			Type:   batchv1.JobComplete,
+			Status: corev1.ConditionTrue,
+		})
+		err = k8sClient.Status().Update(ctx, &job)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() v1beta1.RestorePhase {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&rst), &rst)
+			Expect(err).NotTo(HaveOccurred())
+			return rst.Status.Phase
+		}).Should(Equal(v1beta1.RestoreSucceeded))
+	})
+
+	It("should apply the pod options of the Repository to the Job", func() {
+		ctx := context.Background()
+		repo := *testRepo1.DeepCopy()
+		repo.Name = "test-restore-repo"
+		repo.Spec.NodeSelector = map[string]string{"disktype": "ssd"}
+		repo.Spec.JobPolicy = &v1.JobPolicy{Retry: &v1.RetryPolicy{Attempts: pointer.Int32(5)}}
+		err := k8sClient.Create(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, &repo)).To(Succeed())
+		}()
+
+		rst := testRestore1
+		rst.Spec.Src = nil
+		rst.Spec.Repository = &corev1.LocalObjectReference{Name: repo.Name}
+		err = k8sClient.Create(ctx, &rst)
+		Expect(err).NotTo(HaveOccurred())
+
+		job := batchv1.Job{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: testNS, Name: rst.GetOwnedJobName()}, &job)
+		}).Should(Succeed())
+		Expect(job.Spec.Template.Spec.NodeSelector).To(Equal(repo.Spec.NodeSelector))
+		Expect(job.Spec.Template.Spec.Containers[0].Command).To(ContainElement(ContainSubstring("[ $n -ge 5 ]")))
+	})
+})
+
+var _ = Describe("ClusterCollection controller", func() {
+	var cncl context.CancelFunc
+
+	BeforeEach(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cncl = cancel
+
+		for _, name := range []string{"test-ccoll-ns1", "test-ccoll-ns2"} {
+			ns := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"team": name}}}
+			err := k8sClient.Create(ctx, &ns)
+			Expect(client.IgnoreAlreadyExists(err)).NotTo(HaveOccurred())
+		}
+
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme: scheme.Scheme,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		reconciler := controllers.ClusterCollectionReconciler{
+			Client: k8sClient,
+			Scheme: scheme.Scheme,
+		}
+		err = reconciler.SetupWithManager(mgr)
+		Expect(err).NotTo(HaveOccurred())
+
+		go func() {
+			err := mgr.Start(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		wait()
+	})
+
+	AfterEach(func() {
+		cncl() // stop the mgr
+		wait()
+	})
+
+	It("should create and delete Repositories across namespaces", func() {
+		ctx := context.Background()
+		coll := v1beta1.ClusterCollection{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ccoll1"},
+			Spec: v1beta1.ClusterCollectionSpec{
+				Schedule: "0 6 * * *",
+				Repos: []v1beta1.ClusterCollectionRepo{
+					{
+						CollectionRepoURL: v1beta1.CollectionRepoURL{Name: pointer.String("foo"), Src: "http://example.com/src/foo", Dst: "http://example.com/$(NAMESPACE)/foo"},
+						Namespaces:        []string{"test-ccoll-ns1"},
+					},
+					{
+						CollectionRepoURL: v1beta1.CollectionRepoURL{Name: pointer.String("bar"), Src: "http://example.com/src/bar", Dst: "http://example.com/$(NAMESPACE)/bar"},
+						NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "test-ccoll-ns2"}},
+					},
+				},
+			},
+		}
+		err := k8sClient.Create(ctx, &coll)
+		Expect(err).NotTo(HaveOccurred())
+
+		repo := v1.Repository{}
+		// the first Repository in a namespace may take a while to be created
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: "test-ccoll-ns1", Name: "test-ccoll1-foo"}, &repo)
+		}, 5*time.Second).Should(Succeed())
+		Expect(repo.Spec.Destination.URL).Should(Equal("http://example.com/test-ccoll-ns1/foo"))
+		Expect(repo.Labels).Should(HaveKeyWithValue(v1beta1.ClusterCollectionLabel, coll.Name))
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: "test-ccoll-ns2", Name: "test-ccoll1-bar"}, &repo)
+		}).Should(Succeed())
+		Expect(repo.Spec.Schedule).Should(Equal("1 6 * * *"))
+
+		getStatus := func() v1beta1.ClusterCollectionStatus {
+			var got v1beta1.ClusterCollection
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&coll), &got); err != nil {
+				return v1beta1.ClusterCollectionStatus{}
+			}
+			return got.Status
+		}
+		Eventually(func() int32 { return getStatus().Failing }).Should(Equal(int32(0)))
+		Eventually(func() int32 { return getStatus().Repos }).Should(Equal(int32(2)))
+		repo.Status.LastRun = &v1.RunStatus{JobName: "job1", Result: v1.RunFailed}
+		err = k8sClient.Status().Update(ctx, &repo)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int32 { return getStatus().Failing }).Should(Equal(int32(1)))
+		status := getStatus()
+		Expect(status.Ready).Should(Equal(int32(0)))
+		Expect(meta.IsStatusConditionTrue(status.Conditions, v1beta1.ConditionReposReconciled)).Should(BeTrue())
+
+		err = k8sClient.Get(ctx, client.ObjectKeyFromObject(&coll), &coll)
+		Expect(err).NotTo(HaveOccurred())
+		coll.Spec.Repos = coll.Spec.Repos[1:]
+		err = k8sClient.Update(ctx, &coll)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: "test-ccoll-ns1", Name: "test-ccoll1-foo"}, &repo)
+		}).ShouldNot(Succeed())
+
+		err = k8sClient.Delete(ctx, &coll)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Namespace: "test-ccoll-ns2", Name: "test-ccoll1-bar"}, &repo)
+		}).ShouldNot(Succeed())
+		// the finalizer is removed after the Repositories are deleted
+		Eventually(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(&coll), &coll))
+		}).Should(BeTrue())
+	})
+
+	It("should report Repositories that cannot be reconciled", func() {
+		ctx := context.Background()
+		coll := v1beta1.ClusterCollection{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-ccoll2"},
+			Spec: v1beta1.ClusterCollectionSpec{
+				Schedule: "0 6 * * *",
+				Repos: []v1beta1.ClusterCollectionRepo{
+					{
+						CollectionRepoURL: v1beta1.CollectionRepoURL{Name: pointer.String("foo"), Src: "http://example.com/src/foo", Dst: "http://example.com/$(NAMESPACE)/foo"},
+						Namespaces:        []string{"test-ccoll-ns1", "test-ccoll-ns2"},
+					},
+				},
+			},
+		}
+		// a Repository with the same name that is not managed by the ClusterCollection
+		other := testRepo1
+		other.Namespace = "test-ccoll-ns1"
+		other.Name = "test-ccoll2-foo"
+		err := k8sClient.Create(ctx, &other)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = k8sClient.Create(ctx, &coll)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() *metav1.Condition {
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(&coll), &coll); err != nil {
+				return nil
+			}
+			return meta.FindStatusCondition(coll.Status.Conditions, v1beta1.ConditionReposReconciled)
+		}, 5*time.Second).Should(And(
+			HaveField("Status", metav1.ConditionFalse),
+			HaveField("Message", ContainSubstring("Repository test-ccoll-ns1/test-ccoll2-foo is not managed by ClusterCollection test-ccoll2")),
+		))
+		Expect(coll.Status.Repos).Should(Equal(int32(1)))
+
+		err = k8sClient.Delete(ctx, &coll)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(&coll), &coll))
+		}).Should(BeTrue())
+		err = k8sClient.Delete(ctx, &other)
+		Expect(err).NotTo(HaveOccurred())
+	})
 })
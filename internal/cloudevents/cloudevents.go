@@ -0,0 +1,158 @@
+// Package cloudevents publishes CloudEvents of backups and Repositories to an HTTP sink in binary content mode.
+// See https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/http-protocol-binding.md
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Types of the events.
+const (
+	BackupStarted     = "com.ebiiim.gitbackup.backup.started"
+	BackupSucceeded   = "com.ebiiim.gitbackup.backup.succeeded"
+	BackupFailed      = "com.ebiiim.gitbackup.backup.failed"
+	RepositoryCreated = "com.ebiiim.gitbackup.repository.created"
+	RepositoryDeleted = "com.ebiiim.gitbackup.repository.deleted"
+)
+
+var log = logf.Log.WithName("cloudevents")
+
+const (
+	specVersion = "1.0"
+	// queueSize is the number of events that can wait to be sent. Events are dropped if the queue is full.
+	queueSize = 1000
+)
+
+// Event is a CloudEvent. Data is sent as JSON.
+type Event struct {
+	// ID identifies the event with Source. Events with the same ID and Source are duplicates.
+	ID      string
+	Source  string
+	Type    string
+	Subject string
+	Time    time.Time
+	Data    any
+}
+
+// Publisher sends events in the order they are published with retries.
+// A nil Publisher discards events so that callers do not need to test if CloudEvents are enabled.
+type Publisher struct {
+	// SinkURL specifies the URL to POST events to.
+	SinkURL string
+	// HTTPClient is used to send requests. (default: http.DefaultClient)
+	HTTPClient *http.Client
+	// Attempts specifies the number of attempts to send each event.
+	Attempts int
+	// InitialDelay and MaxDelay specify the delays between attempts, doubled on each retry.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+
+	queue chan Event
+}
+
+// NewPublisher returns a Publisher that sends events to sinkURL with the default retry settings.
+func NewPublisher(sinkURL string) *Publisher {
+	return &Publisher{
+		SinkURL:      sinkURL,
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		Attempts:     5,
+		InitialDelay: time.Second,
+		MaxDelay:     30 * time.Second,
+		queue:        make(chan Event, queueSize),
+	}
+}
+
+// Publish queues e to be sent by Start without blocking.
+func (p *Publisher) Publish(e Event) {
+	if p == nil {
+		return
+	}
+	select {
+	case p.queue <- e:
+	default:
+		log.Info("queue is full; event dropped", "type", e.Type, "id", e.ID)
+	}
+}
+
+// Start sends the queued events until ctx is done. It implements manager.Runnable.
+func (p *Publisher) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-p.queue:
+			if err := p.Send(ctx, e); err != nil {
+				log.Error(err, "unable to send event", "type", e.Type, "id", e.ID)
+			}
+		}
+	}
+}
+
+// Send sends e and retries with exponential backoff on errors, 429 and 5xx.
+func (p *Publisher) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	delay := p.InitialDelay
+	for i := 1; ; i++ {
+		retry, err := p.send(ctx, e, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || i >= p.Attempts {
+			return fmt.Errorf("attempt %d: %w", i, err)
+		}
+		log.Info("retry sending event", "type", e.Type, "id", e.ID, "attempt", i, "error", err.Error())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+}
+
+// send sends e once and returns true if it should be retried on error.
+func (p *Publisher) send(ctx context.Context, e Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.SinkURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("ce-specversion", specVersion)
+	req.Header.Set("ce-id", e.ID)
+	req.Header.Set("ce-source", e.Source)
+	req.Header.Set("ce-type", e.Type)
+	if e.Subject != "" {
+		req.Header.Set("ce-subject", e.Subject)
+	}
+	if !e.Time.IsZero() {
+		req.Header.Set("ce-time", e.Time.UTC().Format(time.RFC3339Nano))
+	}
+	c := p.HTTPClient
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+	return retry, fmt.Errorf("POST %s: unexpected status %s", p.SinkURL, resp.Status)
+}
@@ -0,0 +1,107 @@
+package cloudevents_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/gitbackup/internal/cloudevents"
+)
+
+var testEvent = cloudevents.Event{
+	ID:      "uid1/succeeded",
+	Source:  "/apis/gitbackup.ebiiim.com/v1/namespaces/default/repositories/repo1",
+	Type:    cloudevents.BackupSucceeded,
+	Subject: "job1",
+	Time:    time.Date(2023, 1, 2, 6, 0, 12, 0, time.UTC),
+	Data:    map[string]string{"name": "repo1"},
+}
+
+func TestPublisher_Send(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantRequests int32
+		wantErr      bool
+	}{
+		{"ok", []int{http.StatusAccepted}, 1, false},
+		{"retry 5xx", []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK}, 3, false},
+		{"retry 429", []int{http.StatusTooManyRequests, http.StatusOK}, 2, false},
+		{"give up", []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, 3, true},
+		{"no retry 4xx", []int{http.StatusBadRequest, http.StatusOK}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := atomic.AddInt32(&n, 1)
+				b, _ := io.ReadAll(r.Body)
+				for k, want := range map[string]string{
+					"Content-Type":   "application/json",
+					"ce-specversion": "1.0",
+					"ce-id":          testEvent.ID,
+					"ce-source":      testEvent.Source,
+					"ce-type":        "com.ebiiim.gitbackup.backup.succeeded",
+					"ce-subject":     "job1",
+					"ce-time":        "2023-01-02T06:00:12Z",
+				} {
+					if got := r.Header.Get(k); got != want {
+						t.Errorf("header %s = %q, want %q", k, got, want)
+					}
+				}
+				if string(b) != `{"name":"repo1"}` {
+					t.Errorf("body = %s", b)
+				}
+				w.WriteHeader(tt.statuses[i-1])
+			}))
+			defer srv.Close()
+
+			p := cloudevents.NewPublisher(srv.URL)
+			p.Attempts = 3
+			p.InitialDelay = time.Millisecond
+			err := p.Send(context.Background(), testEvent)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(&n); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestPublisher_Start(t *testing.T) {
+	ids := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids <- r.Header.Get("ce-id")
+	}))
+	defer srv.Close()
+
+	p := cloudevents.NewPublisher(srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = p.Start(ctx) }()
+
+	e1, e2 := testEvent, testEvent
+	e1.ID, e2.ID = "id1", "id2"
+	p.Publish(e1)
+	p.Publish(e2)
+	for _, want := range []string{"id1", "id2"} {
+		select {
+		case got := <-ids:
+			if got != want {
+				t.Errorf("ce-id = %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+
+	// a nil Publisher discards events
+	var nilPublisher *cloudevents.Publisher
+	nilPublisher.Publish(testEvent)
+}
@@ -0,0 +1,331 @@
+// Package forge exports metadata (issues, pull requests, releases, etc.) of a repository via forge APIs.
+// It also archives and deletes repositories when Repositories are deleted.
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Kind is the type of a forge. The values are the same as v1beta1.ForgeType.
+type Kind string
+
+const (
+	GitHub Kind = "GitHub"
+	GitLab Kind = "GitLab"
+	Gitea  Kind = "Gitea"
+)
+
+// Exporter exports metadata of a project into a directory.
+type Exporter struct {
+	// Kind specifies the type of the forge.
+	Kind Kind
+	// APIURL specifies the base URL of the forge API e.g. "https://api.github.com".
+	APIURL string
+	// Project specifies the path of the project e.g. "owner/name".
+	Project string
+	// Token specifies the API token. Anonymous access if empty.
+	Token string
+	// HTTPClient is used to send requests. (default: http.DefaultClient)
+	HTTPClient *http.Client
+}
+
+// resource is a list endpoint of a forge API that is saved as a JSON file.
+type resource struct {
+	file string
+	path string
+}
+
+func (e *Exporter) resources() ([]resource, error) {
+	switch e.Kind {
+	case GitHub:
+		p := "/repos/" + e.Project
+		return []resource{
+			{"issues.json", p + "/issues?state=all"},
+			{"pulls.json", p + "/pulls?state=all"},
+			{"comments.json", p + "/issues/comments"},
+			{"review_comments.json", p + "/pulls/comments"},
+			{"labels.json", p + "/labels"},
+			{"milestones.json", p + "/milestones?state=all"},
+			{"releases.json", p + "/releases"},
+		}, nil
+	case GitLab:
+		p := "/projects/" + url.PathEscape(e.Project)
+		return []resource{
+			{"issues.json", p + "/issues?scope=all"},
+			{"pulls.json", p + "/merge_requests?state=all&scope=all"},
+			{"labels.json", p + "/labels"},
+			{"milestones.json", p + "/milestones"},
+			{"releases.json", p + "/releases"},
+		}, nil
+	case Gitea:
+		p := "/repos/" + e.Project
+		return []resource{
+			{"issues.json", p + "/issues?state=all&type=issues"},
+			{"pulls.json", p + "/pulls?state=all"},
+			{"comments.json", p + "/issues/comments"},
+			{"labels.json", p + "/labels"},
+			{"milestones.json", p + "/milestones?state=all"},
+			{"releases.json", p + "/releases"},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown forge %s", e.Kind)
+}
+
+// Export saves metadata into dir as JSON files and release assets into dir/releases/{tag}/.
+func (e *Exporter) Export(ctx context.Context, dir string) error {
+	rs, err := e.resources()
+	if err != nil {
+		return err
+	}
+	items := make(map[string][]json.RawMessage, len(rs))
+	for _, r := range rs {
+		v, err := e.list(ctx, r.path)
+		if err != nil {
+			return fmt.Errorf("unable to export %s: %w", r.file, err)
+		}
+		items[r.file] = v
+	}
+
+	// GitLab has no endpoint to list all notes in a project
+	if e.Kind == GitLab {
+		var notes []json.RawMessage
+		for _, r := range []struct{ file, kind string }{{"issues.json", "issues"}, {"pulls.json", "merge_requests"}} {
+			for _, raw := range items[r.file] {
+				var v struct {
+					IID int `json:"iid"`
+				}
+				if err := json.Unmarshal(raw, &v); err != nil {
+					return err
+				}
+				path := fmt.Sprintf("/projects/%s/%s/%d/notes", url.PathEscape(e.Project), r.kind, v.IID)
+				ns, err := e.list(ctx, path)
+				if err != nil {
+					return fmt.Errorf("unable to export comments.json: %w", err)
+				}
+				notes = append(notes, ns...)
+			}
+		}
+		items["comments.json"] = notes
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for file, v := range items {
+		if v == nil {
+			v = []json.RawMessage{}
+		}
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), b, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return e.exportAssets(ctx, dir, items["releases.json"])
+}
+
+type asset struct {
+	tag  string
+	name string
+	url  string
+}
+
+func (e *Exporter) assets(releases []json.RawMessage) ([]asset, error) {
+	var as []asset
+	for _, raw := range releases {
+		var v struct {
+			TagName string          `json:"tag_name"`
+			Assets  json.RawMessage `json:"assets"`
+		}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		switch e.Kind {
+		case GitHub:
+			var vs []struct {
+				Name string `json:"name"`
+				URL  string `json:"url"`
+			}
+			if err := json.Unmarshal(v.Assets, &vs); err != nil {
+				return nil, err
+			}
+			for _, a := range vs {
+				as = append(as, asset{v.TagName, a.Name, a.URL})
+			}
+		case GitLab:
+			var vs struct {
+				Links []struct {
+					Name string `json:"name"`
+					URL  string `json:"url"`
+				} `json:"links"`
+			}
+			if err := json.Unmarshal(v.Assets, &vs); err != nil {
+				return nil, err
+			}
+			for _, a := range vs.Links {
+				as = append(as, asset{v.TagName, a.Name, a.URL})
+			}
+		case Gitea:
+			var vs []struct {
+				Name string `json:"name"`
+				URL  string `json:"browser_download_url"`
+			}
+			if err := json.Unmarshal(v.Assets, &vs); err != nil {
+				return nil, err
+			}
+			for _, a := range vs {
+				as = append(as, asset{v.TagName, a.Name, a.URL})
+			}
+		}
+	}
+	return as, nil
+}
+
+func (e *Exporter) exportAssets(ctx context.Context, dir string, releases []json.RawMessage) error {
+	as, err := e.assets(releases)
+	if err != nil {
+		return fmt.Errorf("unable to parse releases: %w", err)
+	}
+	for _, a := range as {
+		// tag and asset names come from the forge so do not let them escape dir
+		d := filepath.Join(dir, "releases", safeName(a.tag))
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+		if err := e.download(ctx, a.url, filepath.Join(d, safeName(a.name))); err != nil {
+			return fmt.Errorf("unable to download asset %s of %s: %w", a.name, a.tag, err)
+		}
+	}
+	return nil
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._+-]`)
+
+func safeName(s string) string {
+	s = unsafeChars.ReplaceAllString(s, "_")
+	if s == "" || s == "." || s == ".." {
+		return "_" + s
+	}
+	return s
+}
+
+func (e *Exporter) client() *http.Client {
+	if e.HTTPClient != nil {
+		return e.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (e *Exporter) newRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	// do not send the token to other hosts e.g. external links of release assets
+	if e.Token == "" || !sameHost(u, e.APIURL) {
+		return req, nil
+	}
+	switch e.Kind {
+	case GitHub:
+		req.Header.Set("Authorization", "Bearer "+e.Token)
+	case GitLab:
+		req.Header.Set("PRIVATE-TOKEN", e.Token)
+	case Gitea:
+		req.Header.Set("Authorization", "token "+e.Token)
+	}
+	return req, nil
+}
+
+// list gets all pages of a list endpoint by following "Link: <...>; rel=next" headers.
+func (e *Exporter) list(ctx context.Context, path string) ([]json.RawMessage, error) {
+	u := strings.TrimSuffix(e.APIURL, "/") + path
+	if strings.Contains(path, "?") {
+		u += "&per_page=100"
+	} else {
+		u += "?per_page=100"
+	}
+
+	var all []json.RawMessage
+	for u != "" {
+		req, err := e.newRequest(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		resp, err := e.client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page []json.RawMessage
+		err = decodeResponse(resp, &page)
+		if err != nil {
+			return nil, fmt.Errorf("GET %s: %w", u, err)
+		}
+		all = append(all, page...)
+		u = nextLink(resp.Header.Get("Link"))
+	}
+	return all, nil
+}
+
+func decodeResponse(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (e *Exporter) download(ctx context.Context, u, file string) error {
+	req, err := e.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	// GitHub returns the asset itself instead of its JSON representation
+	req.Header.Set("Accept", "application/octet-stream")
+	resp, err := e.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && ua.Host == ub.Host
+}
+
+var linkNext = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="next"`)
+
+// nextLink returns the URL of the next page in a Link header or "" if there is no next page.
+func nextLink(link string) string {
+	m := linkNext.FindStringSubmatch(link)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
@@ -0,0 +1,161 @@
+package forge_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ebiiim/gitbackup/internal/forge"
+)
+
+// fakeForge serves JSON bodies by request path (without query) and checks the auth header.
+type fakeForge struct {
+	t          *testing.T
+	authHeader string
+	authValue  string
+	pages      map[string][]string // path -> bodies of pages
+}
+
+func (f *fakeForge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.Header.Get(f.authHeader); got != f.authValue {
+		f.t.Errorf("%s %s = %q, want %q", r.URL.Path, f.authHeader, got, f.authValue)
+	}
+	if r.URL.Query().Get("per_page") == "" && r.Header.Get("Accept") == "application/json" {
+		f.t.Errorf("%s per_page is not set", r.URL.Path)
+	}
+	pages, ok := f.pages[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	page := 0
+	if p := r.URL.Query().Get("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if page+1 < len(pages) {
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?per_page=100&page=%d>; rel="next"`, r.Host, r.URL.Path, page+1))
+	}
+	fmt.Fprint(w, pages[page])
+}
+
+func readJSONArray(t *testing.T, file string) []map[string]any {
+	t.Helper()
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v []map[string]any
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestExporter_Export(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      forge.Kind
+		header    string
+		value     string
+		pages     map[string][]string
+		wantFiles map[string]int // file -> number of items
+		wantAsset string
+	}{
+		{
+			"GitHub", forge.GitHub, "Authorization", "Bearer tok",
+			map[string][]string{
+				"/repos/o/r/issues":          {`[{"number":1},{"number":2}]`, `[{"number":3}]`},
+				"/repos/o/r/pulls":           {`[{"number":2}]`},
+				"/repos/o/r/issues/comments": {`[{"id":10}]`},
+				"/repos/o/r/pulls/comments":  {`[]`},
+				"/repos/o/r/labels":          {`[{"name":"bug"}]`},
+				"/repos/o/r/milestones":      {`[]`},
+				"/repos/o/r/releases":        {`[{"tag_name":"v1","assets":[{"name":"a.tgz","url":"%s/assets/1"}]}]`},
+				"/assets/1":                  {`asset-body`},
+			},
+			map[string]int{"issues.json": 3, "pulls.json": 1, "comments.json": 1, "review_comments.json": 0, "labels.json": 1, "milestones.json": 0, "releases.json": 1},
+			"releases/v1/a.tgz",
+		},
+		{
+			"GitLab", forge.GitLab, "PRIVATE-TOKEN", "tok",
+			map[string][]string{
+				"/projects/o/r/issues":                 {`[{"iid":1}]`},
+				"/projects/o/r/merge_requests":         {`[{"iid":2}]`},
+				"/projects/o/r/issues/1/notes":         {`[{"id":10,"noteable_iid":1}]`, `[{"id":11,"noteable_iid":1}]`},
+				"/projects/o/r/merge_requests/2/notes": {`[{"id":12,"noteable_iid":2}]`},
+				"/projects/o/r/labels":                 {`[]`},
+				"/projects/o/r/milestones":             {`[{"id":1}]`},
+				"/projects/o/r/releases":               {`[{"tag_name":"v1","assets":{"links":[{"name":"a.tgz","url":"%s/assets/1"}]}}]`},
+				"/assets/1":                            {`asset-body`},
+			},
+			map[string]int{"issues.json": 1, "pulls.json": 1, "comments.json": 3, "labels.json": 0, "milestones.json": 1, "releases.json": 1},
+			"releases/v1/a.tgz",
+		},
+		{
+			"Gitea", forge.Gitea, "Authorization", "token tok",
+			map[string][]string{
+				"/repos/o/r/issues":          {`[{"number":1}]`},
+				"/repos/o/r/pulls":           {`[{"number":2}]`},
+				"/repos/o/r/issues/comments": {`[{"id":10},{"id":11}]`},
+				"/repos/o/r/labels":          {`[]`},
+				"/repos/o/r/milestones":      {`[]`},
+				"/repos/o/r/releases":        {`[{"tag_name":"../v1","assets":[{"name":"a.tgz","browser_download_url":"%s/assets/1"}]}]`},
+				"/assets/1":                  {`asset-body`},
+			},
+			map[string]int{"issues.json": 1, "pulls.json": 1, "comments.json": 2, "labels.json": 0, "milestones.json": 0, "releases.json": 1},
+			"releases/.._v1/a.tgz",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeForge{t: t, authHeader: tt.header, authValue: tt.value, pages: tt.pages}
+			srv := httptest.NewServer(f)
+			defer srv.Close()
+			for k, v := range f.pages {
+				for i := range v {
+					if k == "/repos/o/r/releases" || k == "/projects/o/r/releases" {
+						f.pages[k][i] = fmt.Sprintf(v[i], srv.URL)
+					}
+				}
+			}
+
+			dir := t.TempDir()
+			e := &forge.Exporter{Kind: tt.kind, APIURL: srv.URL, Project: "o/r", Token: "tok"}
+			if err := e.Export(context.Background(), dir); err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+
+			for file, n := range tt.wantFiles {
+				if got := len(readJSONArray(t, filepath.Join(dir, file))); got != n {
+					t.Errorf("len(%s) = %d, want %d", file, got, n)
+				}
+			}
+			b, err := os.ReadFile(filepath.Join(dir, tt.wantAsset))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "asset-body" {
+				t.Errorf("asset = %q, want %q", b, "asset-body")
+			}
+		})
+	}
+}
+
+func TestExporter_Export_Error(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	e := &forge.Exporter{Kind: forge.GitHub, APIURL: srv.URL, Project: "o/r"}
+	if err := e.Export(context.Background(), t.TempDir()); err == nil {
+		t.Errorf("Export() error = nil, want error")
+	}
+	e = &forge.Exporter{Kind: "Unknown", APIURL: srv.URL, Project: "o/r"}
+	if err := e.Export(context.Background(), t.TempDir()); err == nil {
+		t.Errorf("Export() error = nil, want error")
+	}
+}
@@ -0,0 +1,66 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Archive makes the project read-only.
+//
+//	GitHub, Gitea: PATCH /repos/{owner}/{repo} with {"archived":true}
+//	GitLab:        POST /projects/{id}/archive
+func (e *Exporter) Archive(ctx context.Context) error {
+	switch e.Kind {
+	case GitHub, Gitea:
+		return e.do(ctx, http.MethodPatch, "/repos/"+e.Project, `{"archived":true}`, false)
+	case GitLab:
+		return e.do(ctx, http.MethodPost, "/projects/"+url.PathEscape(e.Project)+"/archive", "", false)
+	}
+	return fmt.Errorf("unknown forge %s", e.Kind)
+}
+
+// Delete deletes the project. It succeeds if the project does not exist.
+//
+//	GitHub, Gitea: DELETE /repos/{owner}/{repo}
+//	GitLab:        DELETE /projects/{id}
+func (e *Exporter) Delete(ctx context.Context) error {
+	switch e.Kind {
+	case GitHub, Gitea:
+		return e.do(ctx, http.MethodDelete, "/repos/"+e.Project, "", true)
+	case GitLab:
+		return e.do(ctx, http.MethodDelete, "/projects/"+url.PathEscape(e.Project), "", true)
+	}
+	return fmt.Errorf("unknown forge %s", e.Kind)
+}
+
+// do sends a request with the JSON body (no body if empty) and tests if the response is 2xx.
+// 404 is also accepted if notFoundOK.
+func (e *Exporter) do(ctx context.Context, method, path, body string, notFoundOK bool) error {
+	u := strings.TrimSuffix(e.APIURL, "/") + path
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := e.newRequest(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := e.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 || (notFoundOK && resp.StatusCode == http.StatusNotFound) {
+		return nil
+	}
+	return fmt.Errorf("%s %s: unexpected status %s", method, u, resp.Status)
+}
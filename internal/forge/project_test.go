@@ -0,0 +1,60 @@
+package forge_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ebiiim/gitbackup/internal/forge"
+)
+
+func TestExporter_ArchiveDelete(t *testing.T) {
+	tests := []struct {
+		name       string
+		kind       forge.Kind
+		archive    bool
+		status     int
+		wantMethod string
+		wantPath   string
+		wantBody   string
+		wantErr    bool
+	}{
+		{"GitHub archive", forge.GitHub, true, http.StatusOK, http.MethodPatch, "/repos/o/r", `{"archived":true}`, false},
+		{"GitHub delete", forge.GitHub, false, http.StatusNoContent, http.MethodDelete, "/repos/o/r", "", false},
+		{"GitHub delete not found", forge.GitHub, false, http.StatusNotFound, http.MethodDelete, "/repos/o/r", "", false},
+		{"GitHub archive not found", forge.GitHub, true, http.StatusNotFound, http.MethodPatch, "/repos/o/r", `{"archived":true}`, true},
+		{"GitHub delete forbidden", forge.GitHub, false, http.StatusForbidden, http.MethodDelete, "/repos/o/r", "", true},
+		{"GitLab archive", forge.GitLab, true, http.StatusCreated, http.MethodPost, "/projects/o/r/archive", "", false},
+		{"GitLab delete", forge.GitLab, false, http.StatusAccepted, http.MethodDelete, "/projects/o/r", "", false},
+		{"Gitea archive", forge.Gitea, true, http.StatusOK, http.MethodPatch, "/repos/o/r", `{"archived":true}`, false},
+		{"Gitea delete", forge.Gitea, false, http.StatusNoContent, http.MethodDelete, "/repos/o/r", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				if r.Method != tt.wantMethod || r.URL.Path != tt.wantPath || string(b) != tt.wantBody {
+					t.Errorf("request = %s %s %s, want %s %s %s", r.Method, r.URL.Path, b, tt.wantMethod, tt.wantPath, tt.wantBody)
+				}
+				if r.Header.Get("Authorization") == "" && r.Header.Get("PRIVATE-TOKEN") == "" {
+					t.Errorf("token is not set")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			e := &forge.Exporter{Kind: tt.kind, APIURL: srv.URL, Project: "o/r", Token: "tok"}
+			var err error
+			if tt.archive {
+				err = e.Archive(context.Background())
+			} else {
+				err = e.Delete(context.Background())
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
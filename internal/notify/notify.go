@@ -0,0 +1,263 @@
+// Package notify sends notifications of backup results to HTTP webhooks, Slack-compatible incoming webhooks and SMTP servers.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+)
+
+// Event is the state transition of a Repository that is notified.
+type Event string
+
+const (
+	// Failed is sent when a backup fails after a succeeded one (or the first backup fails).
+	Failed Event = "Failed"
+	// Recovered is sent when a backup succeeds after a failed one.
+	Recovered Event = "Recovered"
+	// ConsecutiveFailures is sent when backups fail the specified number of times in a row.
+	ConsecutiveFailures Event = "ConsecutiveFailures"
+)
+
+const (
+	// DefaultTemplate is the default template of the message.
+	DefaultTemplate = `[gitbackup] {{.Event}}: Repository {{.Namespace}}/{{.Name}} ({{.Source}} -> {{.Destination}})` +
+		`{{if eq .Result "Failed"}} failed {{.ConsecutiveFailures}} time(s) in a row with {{.Reason}}: {{.Message}}{{else}} succeeded{{end}} (Job {{.JobName}})`
+	// DefaultSubject is the default template of the subject of emails.
+	DefaultSubject = `[gitbackup] {{.Event}}: Repository {{.Namespace}}/{{.Name}}`
+)
+
+// Notification is the data of a notification. The fields are available in templates e.g. "{{.Name}}".
+type Notification struct {
+	Event               Event      `json:"event"`
+	Namespace           string     `json:"namespace"`
+	Name                string     `json:"name"`
+	Source              string     `json:"source"`
+	Destination         string     `json:"destination"`
+	JobName             string     `json:"jobName"`
+	Result              string     `json:"result"`
+	Reason              string     `json:"reason,omitempty"`
+	Message             string     `json:"message,omitempty"`
+	Attempts            int32      `json:"attempts,omitempty"`
+	ConsecutiveFailures int32      `json:"consecutiveFailures,omitempty"`
+	CompletionTime      *time.Time `json:"completionTime,omitempty"`
+
+	// Subject and Text are rendered by Render.
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// Render sets Text and Subject of n by executing the templates. Empty templates mean the defaults.
+func (n *Notification) Render(text, subject string) error {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	if subject == "" {
+		subject = DefaultSubject
+	}
+	var err error
+	if n.Text, err = execute(text, n); err != nil {
+		return fmt.Errorf("unable to render template: %w", err)
+	}
+	if n.Subject, err = execute(subject, n); err != nil {
+		return fmt.Errorf("unable to render subject: %w", err)
+	}
+	return nil
+}
+
+func execute(text string, data any) (string, error) {
+	t, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RestrictedDialer returns a net.Dialer that refuses to connect to loopback, link-local and unspecified addresses
+// so that users who can create sinks cannot reach the sender itself, the node or the metadata service of the cloud provider.
+// The address is checked after name resolution so that names resolving to such addresses are refused too.
+func RestrictedDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return fmt.Errorf("connecting to %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+}
+
+// Sender sends rendered notifications.
+type Sender interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// Webhook POSTs notifications as JSON objects with all fields of Notification.
+type Webhook struct {
+	// URL specifies the endpoint.
+	URL string
+	// HTTPClient is used to send requests. (default: http.DefaultClient)
+	HTTPClient *http.Client
+}
+
+var _ Sender = &Webhook{}
+
+// Send implements Sender.
+func (w *Webhook) Send(ctx context.Context, n Notification) error {
+	return post(ctx, w.HTTPClient, w.URL, n)
+}
+
+// Slack POSTs the text of notifications to Slack-compatible incoming webhooks.
+type Slack struct {
+	// URL specifies the incoming webhook URL.
+	URL string
+	// HTTPClient is used to send requests. (default: http.DefaultClient)
+	HTTPClient *http.Client
+}
+
+var _ Sender = &Slack{}
+
+// Send implements Sender.
+func (s *Slack) Send(ctx context.Context, n Notification) error {
+	return post(ctx, s.HTTPClient, s.URL, map[string]string{"text": n.Text})
+}
+
+// post sends v as JSON and tests if the response is 2xx.
+func post(ctx context.Context, c *http.Client, url string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		// do not include the URL as it may contain a secret e.g. Slack webhooks
+		return fmt.Errorf("POST: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTP sends notifications as plain text emails. STARTTLS is used if the server supports it.
+type SMTP struct {
+	// Host and Port specify the SMTP server.
+	Host string
+	Port int32
+	// From and To specify the sender and the recipients.
+	From string
+	To   []string
+	// Username and Password are used for PLAIN authentication if Password is not empty.
+	Username string
+	Password string
+	// Dialer is used to connect to the server. (default: a net.Dialer without a timeout)
+	Dialer *net.Dialer
+	// TLSConfig is used for STARTTLS. ServerName is set to Host if empty. (default: verify the server with the system roots)
+	TLSConfig *tls.Config
+}
+
+var _ Sender = &SMTP{}
+
+// Send implements Sender.
+func (s *SMTP) Send(ctx context.Context, n Notification) error {
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(int(s.Port)))
+	d := s.Dialer
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		// tls.Client requires ServerName to verify the certificate of the server
+		config := &tls.Config{}
+		if s.TLSConfig != nil {
+			config = s.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = s.Host
+		}
+		if err := c.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if s.Password != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s *SMTP) message(n Notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(n.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(n.Text, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
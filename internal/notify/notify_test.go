@@ -0,0 +1,269 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ebiiim/gitbackup/internal/notify"
+)
+
+var testNotification = notify.Notification{
+	Event:               notify.Failed,
+	Namespace:           "default",
+	Name:                "repo1",
+	Source:              "https://example.com/src",
+	Destination:         "https://example.com/dst",
+	JobName:             "job1",
+	Result:              "Failed",
+	Reason:              "Auth",
+	Message:             "fatal: Authentication failed",
+	ConsecutiveFailures: 1,
+}
+
+func TestNotification_Render(t *testing.T) {
+	tests := []struct {
+		name        string
+		event       notify.Event
+		result      string
+		text        string
+		subject     string
+		wantText    string
+		wantSubject string
+		wantErr     bool
+	}{
+		{"default failed", notify.Failed, "Failed", "", "",
+			"[gitbackup] Failed: Repository default/repo1 (https://example.com/src -> https://example.com/dst) failed 1 time(s) in a row with Auth: fatal: Authentication failed (Job job1)",
+			"[gitbackup] Failed: Repository default/repo1", false},
+		{"default recovered", notify.Recovered, "Succeeded", "", "",
+			"[gitbackup] Recovered: Repository default/repo1 (https://example.com/src -> https://example.com/dst) succeeded (Job job1)",
+			"[gitbackup] Recovered: Repository default/repo1", false},
+		{"custom", notify.Failed, "Failed", "{{.Name}} {{.Reason}}", "{{.Event}}",
+			"repo1 Auth", "Failed", false},
+		{"invalid template", notify.Failed, "Failed", "{{.Name", "", "", "", true},
+		{"unknown field", notify.Failed, "Failed", "{{.Foo}}", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := testNotification
+			n.Event = tt.event
+			n.Result = tt.result
+			err := n.Render(tt.text, tt.subject)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if n.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", n.Text, tt.wantText)
+			}
+			if n.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", n.Subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestWebhook_Slack(t *testing.T) {
+	n := testNotification
+	n.Text = "hello"
+	tests := []struct {
+		name    string
+		sender  func(url string) notify.Sender
+		status  int
+		check   func(t *testing.T, body map[string]any)
+		wantErr bool
+	}{
+		{"webhook", func(url string) notify.Sender { return &notify.Webhook{URL: url} }, http.StatusOK,
+			func(t *testing.T, body map[string]any) {
+				if body["event"] != "Failed" || body["name"] != "repo1" || body["text"] != "hello" || body["reason"] != "Auth" {
+					t.Errorf("body = %v", body)
+				}
+			}, false},
+		{"slack", func(url string) notify.Sender { return &notify.Slack{URL: url} }, http.StatusOK,
+			func(t *testing.T, body map[string]any) {
+				if len(body) != 1 || body["text"] != "hello" {
+					t.Errorf("body = %v", body)
+				}
+			}, false},
+		{"error", func(url string) notify.Sender { return &notify.Webhook{URL: url} }, http.StatusInternalServerError,
+			func(t *testing.T, body map[string]any) {}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("request = %s %s", r.Method, r.Header.Get("Content-Type"))
+				}
+				var body map[string]any
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("unable to decode body: %v", err)
+				}
+				tt.check(t, body)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			err := tt.sender(srv.URL).Send(context.Background(), n)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// smtpServer is a minimal SMTP server that accepts one message and sends it to the returned channel.
+// It advertises STARTTLS if tlsConfig is not nil.
+func smtpServer(t *testing.T, tlsConfig *tls.Config) (host string, port int32, msgs <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { conn.Close() }()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = io.WriteString(conn, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		var b strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			b.WriteString(line)
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				if _, ok := conn.(*tls.Conn); !ok && tlsConfig != nil {
+					reply("250-localhost")
+					reply("250 STARTTLS")
+				} else {
+					reply("250 localhost")
+				}
+			case cmd == "STARTTLS":
+				reply("220 ready")
+				tlsConn := tls.Server(conn, tlsConfig)
+				if err := tlsConn.Handshake(); err != nil {
+					b.WriteString("handshake failed: " + err.Error())
+					ch <- b.String()
+					return
+				}
+				conn = tlsConn
+				r = bufio.NewReader(conn)
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					b.WriteString(line)
+				}
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 bye")
+				ch <- b.String()
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), int32(addr.Port), ch
+}
+
+func TestSMTP(t *testing.T) {
+	host, port, msgs := smtpServer(t, nil)
+	n := testNotification
+	n.Subject = "subject1"
+	n.Text = "line1\nline2"
+	s := &notify.SMTP{Host: host, Port: port, From: "gitbackup@example.com", To: []string{"a@example.com", "b@example.com"}}
+	if err := s.Send(context.Background(), n); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	got := <-msgs
+	for _, want := range []string{
+		"MAIL FROM:<gitbackup@example.com>",
+		"RCPT TO:<a@example.com>",
+		"RCPT TO:<b@example.com>",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: subject1\r\n",
+		"\r\nline1\r\nline2\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestSMTP_STARTTLS(t *testing.T) {
+	// borrow a certificate for 127.0.0.1 from httptest
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	host, port, msgs := smtpServer(t, &tls.Config{Certificates: srv.TLS.Certificates})
+	s := &notify.SMTP{Host: host, Port: port, From: "gitbackup@example.com", To: []string{"a@example.com"},
+		TLSConfig: &tls.Config{RootCAs: roots}}
+	if err := s.Send(context.Background(), testNotification); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	got := <-msgs
+	for _, want := range []string{"STARTTLS", "MAIL FROM:<gitbackup@example.com>", "RCPT TO:<a@example.com>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestSMTP_error(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	s := &notify.SMTP{Host: "127.0.0.1", Port: int32(port), From: "gitbackup@example.com", To: []string{"a@example.com"}}
+	if err := s.Send(context.Background(), testNotification); err == nil {
+		t.Errorf("Send() error = nil, want error")
+	}
+}
+
+func TestRestrictedDialer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	c := &http.Client{Transport: &http.Transport{DialContext: notify.RestrictedDialer(time.Second).DialContext}}
+	w := &notify.Webhook{URL: srv.URL, HTTPClient: c}
+	if err := w.Send(context.Background(), testNotification); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Webhook.Send() error = %v, want not allowed", err)
+	}
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	s := &notify.SMTP{Host: "localhost", Port: int32(p), From: "gitbackup@example.com", To: []string{"a@example.com"},
+		Dialer: notify.RestrictedDialer(time.Second)}
+	if err := s.Send(context.Background(), testNotification); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("SMTP.Send() error = %v, want not allowed", err)
+	}
+}
@@ -15,8 +15,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	gitbackupv1 "github.com/ebiiim/gitbackup/api/v1"
 	gitbackupv1beta1 "github.com/ebiiim/gitbackup/api/v1beta1"
 	"github.com/ebiiim/gitbackup/controllers"
+	"github.com/ebiiim/gitbackup/internal/cloudevents"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -29,6 +31,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(gitbackupv1beta1.AddToScheme(scheme))
+	utilruntime.Must(gitbackupv1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -36,11 +39,16 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var cloudEventsSink string
+	var allowInternalNotificationSinks bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&cloudEventsSink, "cloudevents-sink", "", "The URL to send CloudEvents of backups and Repositories to. CloudEvents are disabled if empty.")
+	flag.BoolVar(&allowInternalNotificationSinks, "allow-internal-notification-sinks", false,
+		"Allow Notifiers to send notifications to loopback and link-local addresses such as cloud metadata services.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -73,9 +81,23 @@ func main() {
 		os.Exit(1)
 	}
 
+	var publisher *cloudevents.Publisher
+	if cloudEventsSink != "" {
+		publisher = cloudevents.NewPublisher(cloudEventsSink)
+		if err := mgr.Add(publisher); err != nil {
+			setupLog.Error(err, "unable to set up CloudEvents publisher")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.RepositoryReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		APIReader:   mgr.GetAPIReader(),
+		Recorder:    mgr.GetEventRecorderFor(controllers.ControllerName),
+		CloudEvents: publisher,
+
+		AllowInternalNotificationSinks: allowInternalNotificationSinks,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Repository")
 		os.Exit(1)
@@ -85,8 +107,9 @@ func main() {
 		os.Exit(1)
 	}
 	if err = (&controllers.CollectionReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor(gitbackupv1.OperatorName + "-collection-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Collection")
 		os.Exit(1)
@@ -95,6 +118,45 @@ func main() {
 		setupLog.Error(err, "unable to create webhook", "webhook", "Collection")
 		os.Exit(1)
 	}
+	if err = (&controllers.RestoreReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Restore")
+		os.Exit(1)
+	}
+	if err = (&gitbackupv1beta1.Restore{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "Restore")
+		os.Exit(1)
+	}
+	if err = (&controllers.ClusterCollectionReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterCollection")
+		os.Exit(1)
+	}
+	if err = (&gitbackupv1beta1.ClusterCollection{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ClusterCollection")
+		os.Exit(1)
+	}
+	if err = (&gitbackupv1beta1.BackupPolicy{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "BackupPolicy")
+		os.Exit(1)
+	}
+	if err = (&gitbackupv1beta1.Notifier{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "Notifier")
+		os.Exit(1)
+	}
+	if err = (&gitbackupv1.Repository{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "Repository")
+		os.Exit(1)
+	}
+	if err = (&gitbackupv1.Collection{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "Collection")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {